@@ -22,6 +22,7 @@ package airspace
 
 import (
 	"image/color"
+	"math"
 	"time"
 )
 
@@ -38,19 +39,55 @@ type Airspacer interface {
 //
 // Date is of airspace definition or update.
 //
+// Ceiling and Floor keep the vertical limits as given by the source, and
+// CeilingAltitude and FloorAltitude the same limits parsed.
+//
+// Type, Frequency (MHz), Station and Activations are optional, as given in
+// extended formats. Activations holds the times when the airspace is
+// active, as given by the source (usually ISO 8601 intervals).
+//
 // Label is a list of Lat/Lon coordinates where the airspace label
 // (usually the name) should be placed.
 type Airspace struct {
-	ID       string
-	Date     time.Time
-	Class    byte
-	Name     string
-	Ceiling  string
-	Floor    string
-	Label    []string
-	Segments []Segment
-	Pen      Pen
-	Update   time.Time
+	ID              string
+	Date            time.Time
+	Class           byte
+	Name            string
+	Type            string
+	Frequency       float64
+	Station         string
+	Activations     []string
+	Ceiling         string
+	Floor           string
+	CeilingAltitude Altitude
+	FloorAltitude   Altitude
+	Label           []string
+	Segments        []Segment
+	Pen             Pen
+	Update          time.Time
+}
+
+// ContainsAltitude returns true if the given altitude (meters AMSL) is
+// between the airspace floor and ceiling, given the local QNH (hPa) and
+// terrain elevation (meters).
+func (a Airspace) ContainsAltitude(altitude float64, qnh float64, terrain float64) bool {
+	floor, ceiling := a.Limits(qnh, terrain)
+	return altitude >= floor && altitude <= ceiling
+}
+
+// Limits returns the airspace floor and ceiling in meters AMSL, given the
+// local QNH (hPa) and terrain elevation (meters). An Unknown floor is
+// taken as the ground and an Unknown ceiling as unlimited, so airspaces
+// with limits which could not be parsed are never missed.
+func (a Airspace) Limits(qnh float64, terrain float64) (float64, float64) {
+	floor, ceiling := terrain, math.Inf(1)
+	if a.FloorAltitude.Reference != Unknown {
+		floor = a.FloorAltitude.Meters(qnh, terrain)
+	}
+	if a.CeilingAltitude.Reference != Unknown {
+		ceiling = a.CeilingAltitude.Meters(qnh, terrain)
+	}
+	return floor, ceiling
 }
 
 // Segment is one of polygon, arc, circle.
@@ -76,6 +113,30 @@ type Segment struct {
 	Coordinate2 string
 }
 
+// Point is a vertex of the polygon resolved from the airspace segments.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// BoundingBox is the smallest lat/lon rectangle containing an airspace.
+type BoundingBox struct {
+	North float64
+	South float64
+	East  float64
+	West  float64
+}
+
+// Contains returns true if the given point is inside the bounding box.
+func (b BoundingBox) Contains(lat float64, lon float64) bool {
+	return lat >= b.South && lat <= b.North && lon >= b.West && lon <= b.East
+}
+
+// Intersects returns true if the two bounding boxes overlap.
+func (b BoundingBox) Intersects(o BoundingBox) bool {
+	return b.South <= o.North && o.South <= b.North && b.West <= o.East && o.West <= b.East
+}
+
 // SegmentType is an int for an AirspaceSegment.
 type SegmentType int
 
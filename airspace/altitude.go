@@ -0,0 +1,234 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package airspace
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Altitude is a vertical limit (floor or ceiling) of an airspace.
+//
+// Value is in the given Unit, and is ignored for the SFC, UNL and Unknown
+// references. Flight levels always have the STD reference. Limits which
+// could not be parsed have the Unknown reference, as the zero Altitude is
+// a valid 0 FT AMSL.
+type Altitude struct {
+	Value     float64
+	Unit      AltitudeUnit
+	Reference AltitudeReference
+}
+
+// AltitudeUnit is one of Feet, Meters, FlightLevel.
+type AltitudeUnit int
+
+const (
+	// Feet AltitudeUnit.
+	Feet AltitudeUnit = iota
+	// Meters AltitudeUnit.
+	Meters
+	// FlightLevel AltitudeUnit (hundreds of feet of pressure altitude).
+	FlightLevel
+)
+
+// AltitudeReference is one of AMSL, AGL, STD, SFC, UNL, Unknown.
+type AltitudeReference int
+
+const (
+	// AMSL is above mean sea level.
+	AMSL AltitudeReference = iota
+	// AGL is above ground level.
+	AGL
+	// STD is the standard pressure setting (1013.25hPa).
+	STD
+	// SFC is the surface (ground).
+	SFC
+	// UNL is unlimited.
+	UNL
+	// Unknown is a limit which could not be parsed.
+	Unknown
+)
+
+const (
+	// StandardPressure is the ISA sea level pressure in hPa.
+	StandardPressure = 1013.25
+
+	feetToMeters = 0.3048
+)
+
+// ParseAltitude parses the given airspace vertical limit, as in "FL65",
+// "2500ft AMSL", "1000 AGL", "SFC" or "UNL". Values with no unit are in
+// feet, and with no reference are AMSL. Limits which can't be parsed
+// return an error along with the Unknown altitude.
+func ParseAltitude(s string) (Altitude, error) {
+	fields := strings.Fields(strings.ToUpper(s))
+	if len(fields) == 0 {
+		return Altitude{Reference: Unknown}, fmt.Errorf("empty altitude")
+	}
+	switch fields[0] {
+	case "SFC", "GND", "SURFACE":
+		if len(fields) == 1 {
+			return Altitude{Reference: SFC}, nil
+		}
+	case "UNL", "UNLIM", "UNLTD", "UNLIMITED":
+		if len(fields) == 1 {
+			return Altitude{Reference: UNL}, nil
+		}
+	}
+
+	// split a number glued to its unit or prefix (FL65, 2500FT)
+	var tokens []string
+	for _, f := range fields {
+		i := strings.IndexFunc(f, notDigit)
+		j := strings.LastIndexFunc(f, notDigit)
+		switch {
+		case i > 0:
+			tokens = append(tokens, f[:i], f[i:])
+		case j != -1 && j < len(f)-1:
+			tokens = append(tokens, f[:j+1], f[j+1:])
+		default:
+			tokens = append(tokens, f)
+		}
+	}
+
+	a := Altitude{}
+	hasValue := false
+	for _, t := range tokens {
+		var err error
+		switch t {
+		case "FL":
+			a.Unit, a.Reference = FlightLevel, STD
+		case "FT", "F", "FEET":
+			a.Unit = Feet
+		case "M", "MTR", "METERS":
+			a.Unit = Meters
+		case "AMSL", "MSL", "ALT":
+			a.Reference = AMSL
+		case "AGL", "GND", "SFC", "ASFC":
+			a.Reference = AGL
+		case "STD":
+			a.Reference = STD
+		default:
+			if hasValue {
+				return Altitude{Reference: Unknown}, fmt.Errorf("invalid altitude :: %v", s)
+			}
+			a.Value, err = strconv.ParseFloat(t, 64)
+			if err != nil {
+				return Altitude{Reference: Unknown}, fmt.Errorf("invalid altitude :: %v", s)
+			}
+			hasValue = true
+		}
+	}
+	if !hasValue {
+		return Altitude{Reference: Unknown}, fmt.Errorf("altitude with no value :: %v", s)
+	}
+	if a.Unit == FlightLevel && a.Reference != STD {
+		return Altitude{Reference: Unknown}, fmt.Errorf("flight level with reference :: %v", s)
+	}
+	return a, nil
+}
+
+// notDigit returns true if c is not part of a decimal number.
+func notDigit(c rune) bool {
+	return (c < '0' || c > '9') && c != '.'
+}
+
+// String returns the altitude in the usual OpenAir notation.
+func (a Altitude) String() string {
+	v := strconv.FormatFloat(a.Value, 'f', -1, 64)
+	switch a.Reference {
+	case SFC:
+		return "SFC"
+	case UNL:
+		return "UNL"
+	case Unknown:
+		return "UNKNOWN"
+	}
+	if a.Unit == FlightLevel {
+		return "FL" + v
+	}
+	unit := "FT"
+	if a.Unit == Meters {
+		unit = "M"
+	}
+	ref := "AMSL"
+	if a.Reference == AGL {
+		ref = "AGL"
+	} else if a.Reference == STD {
+		ref = "STD"
+	}
+	return v + unit + " " + ref
+}
+
+// Meters returns the altitude in meters above mean sea level, given the
+// local QNH (hPa) and terrain elevation (meters). A QNH of 0 is taken as
+// the standard pressure. UNL returns positive infinity, and Unknown NaN.
+func (a Altitude) Meters(qnh float64, terrain float64) float64 {
+	v := a.Value
+	switch a.Unit {
+	case Feet:
+		v *= feetToMeters
+	case FlightLevel:
+		v *= 100 * feetToMeters
+	}
+	switch a.Reference {
+	case SFC:
+		return terrain
+	case UNL:
+		return math.Inf(1)
+	case Unknown:
+		return math.NaN()
+	case AGL:
+		return terrain + v
+	case STD:
+		return PressureToQNHAltitude(v, qnh)
+	}
+	return v
+}
+
+// Compare returns -1, 0 or 1 if a is below, at the same level or above b,
+// after converting both to meters AMSL with the given QNH and terrain.
+// Unknown altitudes can't be placed and return 0.
+func (a Altitude) Compare(b Altitude, qnh float64, terrain float64) int {
+	if a.Reference == Unknown || b.Reference == Unknown {
+		return 0
+	}
+	ma, mb := a.Meters(qnh, terrain), b.Meters(qnh, terrain)
+	switch {
+	case ma < mb:
+		return -1
+	case ma > mb:
+		return 1
+	}
+	return 0
+}
+
+// PressureToQNHAltitude converts the given pressure altitude (meters
+// with the standard setting) to the altitude above mean sea level with
+// the given QNH, using the ISA atmosphere.
+func PressureToQNHAltitude(altitude float64, qnh float64) float64 {
+	if qnh <= 0 || qnh == StandardPressure {
+		return altitude
+	}
+	p := StandardPressure * math.Pow(1-altitude/44330.77, 1/0.190263)
+	return 44330.77 * (1 - math.Pow(p/qnh, 0.190263))
+}
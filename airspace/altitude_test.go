@@ -0,0 +1,164 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package airspace
+
+import (
+	"math"
+	"testing"
+)
+
+type ParseAltitudeTest struct {
+	t   string
+	in  string
+	r   Altitude
+	s   string
+	err bool
+}
+
+var parseAltitudeTests = []ParseAltitudeTest{
+	{"flight level", "FL65", Altitude{65, FlightLevel, STD}, "FL65", false},
+	{"flight level with space", "FL 185", Altitude{185, FlightLevel, STD}, "FL185", false},
+	{"flight level leading zero", "FL065", Altitude{65, FlightLevel, STD}, "FL65", false},
+	{"feet amsl", "2500FT AMSL", Altitude{2500, Feet, AMSL}, "2500FT AMSL", false},
+	{"feet amsl lower case", "2500ft amsl", Altitude{2500, Feet, AMSL}, "2500FT AMSL", false},
+	{"feet msl", "2500 ft MSL", Altitude{2500, Feet, AMSL}, "2500FT AMSL", false},
+	{"no unit agl", "1000 AGL", Altitude{1000, Feet, AGL}, "1000FT AGL", false},
+	{"feet sfc", "1000FT SFC", Altitude{1000, Feet, AGL}, "1000FT AGL", false},
+	{"feet gnd", "1000FT GND", Altitude{1000, Feet, AGL}, "1000FT AGL", false},
+	{"meters", "1500M AMSL", Altitude{1500, Meters, AMSL}, "1500M AMSL", false},
+	{"meters agl", "300 m AGL", Altitude{300, Meters, AGL}, "300M AGL", false},
+	{"only value", "3000", Altitude{3000, Feet, AMSL}, "3000FT AMSL", false},
+	{"feet std", "5000FT STD", Altitude{5000, Feet, STD}, "5000FT STD", false},
+	{"surface", "SFC", Altitude{Reference: SFC}, "SFC", false},
+	{"ground", " GND ", Altitude{Reference: SFC}, "SFC", false},
+	{"unlimited", "UNL", Altitude{Reference: UNL}, "UNL", false},
+	{"unlimited long", "unlimited", Altitude{Reference: UNL}, "UNL", false},
+	{"unlimited tnp", "UNLTD", Altitude{Reference: UNL}, "UNL", false},
+	{"empty", "", Altitude{Reference: Unknown}, "UNKNOWN", true},
+	{"no value", "FT AMSL", Altitude{Reference: Unknown}, "UNKNOWN", true},
+	{"flight level no value", "FL", Altitude{Reference: Unknown}, "UNKNOWN", true},
+	{"two values", "1000 2000 FT", Altitude{Reference: Unknown}, "UNKNOWN", true},
+	{"garbage", "ABC", Altitude{Reference: Unknown}, "UNKNOWN", true},
+	{"flight level with reference", "FL65 AGL", Altitude{Reference: Unknown}, "UNKNOWN", true},
+}
+
+func TestParseAltitude(t *testing.T) {
+	for _, test := range parseAltitudeTests {
+		result, err := ParseAltitude(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %v failed, expected error got %v", test.t, result)
+			}
+		} else if err != nil {
+			t.Errorf("test %v failed :: %v", test.t, err)
+			continue
+		}
+		if result != test.r {
+			t.Errorf("test %v failed, expected %+v got %+v", test.t, test.r, result)
+		}
+		if result.String() != test.s {
+			t.Errorf("test %v failed, expected string %v got %v", test.t, test.s, result.String())
+		}
+	}
+}
+
+type AltitudeMetersTest struct {
+	t       string
+	in      Altitude
+	qnh     float64
+	terrain float64
+	r       float64
+}
+
+var altitudeMetersTests = []AltitudeMetersTest{
+	{"feet amsl", Altitude{1000, Feet, AMSL}, 1020, 500, 304.8},
+	{"meters amsl", Altitude{1000, Meters, AMSL}, 1020, 500, 1000},
+	{"feet agl", Altitude{1000, Feet, AGL}, 1020, 500, 804.8},
+	{"surface", Altitude{Reference: SFC}, 1020, 500, 500},
+	{"flight level standard qnh", Altitude{65, FlightLevel, STD}, 1013.25, 0, 1981.2},
+	{"flight level no qnh", Altitude{65, FlightLevel, STD}, 0, 0, 1981.2},
+	// about 8m per hPa at this level
+	{"flight level high qnh", Altitude{65, FlightLevel, STD}, 1023.25, 0, 2060.3},
+	{"flight level low qnh", Altitude{65, FlightLevel, STD}, 1003.25, 0, 1901.2},
+}
+
+func TestAltitudeMeters(t *testing.T) {
+	for _, test := range altitudeMetersTests {
+		result := test.in.Meters(test.qnh, test.terrain)
+		if math.Abs(result-test.r) > 0.5 {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, result)
+		}
+	}
+	if r := (Altitude{Reference: UNL}).Meters(1013.25, 0); !math.IsInf(r, 1) {
+		t.Errorf("expected infinite altitude for UNL got %v", r)
+	}
+	if r := (Altitude{Reference: Unknown}).Meters(1013.25, 0); !math.IsNaN(r) {
+		t.Errorf("expected NaN altitude for unknown got %v", r)
+	}
+}
+
+func TestAltitudeCompare(t *testing.T) {
+	fl65 := Altitude{65, FlightLevel, STD}
+	ft6500 := Altitude{6500, Feet, AMSL}
+	if c := fl65.Compare(ft6500, 1013.25, 0); c != 0 {
+		t.Errorf("expected FL65 at 6500FT with standard qnh got %v", c)
+	}
+	if c := fl65.Compare(ft6500, 1030, 0); c != 1 {
+		t.Errorf("expected FL65 above 6500FT with high qnh got %v", c)
+	}
+	if c := fl65.Compare(ft6500, 1000, 0); c != -1 {
+		t.Errorf("expected FL65 below 6500FT with low qnh got %v", c)
+	}
+	if c := (Altitude{Reference: UNL}).Compare(fl65, 1013.25, 0); c != 1 {
+		t.Errorf("expected UNL above FL65 got %v", c)
+	}
+	if c := (Altitude{Reference: Unknown}).Compare(fl65, 1013.25, 0); c != 0 {
+		t.Errorf("expected unknown not to compare with FL65 got %v", c)
+	}
+}
+
+func TestAirspaceContainsAltitude(t *testing.T) {
+	a := Airspace{
+		FloorAltitude:   Altitude{1000, Feet, AGL},
+		CeilingAltitude: Altitude{65, FlightLevel, STD},
+	}
+	tests := []struct {
+		altitude float64
+		terrain  float64
+		r        bool
+	}{
+		{1000, 500, true},
+		{700, 500, false},
+		{900, 800, false},
+		{1981, 0, true},
+		{1982, 0, false},
+	}
+	for _, test := range tests {
+		if r := a.ContainsAltitude(test.altitude, 1013.25, test.terrain); r != test.r {
+			t.Errorf("expected %v for altitude %v and terrain %v got %v",
+				test.r, test.altitude, test.terrain, r)
+		}
+	}
+	a = Airspace{FloorAltitude: Altitude{Reference: Unknown}, CeilingAltitude: Altitude{Reference: Unknown}}
+	if !a.ContainsAltitude(500, 1013.25, 500) || !a.ContainsAltitude(10000, 1013.25, 500) ||
+		a.ContainsAltitude(499, 1013.25, 500) {
+		t.Errorf("expected unknown limits to be ground and unlimited")
+	}
+}
@@ -20,15 +20,26 @@
 package cli
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	commander "code.google.com/p/go-commander"
 	"github.com/golang/glog"
+	"github.com/rochaporto/ezgliding/airspace"
 	"github.com/rochaporto/ezgliding/config"
+	"github.com/rochaporto/ezgliding/flight/analysis"
+	"github.com/rochaporto/ezgliding/openaip"
+	"github.com/rochaporto/ezgliding/openair"
 	"github.com/rochaporto/ezgliding/plugin"
+	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/sua"
 )
 
 // CmdGetAirspace command gets airspace information.
@@ -65,3 +76,180 @@ func runAirspaceGet(cmd *commander.Command, args []string) {
 		fmt.Printf("%+v\n", airspaces[i])
 	}
 }
+
+// CmdAirspaceCheck command checks a flight for airspace infringements.
+var CmdAirspaceCheck = &commander.Command{
+	UsageLine: "airspace-check [options] file.igc",
+	Short:     "checks a flight for airspace infringements",
+	Long: `
+Checks the given IGC flight log against the airspace data of the given
+regions, and outputs every airspace penetration and near miss.
+
+Example:
+  ezgliding airspace-check --region=FR --classes=C,D --qnh=1020 flight.igc
+` + "\n" + helpFlags(flag.CommandLine),
+	Run:  runAirspaceCheck,
+	Flag: *flag.CommandLine,
+}
+
+// runAirspaceCheck checks the given flight log against the configured
+// airspace plugin data and outputs the infringements found.
+func runAirspaceCheck(cmd *commander.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "failed to check airspace :: no flight file given\n")
+		return
+	}
+	f, err := readIGC(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check airspace :: %v\n", err)
+		return
+	}
+	cfg, _ := config.Get()
+	aspace, err := plugin.GetAirspacer("", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get airspacer plugin :: %v\n", err)
+		return
+	}
+	airspaces, err := aspace.GetAirspace(strings.Split(*region, ","), time.Time{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get airspace :: %v\n", err)
+		return
+	}
+	acfg := analysis.DefaultAirspaceConfig
+	acfg.QNH = *qnh
+	for _, c := range strings.Split(*classes, ",") {
+		if c != "" {
+			acfg.Classes = append(acfg.Classes, c[0])
+		}
+	}
+	fcfg := analysis.DefaultConfig
+	fcfg.GNSSAltitude = *gnss
+	result, err := analysis.CheckAirspace(f, airspaces, fcfg, acfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check airspace :: %v\n", err)
+		return
+	}
+	glog.V(5).Infof("airspace check with args '%v' got %d infringements", args, len(result.Infringements))
+	glog.V(20).Infof("%+v", result)
+	switch *format {
+	case "json":
+		b, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Printf("%s\n", b)
+	case "text":
+		for _, i := range result.Infringements {
+			fmt.Printf("infringement :: %v (%c) %v-%v, depth %.0fm lateral %.0fm vertical\n",
+				i.Name, i.Class, i.Entry.Format("15:04:05"), i.Exit.Format("15:04:05"),
+				i.LateralDepth, i.VerticalDepth)
+		}
+		for _, n := range result.NearMisses {
+			fmt.Printf("near miss :: %v (%c) %v, %.0fm lateral %.0fm vertical\n",
+				n.Name, n.Class, n.Time.Format("15:04:05"), n.Distance, n.Height)
+		}
+		fmt.Printf("%d infringements, %d near misses\n", len(result.Infringements), len(result.NearMisses))
+	default:
+		fmt.Fprintf(os.Stderr, "failed to check airspace :: unknown format %v\n", *format)
+	}
+}
+
+// CmdAirspaceConvert command converts airspace files between formats.
+var CmdAirspaceConvert = &commander.Command{
+	UsageLine: "airspace-convert [options] input output",
+	Short:     "converts airspace files between formats",
+	Long: `
+Converts the airspace in the input file to the format of the output file.
+The format is given by the file extension:
+  .txt, .air      OpenAir
+  .aip, .xml      OpenAIP
+  .sua            Tim Newport-Peace
+  .geojson, .json GeoJSON
+
+Example:
+  ezgliding airspace-convert france.txt france.geojson
+` + "\n" + helpFlags(flag.CommandLine),
+	Run:  runAirspaceConvert,
+	Flag: *flag.CommandLine,
+}
+
+// airspaceFormat has the functions to parse and write airspace in a
+// given format.
+type airspaceFormat struct {
+	parse func([]byte) ([]airspace.Airspace, error)
+	write func(io.Writer, []airspace.Airspace) error
+}
+
+// airspaceFormats maps file extensions to the corresponding format.
+var airspaceFormats = map[string]airspaceFormat{
+	".txt":     airspaceFormat{openair.Parse, openair.Write},
+	".air":     airspaceFormat{openair.Parse, openair.Write},
+	".aip":     airspaceFormat{openaip.Parse, openaip.Write},
+	".xml":     airspaceFormat{openaip.Parse, openaip.Write},
+	".sua":     airspaceFormat{sua.Parse, sua.Write},
+	".geojson": airspaceFormat{spatial.GeoJSON2Airspace, writeAirspaceGeoJSON},
+	".json":    airspaceFormat{spatial.GeoJSON2Airspace, writeAirspaceGeoJSON},
+}
+
+// writeAirspaceGeoJSON writes the given airspaces as a GeoJSON collection.
+func writeAirspaceGeoJSON(w io.Writer, airspaces []airspace.Airspace) error {
+	collection, err := spatial.Airspace2GeoJSON(airspaces, spatial.DefaultArcResolution)
+	if err != nil {
+		return err
+	}
+	b, err := collection.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// airspaceFormatFor returns the airspace format for the given file.
+func airspaceFormatFor(path string) (airspaceFormat, error) {
+	f, ok := airspaceFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return airspaceFormat{}, fmt.Errorf("unknown airspace format :: %v", path)
+	}
+	return f, nil
+}
+
+// runAirspaceConvert converts the airspace in the input file to the format
+// of the output file.
+func runAirspaceConvert(cmd *commander.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "failed to convert airspace :: expected input and output files\n")
+		return
+	}
+	if err := convertAirspace(args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to convert airspace :: %v\n", err)
+	}
+}
+
+// convertAirspace does the conversion in runAirspaceConvert.
+func convertAirspace(input string, output string) error {
+	in, err := airspaceFormatFor(input)
+	if err != nil {
+		return err
+	}
+	out, err := airspaceFormatFor(output)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	airspaces, err := in.parse(content)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = out.write(file, airspaces); err != nil {
+		return err
+	}
+	glog.V(5).Infof("airspace convert from %v to %v got %d results", input, output, len(airspaces))
+	fmt.Printf("converted %d airspaces to %v\n", len(airspaces), filepath.Base(output))
+	return file.Close()
+}
@@ -21,6 +21,10 @@ package cli
 
 import (
 	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -38,14 +42,15 @@ func ExampleAirspaceGet() {
 		GetAirspaceF: func(regions []string, updatedSince time.Time) ([]airspace.Airspace, error) {
 			return []airspace.Airspace{
 				airspace.Airspace{ID: "MockID", Date: time.Time{}, Class: 'C', Name: "MockName",
-					Ceiling: "1000FT AMSL", Floor: "500FT AMSL", Update: time.Time{}},
+					Ceiling: "1000FT AMSL", Floor: "500FT AMSL", Update: time.Time{},
+					CeilingAltitude: airspace.Altitude{Value: 1000}, FloorAltitude: airspace.Altitude{Value: 500}},
 			}, nil
 		},
 	},
 	)
 	config.Set(config.Config{Global: config.Global{Airspacer: "mockairspaceget"}})
 	runAirspaceGet(CmdAirspaceGet, []string{})
-	// Output: {ID:MockID Date:0001-01-01 00:00:00 +0000 UTC Class:67 Name:MockName Ceiling:1000FT AMSL Floor:500FT AMSL Label:[] Segments:[] Pen:{Style:0 Width:0 Color:<nil> InsideColor:<nil>} Update:0001-01-01 00:00:00 +0000 UTC}
+	// Output: {ID:MockID Date:0001-01-01 00:00:00 +0000 UTC Class:67 Name:MockName Type: Frequency:0 Station: Activations:[] Ceiling:1000FT AMSL Floor:500FT AMSL CeilingAltitude:1000FT AMSL FloorAltitude:500FT AMSL Label:[] Segments:[] Pen:{Style:0 Width:0 Color:<nil> InsideColor:<nil>} Update:0001-01-01 00:00:00 +0000 UTC}
 }
 
 func TestAirspaceGetBadPluginID(t *testing.T) {
@@ -63,3 +68,125 @@ func TestAirspaceGetFailed(t *testing.T) {
 	config.Set(config.Config{Global: config.Global{Airspacer: "mockairspacegetfailed"}})
 	runAirspaceGet(CmdAirspaceGet, []string{})
 }
+
+// ExampleAirspaceCheck checks the flight used in flight-stats against a
+// mock airspace covering the airfield.
+func ExampleAirspaceCheck() {
+	file, _ := ioutil.TempFile("", "ezgliding")
+	defer os.Remove(file.Name())
+	file.WriteString(flightStatsIGC)
+	file.Close()
+	ctr := airspace.Airspace{Name: "CTR", Class: 'C', Floor: "1000FT AMSL", Ceiling: "3000FT AMSL",
+		FloorAltitude:   airspace.Altitude{Value: 1000},
+		CeilingAltitude: airspace.Altitude{Value: 3000},
+		Segments: []airspace.Segment{
+			airspace.Segment{Type: airspace.Polygon, Coordinate1: "45:59:00 N 005:59:00 E"},
+			airspace.Segment{Type: airspace.Polygon, Coordinate1: "45:59:00 N 006:01:00 E"},
+			airspace.Segment{Type: airspace.Polygon, Coordinate1: "46:01:00 N 006:01:00 E"},
+			airspace.Segment{Type: airspace.Polygon, Coordinate1: "46:01:00 N 005:59:00 E"},
+		},
+	}
+	plugin.Register("mockairspacecheck", &mock.Mock{
+		GetAirspaceF: func(regions []string, updatedSince time.Time) ([]airspace.Airspace, error) {
+			return []airspace.Airspace{ctr}, nil
+		},
+	},
+	)
+	config.Set(config.Config{Global: config.Global{Airspacer: "mockairspacecheck"}})
+	runAirspaceCheck(CmdAirspaceCheck, []string{file.Name()})
+	_ = flag.Set("classes", "D")
+	runAirspaceCheck(CmdAirspaceCheck, []string{file.Name()})
+	_ = flag.Set("classes", "")
+	// Output:
+	// infringement :: CTR (C) 12:00:10-12:00:40, depth 1287m lateral 195m vertical
+	// 1 infringements, 0 near misses
+	// 0 infringements, 0 near misses
+}
+
+// ExampleAirspaceCheckMissingFile tests giving a non existing flight file, with null output
+func ExampleAirspaceCheckMissingFile() {
+	runAirspaceCheck(CmdAirspaceCheck, []string{"/non/existing/flight.igc"})
+	runAirspaceCheck(CmdAirspaceCheck, []string{})
+	// Output:
+}
+
+const convertOpenAir = `AC D
+AN CTR TEST
+AL SFC
+AH 3500FT AMSL
+V X=46:00:00 N 006:00:00 E
+DC 2
+
+AC R
+AN R1
+AL FL65
+AH FL95
+DP 46:00:00 N 006:00:00 E
+DP 46:00:00 N 006:30:00 E
+DP 46:30:00 N 006:30:00 E
+`
+
+// ExampleAirspaceConvert converts an OpenAir file to all other formats,
+// and back to OpenAir.
+func ExampleAirspaceConvert() {
+	dir, _ := ioutil.TempDir("", "ezgliding")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(input, []byte(convertOpenAir), 0644)
+	for _, output := range []string{"test.sua", "test.aip", "test.geojson"} {
+		runAirspaceConvert(CmdAirspaceConvert, []string{input, filepath.Join(dir, output)})
+		runAirspaceConvert(CmdAirspaceConvert, []string{filepath.Join(dir, output), filepath.Join(dir, "back.air")})
+	}
+	// Output:
+	// converted 2 airspaces to test.sua
+	// converted 2 airspaces to back.air
+	// converted 2 airspaces to test.aip
+	// converted 2 airspaces to back.air
+	// converted 2 airspaces to test.geojson
+	// converted 2 airspaces to back.air
+}
+
+// ExampleAirspaceConvertFailed tests missing arguments, unknown formats and
+// missing files, with null output.
+func ExampleAirspaceConvertFailed() {
+	runAirspaceConvert(CmdAirspaceConvert, []string{"test.txt"})
+	runAirspaceConvert(CmdAirspaceConvert, []string{"test.doc", "test.txt"})
+	runAirspaceConvert(CmdAirspaceConvert, []string{"test.txt", "test.doc"})
+	runAirspaceConvert(CmdAirspaceConvert, []string{"/non/existing/test.txt", "test.sua"})
+	// Output:
+}
+
+func TestAirspaceConvert(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ezgliding")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(input, []byte(convertOpenAir), 0644)
+	original, _ := airspaceFormats[".txt"].parse([]byte(convertOpenAir))
+	for ext, format := range airspaceFormats {
+		output := filepath.Join(dir, "test"+ext)
+		if err := convertAirspace(input, output); err != nil {
+			t.Errorf("failed to convert to %v :: %v", ext, err)
+			continue
+		}
+		content, _ := ioutil.ReadFile(output)
+		result, err := format.parse(content)
+		if err != nil {
+			t.Errorf("failed to parse %v :: %v", ext, err)
+			continue
+		}
+		if len(result) != len(original) {
+			t.Errorf("%v :: expected %v airspaces got %v", ext, len(original), len(result))
+			continue
+		}
+		for i := range result {
+			if result[i].Name != original[i].Name || result[i].Class != original[i].Class ||
+				result[i].FloorAltitude != original[i].FloorAltitude ||
+				result[i].CeilingAltitude != original[i].CeilingAltitude {
+				t.Errorf("%v :: expected %+v got %+v", ext, original[i], result[i])
+			}
+		}
+	}
+	if err := convertAirspace(input, filepath.Join(dir, "missing", "test.sua")); err == nil {
+		t.Errorf("expected error converting to a missing directory")
+	}
+}
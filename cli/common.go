@@ -29,8 +29,12 @@ import (
 )
 
 var (
-	after  = flag.String("after", "", "consider only items updated after this date")
-	region = flag.String("region", "", "return only items for this comma separated list of regions")
+	after   = flag.String("after", "", "consider only items updated after this date")
+	classes = flag.String("classes", "", "consider only this comma separated list of airspace classes")
+	format  = flag.String("format", "text", "output format (text, json)")
+	gnss    = flag.Bool("gnss", false, "use gnss instead of pressure altitude")
+	qnh     = flag.Float64("qnh", 1013.25, "local pressure setting (hPa)")
+	region  = flag.String("region", "", "return only items for this comma separated list of regions")
 )
 
 // helpFlags builds the text in 'help' regarding available command flags.
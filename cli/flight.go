@@ -20,14 +20,19 @@
 package cli
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/rochaporto/ezgliding/config"
 	"github.com/rochaporto/ezgliding/flight"
+	"github.com/rochaporto/ezgliding/flight/analysis"
 	"github.com/rochaporto/ezgliding/plugin"
 
 	commander "code.google.com/p/go-commander"
@@ -37,6 +42,7 @@ var (
 	startID = flag.String("startID", "", "return only flights with ID higher than this")
 	id      = flag.String("id", "", "return flight with this ID")
 	max     = flag.String("max", "", "max number of flights to return (used with startID)")
+	fixes   = flag.Bool("fixes", false, "include time, altitude and vario of each fix (geojson)")
 )
 
 // CmdFlightGet command gets flight information.
@@ -106,3 +112,135 @@ func runFlightGet(cmd *commander.Command, args []string) {
 		}
 	}
 }
+
+// CmdFlightStats command outputs thermal statistics for a flight.
+var CmdFlightStats = &commander.Command{
+	UsageLine: "flight-stats [options] file.igc",
+	Short:     "outputs flight thermal statistics",
+	Long: `
+Analyses the given IGC flight log and outputs statistics for each
+thermal, along with a summary for the full flight.
+
+Example:
+  ezgliding flight-stats -format=json flight.igc
+` + "\n" + helpFlags(flag.CommandLine),
+	Run:  runFlightStats,
+	Flag: *flag.CommandLine,
+}
+
+// runFlightStats parses the given flight log and outputs its thermal statistics.
+func runFlightStats(cmd *commander.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "failed to get flight stats :: no flight file given\n")
+		return
+	}
+	f, err := readIGC(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get flight stats :: %v\n", err)
+		return
+	}
+	stats, err := analysis.Thermals(f, analysis.DefaultConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get flight stats :: %v\n", err)
+		return
+	}
+	glog.V(5).Infof("flight stats with args '%v' got %d thermals", args, len(stats.Thermals))
+	glog.V(20).Infof("%+v", stats)
+	switch *format {
+	case "json":
+		b, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Printf("%s\n", b)
+	case "text":
+		fmt.Printf("takeoff %v, landing %v\n", stats.Takeoff.Format("15:04:05"),
+			stats.Landing.Format("15:04:05"))
+		for i, t := range stats.Thermals {
+			fmt.Printf("thermal %d :: %v-%v, %vm-%vm, avg %.1fm/s, peak %.1fm/s, %v, circle %.0fs, wind %.1fm/s from %.0f\n",
+				i+1, t.Start.Format("15:04:05"), t.End.Format("15:04:05"),
+				t.EntryAltitude, t.ExitAltitude, t.AverageClimb, t.PeakClimb,
+				t.Direction, t.CircleTime.Seconds(), t.WindSpeed, t.WindDirection)
+		}
+		fmt.Printf("mean climb %.1fm/s, circling %.1f%%, best thermal %d\n",
+			stats.MeanClimb, stats.CirclingPercentage, stats.Best+1)
+	default:
+		fmt.Fprintf(os.Stderr, "failed to get flight stats :: unknown format %v\n", *format)
+	}
+}
+
+// CmdFlightExport command exports a flight to other formats.
+var CmdFlightExport = &commander.Command{
+	UsageLine: "flight-export [options] file.igc output",
+	Short:     "exports a flight to other formats",
+	Long: `
+Exports the given IGC flight log to the format of the output file.
+The format is given by the file extension:
+  .geojson, .json GeoJSON
+  .kml            KML (Google Earth)
+  .kmz            KML zipped
+
+Example:
+  ezgliding flight-export -gnss flight.igc flight.kmz
+` + "\n" + helpFlags(flag.CommandLine),
+	Run:  runFlightExport,
+	Flag: *flag.CommandLine,
+}
+
+// flightExporters maps file extensions to the corresponding exporter.
+var flightExporters = map[string]func(io.Writer, flight.Flight, flight.ExportConfig) error{
+	".geojson": flight.WriteGeoJSON,
+	".json":    flight.WriteGeoJSON,
+	".kml":     flight.WriteKML,
+	".kmz":     flight.WriteKMZ,
+}
+
+// runFlightExport parses the given flight log and writes it to the output
+// file, in the format given by its extension.
+func runFlightExport(cmd *commander.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "failed to export flight :: expected flight and output files\n")
+		return
+	}
+	if err := exportFlight(args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export flight :: %v\n", err)
+	}
+}
+
+// exportFlight does the export in runFlightExport.
+func exportFlight(input string, output string) error {
+	export, ok := flightExporters[strings.ToLower(filepath.Ext(output))]
+	if !ok {
+		return fmt.Errorf("unknown flight format :: %v", output)
+	}
+	f, err := readIGC(input)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	cfg := flight.ExportConfig{GNSSAltitude: *gnss, FixProperties: *fixes}
+	if err = export(file, f, cfg); err != nil {
+		return err
+	}
+	glog.V(5).Infof("flight export from %v to %v with %d points", input, output, len(f.Points))
+	fmt.Printf("exported %d points to %v\n", len(f.Points), filepath.Base(output))
+	return file.Close()
+}
+
+// readIGC parses the IGC flight log in the given file.
+// Invalid records are skipped and logged as warnings.
+func readIGC(path string) (flight.Flight, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return flight.Flight{}, err
+	}
+	defer file.Close()
+	d := flight.NewIGCDecoder(file)
+	d.Lenient = true
+	f, err := d.Decode()
+	for _, w := range d.Warnings {
+		glog.Warningf("%v :: %v", path, w)
+	}
+	return f, err
+}
@@ -22,6 +22,10 @@ package cli
 import (
 	"errors"
 	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -207,3 +211,105 @@ func TestFlightGetFromIDFailed(t *testing.T) {
 	flag.Set("startID", "1")
 	runFlightGet(CmdFlightGet, []string{})
 }
+
+// flightStatsIGC is a straight flight with no thermals.
+const flightStatsIGC = `AXYY001
+HFDTE010715
+B1200004600000N00600000EA0050000550
+B1200104600000N00600000EA0050000550
+B1200204600300N00600000EA0049000540
+B1200304600600N00600000EA0048000530
+B1200404600900N00600000EA0047000520
+B1200504600900N00600000EA0047000520
+B1201004600900N00600000EA0047000520
+`
+
+// ExampleFlightStats outputs the statistics of a flight with no thermals,
+// first as text and then as json.
+func ExampleFlightStats() {
+	file, _ := ioutil.TempFile("", "ezgliding")
+	defer os.Remove(file.Name())
+	file.WriteString(flightStatsIGC)
+	file.Close()
+	_ = flag.Set("format", "text")
+	runFlightStats(CmdFlightStats, []string{file.Name()})
+	_ = flag.Set("format", "json")
+	runFlightStats(CmdFlightStats, []string{file.Name()})
+	_ = flag.Set("format", "text")
+	// Output:
+	// takeoff 12:00:10, landing 12:00:40
+	// mean climb 0.0m/s, circling 0.0%, best thermal 0
+	// {
+	//   "Takeoff": "2015-07-01T12:00:10Z",
+	//   "Landing": "2015-07-01T12:00:40Z",
+	//   "Thermals": [],
+	//   "MeanClimb": 0,
+	//   "CirclingPercentage": 0,
+	//   "Best": -1
+	// }
+}
+
+// ExampleFlightStatsMissingFile tests giving a non existing flight file, with null output
+func ExampleFlightStatsMissingFile() {
+	runFlightStats(CmdFlightStats, []string{"/non/existing/flight.igc"})
+	runFlightStats(CmdFlightStats, []string{})
+	// Output:
+}
+
+// ExampleFlightExport exports the flight used in flight-stats to all the
+// supported formats.
+func ExampleFlightExport() {
+	dir, _ := ioutil.TempDir("", "ezgliding")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "flight.igc")
+	ioutil.WriteFile(input, []byte(flightStatsIGC), 0644)
+	for _, output := range []string{"flight.geojson", "flight.kml", "flight.kmz"} {
+		runFlightExport(CmdFlightExport, []string{input, filepath.Join(dir, output)})
+	}
+	// Output:
+	// exported 7 points to flight.geojson
+	// exported 7 points to flight.kml
+	// exported 7 points to flight.kmz
+}
+
+// ExampleFlightExportFailed tests missing arguments, unknown formats and
+// missing files, with null output.
+func ExampleFlightExportFailed() {
+	runFlightExport(CmdFlightExport, []string{"flight.igc"})
+	runFlightExport(CmdFlightExport, []string{"flight.igc", "flight.doc"})
+	runFlightExport(CmdFlightExport, []string{"/non/existing/flight.igc", "flight.kml"})
+	// Output:
+}
+
+func TestFlightExportFixes(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ezgliding")
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "flight.igc"), filepath.Join(dir, "flight.json")
+	ioutil.WriteFile(input, []byte(flightStatsIGC), 0644)
+	_ = flag.Set("fixes", "true")
+	defer flag.Set("fixes", "false")
+	if err := exportFlight(input, output); err != nil {
+		t.Fatalf("failed to export flight :: %v", err)
+	}
+	content, _ := ioutil.ReadFile(output)
+	if !strings.Contains(string(content), `"Varios":[0,0,-1,-1,-1,0,0]`) {
+		t.Errorf("expected fix properties in output :: %s", content)
+	}
+	if err := exportFlight(input, filepath.Join(dir, "missing", "flight.kml")); err == nil {
+		t.Errorf("expected error exporting to a missing directory")
+	}
+}
+
+func TestReadIGCLenient(t *testing.T) {
+	file, _ := ioutil.TempFile("", "ezgliding")
+	defer os.Remove(file.Name())
+	file.WriteString(strings.Replace(flightStatsIGC, "\nB", "\nHFZZZUNKNOWN:HEADER\nXGARBAGE\nB", 1))
+	file.Close()
+	f, err := readIGC(file.Name())
+	if err != nil {
+		t.Fatalf("failed to read flight with unknown records :: %v", err)
+	}
+	if len(f.Points) != 7 {
+		t.Errorf("expected 7 points but got %v", len(f.Points))
+	}
+}
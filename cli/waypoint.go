@@ -22,16 +22,24 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	commander "code.google.com/p/go-commander"
 	"github.com/golang/glog"
+	"github.com/rochaporto/ezgliding/airfield"
 	"github.com/rochaporto/ezgliding/config"
+	"github.com/rochaporto/ezgliding/cup"
+	"github.com/rochaporto/ezgliding/gpx"
+	"github.com/rochaporto/ezgliding/ozi"
 	"github.com/rochaporto/ezgliding/plugin"
 	"github.com/rochaporto/ezgliding/util"
 	"github.com/rochaporto/ezgliding/waypoint"
+	"github.com/rochaporto/ezgliding/winpilot"
 )
 
 // CmdWaypointGet command gets waypoint information and outputs the result.
@@ -111,3 +119,125 @@ func runWaypointPut(cmd *commander.Command, args []string) {
 	}
 	fmt.Printf("pushed %v waypoints into %v\n", len(waypoints), pluginID)
 }
+
+// CmdWaypointConvert command converts waypoint files between formats.
+var CmdWaypointConvert = &commander.Command{
+	UsageLine: "waypoint-convert [options] input output",
+	Short:     "converts waypoint files between formats",
+	Long: `
+Converts the waypoints in the input file to the format of the output file.
+The input format is detected from the file content (falling back to the
+file extension), the output format is given by the file extension:
+  .cup            SeeYou
+  .dat            Winpilot, Cambridge
+  .wpt            OziExplorer
+  .gpx            GPS Exchange Format
+
+Example:
+  ezgliding waypoint-convert france.cup france.gpx
+` + "\n" + helpFlags(flag.CommandLine),
+	Run:  runWaypointConvert,
+	Flag: *flag.CommandLine,
+}
+
+// waypointFormat has the functions to detect, parse and write airfields
+// and waypoints in a given format.
+type waypointFormat struct {
+	detect func([]byte) bool
+	parse  func([]byte) ([]airfield.Airfield, []waypoint.Waypoint, error)
+	write  func(io.Writer, []airfield.Airfield, []waypoint.Waypoint) error
+}
+
+// waypointFormats maps file extensions to the corresponding format.
+var waypointFormats = map[string]waypointFormat{
+	".cup": waypointFormat{cup.Detect, parseWaypointCup, writeWaypointCup},
+	".dat": waypointFormat{winpilot.Detect, winpilot.Parse, winpilot.Write},
+	".wpt": waypointFormat{ozi.Detect, parseWaypointOzi, ozi.Write},
+	".gpx": waypointFormat{gpx.Detect, gpx.Parse, gpx.Write},
+}
+
+// waypointDetectOrder is the order in which formats are detected, the
+// most specific first.
+var waypointDetectOrder = []string{".gpx", ".wpt", ".dat", ".cup"}
+
+// parseWaypointCup parses a CUP file, ignoring its tasks.
+func parseWaypointCup(content []byte) ([]airfield.Airfield, []waypoint.Waypoint, error) {
+	f, err := cup.Parse(content)
+	return f.Airfields, f.Waypoints, err
+}
+
+// writeWaypointCup writes a CUP file with no tasks.
+func writeWaypointCup(w io.Writer, airfields []airfield.Airfield, waypoints []waypoint.Waypoint) error {
+	return cup.Write(w, cup.File{Airfields: airfields, Waypoints: waypoints})
+}
+
+// parseWaypointOzi parses an OziExplorer file, which has no airfields.
+func parseWaypointOzi(content []byte) ([]airfield.Airfield, []waypoint.Waypoint, error) {
+	waypoints, err := ozi.Parse(content)
+	return []airfield.Airfield{}, waypoints, err
+}
+
+// waypointFormatFor returns the waypoint format for the given file.
+func waypointFormatFor(path string) (waypointFormat, error) {
+	f, ok := waypointFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return waypointFormat{}, fmt.Errorf("unknown waypoint format :: %v", path)
+	}
+	return f, nil
+}
+
+// detectWaypointFormat returns the waypoint format for the given content,
+// or the one for the file extension if it can't be detected.
+func detectWaypointFormat(path string, content []byte) (waypointFormat, error) {
+	for _, ext := range waypointDetectOrder {
+		if f := waypointFormats[ext]; f.detect(content) {
+			glog.V(5).Infof("detected format %v for %v", ext, path)
+			return f, nil
+		}
+	}
+	return waypointFormatFor(path)
+}
+
+// runWaypointConvert converts the waypoints in the input file to the format
+// of the output file.
+func runWaypointConvert(cmd *commander.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "failed to convert waypoints :: expected input and output files\n")
+		return
+	}
+	if err := convertWaypoint(args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to convert waypoints :: %v\n", err)
+	}
+}
+
+// convertWaypoint does the conversion in runWaypointConvert.
+func convertWaypoint(input string, output string) error {
+	out, err := waypointFormatFor(output)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	in, err := detectWaypointFormat(input, content)
+	if err != nil {
+		return err
+	}
+	airfields, waypoints, err := in.parse(content)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = out.write(file, airfields, waypoints); err != nil {
+		return err
+	}
+	glog.V(5).Infof("waypoint convert from %v to %v got %d airfields and %d waypoints",
+		input, output, len(airfields), len(waypoints))
+	fmt.Printf("converted %d airfields and %d waypoints to %v\n", len(airfields), len(waypoints), filepath.Base(output))
+	return file.Close()
+}
@@ -22,10 +22,15 @@ package cli
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/rochaporto/ezgliding/config"
+	"github.com/rochaporto/ezgliding/cup"
 	"github.com/rochaporto/ezgliding/mock"
 	"github.com/rochaporto/ezgliding/plugin"
 	"github.com/rochaporto/ezgliding/waypoint"
@@ -132,6 +137,32 @@ func ExampleWaypointPut() {
 	// pushed 1 waypoints into mockwaypointput
 }
 
+// ExampleWaypointPutCup pushes waypoints from the mock implementation into
+// a cup file, and reads them back.
+func ExampleWaypointPutCup() {
+	plugin.Register("mockwaypointcup", &mock.Mock{
+		GetWaypointF: func(regions []string, updatedSince time.Time) ([]waypoint.Waypoint, error) {
+			return []waypoint.Waypoint{
+				waypoint.Waypoint{ID: "MockID", Name: "MockName", Description: "MockDescription",
+					Region: "FR", Flags: waypoint.MountainTop, Elevation: 2000, Latitude: 32.5, Longitude: 100.5},
+			}, nil
+		},
+	},
+	)
+	dir, _ := ioutil.TempDir("", "cli")
+	defer os.RemoveAll(dir)
+	cfg := cup.Config{File: filepath.Join(dir, "waypoints.cup")}
+	config.Set(config.Config{Global: config.Global{Waypointer: "mockwaypointcup"}, Cup: cfg})
+	flag.Set("region", "")
+	runWaypointPut(CmdWaypointPut, []string{"cup"})
+	c, _ := cup.New(cfg)
+	waypoints, _ := c.GetWaypoint([]string{}, time.Time{})
+	fmt.Printf("%v %v %v\n", waypoints[0].ID, waypoints[0].Name, waypoints[0].Flags == waypoint.MountainTop)
+	// Output:
+	// pushed 1 waypoints into cup
+	// MockID MockName true
+}
+
 func TestWaypointPutFailed(t *testing.T) {
 	plugin.Register("mockwaypointbadput", mock.Mock{
 		PutWaypointF: func(waypoints []waypoint.Waypoint) error {
@@ -166,3 +197,76 @@ func TestWaypointPutBadPluginID(t *testing.T) {
 func TestWaypointPutBadArgNumber(t *testing.T) {
 	runWaypointPut(CmdWaypointPut, []string{})
 }
+
+const convertCup = `name,code,country,lat,lon,elev,style,rwdir,rwlen,freq,desc
+"Challes","LFLE",FR,4533.650N,00558.617E,296m,4,180,620m,"122.500",""
+"Chambery Sud","CHAMB",FR,4530.000N,00600.000E,305m,3,,300m,,""
+"Mont Blanc","MTBLANC",FR,4549.950N,00651.867E,4808m,7,,,,"Summit"
+`
+
+// ExampleWaypointConvert converts a CUP file to all other formats, and
+// back to CUP. OziExplorer has no airfields, so they come back as
+// waypoints.
+func ExampleWaypointConvert() {
+	dir, _ := ioutil.TempDir("", "ezgliding")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "test.cup")
+	ioutil.WriteFile(input, []byte(convertCup), 0644)
+	for _, output := range []string{"test.dat", "test.wpt", "test.gpx"} {
+		runWaypointConvert(CmdWaypointConvert, []string{input, filepath.Join(dir, output)})
+		runWaypointConvert(CmdWaypointConvert, []string{filepath.Join(dir, output), filepath.Join(dir, "back.cup")})
+	}
+	// Output:
+	// converted 2 airfields and 1 waypoints to test.dat
+	// converted 2 airfields and 1 waypoints to back.cup
+	// converted 2 airfields and 1 waypoints to test.wpt
+	// converted 0 airfields and 3 waypoints to back.cup
+	// converted 2 airfields and 1 waypoints to test.gpx
+	// converted 2 airfields and 1 waypoints to back.cup
+}
+
+// ExampleWaypointConvertFailed tests missing arguments, unknown formats and
+// missing files, with null output.
+func ExampleWaypointConvertFailed() {
+	runWaypointConvert(CmdWaypointConvert, []string{"test.cup"})
+	runWaypointConvert(CmdWaypointConvert, []string{"test.cup", "test.doc"})
+	runWaypointConvert(CmdWaypointConvert, []string{"/non/existing/test.cup", "test.gpx"})
+	// Output:
+}
+
+func TestWaypointConvert(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ezgliding")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input.cup")
+	ioutil.WriteFile(input, []byte(convertCup), 0644)
+	_, original, _ := waypointFormats[".cup"].parse([]byte(convertCup))
+	for ext := range waypointFormats {
+		// the format of the input must be detected from its content
+		output := filepath.Join(dir, "test"+ext)
+		if err := convertWaypoint(input, output); err != nil {
+			t.Errorf("failed to convert to %v :: %v", ext, err)
+			continue
+		}
+		renamed := filepath.Join(dir, "test"+ext+".txt")
+		os.Rename(output, renamed)
+		back := filepath.Join(dir, "back"+ext+".cup")
+		if err := convertWaypoint(renamed, back); err != nil {
+			t.Errorf("failed to convert back from %v :: %v", ext, err)
+			continue
+		}
+		content, _ := ioutil.ReadFile(back)
+		_, result, _ := waypointFormats[".cup"].parse(content)
+		if len(result) == 0 || result[len(result)-1].Name != original[0].Name ||
+			result[len(result)-1].Elevation != original[0].Elevation {
+			t.Errorf("%v :: expected %+v got %+v", ext, original, result)
+		}
+	}
+	unknown := filepath.Join(dir, "test.txt")
+	ioutil.WriteFile(unknown, []byte("unknown content"), 0644)
+	if err := convertWaypoint(unknown, filepath.Join(dir, "test.gpx")); err == nil {
+		t.Errorf("expected error converting unknown format")
+	}
+	if err := convertWaypoint(input, filepath.Join(dir, "missing", "test.gpx")); err == nil {
+		t.Errorf("expected error converting to a missing directory")
+	}
+}
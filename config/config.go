@@ -38,6 +38,7 @@ import (
 	"os"
 	"os/user"
 
+	"github.com/rochaporto/ezgliding/cup"
 	"github.com/rochaporto/ezgliding/fusiontables"
 	"github.com/rochaporto/ezgliding/mock"
 	"github.com/rochaporto/ezgliding/netcoupe"
@@ -71,6 +72,7 @@ type Global struct {
 // Config holds all the config information for ezgliding plugins and apps.
 type Config struct {
 	Global       Global
+	Cup          cup.Config
 	FusionTables fusiontables.Config
 	Mock         mock.Config
 	Netcoupe     netcoupe.Config
@@ -0,0 +1,558 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package cup provides functionality to read and write airfield, waypoint
+// and task information in the SeeYou (Naviter) CUP format.
+//
+// It is also a plugin (ID cup) implementing the airfield and waypoint
+// interfaces, reading and writing a single CUP file.
+package cup
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const (
+	// ID is the plugin id.
+	ID string = "cup"
+	// DefaultFile is the file used when none is configured.
+	DefaultFile = "ezgliding.cup"
+)
+
+// Config holds all config information for the cup plugin.
+type Config struct {
+	File string
+}
+
+// Cup is the plugin implementation reading and writing airfields and
+// waypoints from a CUP file.
+type Cup struct {
+	Config
+}
+
+// New returns a new instance of Cup.
+func New(cfg Config) (*Cup, error) {
+	if cfg.File == "" {
+		cfg.File = DefaultFile
+	}
+	c := Cup{Config: cfg}
+	glog.V(20).Infof("Plugin cup initialized :: %+v", c)
+	return &c, nil
+}
+
+// GetAirfield follows airfield.GetAirfield().
+// CUP files hold no update times, so updatedSince is ignored.
+func (c *Cup) GetAirfield(regions []string, updatedSince time.Time) ([]airfield.Airfield, error) {
+	f, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	m := regionSet(regions)
+	if m == nil {
+		return f.Airfields, nil
+	}
+	var filtered []airfield.Airfield
+	for _, a := range f.Airfields {
+		if m[a.Region] {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered, nil
+}
+
+// PutAirfield follows airfield.PutAirfield().
+// Airfields already in the file are replaced, waypoints and tasks kept.
+func (c *Cup) PutAirfield(airfields []airfield.Airfield) error {
+	f, err := c.read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f.Airfields = airfields
+	return c.write(f)
+}
+
+// GetWaypoint follows waypoint.GetWaypoint().
+// CUP files hold no update times, so updatedSince is ignored.
+func (c *Cup) GetWaypoint(regions []string, updatedSince time.Time) ([]waypoint.Waypoint, error) {
+	f, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	m := regionSet(regions)
+	if m == nil {
+		return f.Waypoints, nil
+	}
+	var filtered []waypoint.Waypoint
+	for _, w := range f.Waypoints {
+		if m[w.Region] {
+			filtered = append(filtered, w)
+		}
+	}
+	return filtered, nil
+}
+
+// PutWaypoint follows waypoint.PutWaypoint().
+// Waypoints already in the file are replaced, airfields and tasks kept.
+func (c *Cup) PutWaypoint(waypoints []waypoint.Waypoint) error {
+	f, err := c.read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f.Waypoints = waypoints
+	return c.write(f)
+}
+
+func (c *Cup) read() (File, error) {
+	content, err := ioutil.ReadFile(c.File)
+	if err != nil {
+		return File{}, err
+	}
+	return Parse(content)
+}
+
+func (c *Cup) write(f File) error {
+	out, err := os.Create(c.File)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return Write(out, f)
+}
+
+// regionSet returns the given regions as a set, or nil if no region is
+// given (meaning all regions).
+func regionSet(regions []string) map[string]bool {
+	m := map[string]bool{}
+	for _, r := range regions {
+		if r != "" {
+			m[r] = true
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// File holds the contents of a CUP file. Points with an airfield or
+// outlanding style are kept in Airfields, all others in Waypoints.
+type File struct {
+	Airfields []airfield.Airfield
+	Waypoints []waypoint.Waypoint
+	Tasks     []Task
+}
+
+// Task is a task from the related tasks section of a CUP file.
+//
+// Waypoints holds the names of the task points, from takeoff to landing.
+// Options holds the task options (NoStart, TaskTime, ...) and Zones the
+// observation zone attributes (Style, R1, A1, ...) keyed by the task point
+// index.
+type Task struct {
+	Description string
+	Waypoints   []string
+	Options     map[string]string
+	Zones       map[int]map[string]string
+}
+
+// Point styles, as defined in the CUP format.
+const (
+	styleWaypoint     = 1
+	styleGrass        = 2
+	styleOutlanding   = 3
+	styleGliderSite   = 4
+	styleSolid        = 5
+	styleMountainPass = 6
+)
+
+// waypointFlags are the waypoint flags for the styles starting with
+// styleMountainPass, in order.
+var waypointFlags = []int{
+	waypoint.MountainPass, waypoint.MountainTop, waypoint.Mast, waypoint.VOR,
+	waypoint.NDB, waypoint.CoolingTower, waypoint.Dam, waypoint.Tunnel,
+	waypoint.Bridge, waypoint.PowerPlant, waypoint.Castle, waypoint.Intersection,
+}
+
+// columns are the default CUP columns, used when the file has no header.
+var columns = []string{"name", "code", "country", "lat", "lon", "elev", "style", "rwdir", "rwlen", "freq", "desc"}
+
+const taskSeparator = "-----Related Tasks-----"
+
+// Parse parses the given CUP content.
+//
+// The columns are taken from the header, if present, so that newer
+// versions of the format (with rwwidth, userdata, ...) are supported.
+// Content can be UTF-8 (with or without a byte order mark) or ISO-8859-1,
+// as written by older versions of SeeYou.
+func Parse(content []byte) (File, error) {
+	result := File{}
+	header := map[string]int{}
+	for i, c := range columns {
+		header[c] = i
+	}
+	tasks := false
+	lines := strings.Split(util.DecodeText(content), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.EqualFold(line, taskSeparator) {
+			tasks = true
+			continue
+		}
+		record, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil {
+			return File{}, util.ParseError{Line: i + 1, Err: err}
+		}
+		switch {
+		case tasks:
+			err = result.parseTask(record)
+		case strings.EqualFold(record[0], "name") && len(result.Airfields)+len(result.Waypoints) == 0:
+			header = map[string]int{}
+			for j, c := range record {
+				header[strings.ToLower(strings.TrimSpace(c))] = j
+			}
+		default:
+			err = result.parsePoint(record, header)
+		}
+		if err != nil {
+			return File{}, util.ParseError{Line: i + 1, Err: err}
+		}
+	}
+	return result, nil
+}
+
+// Detect returns true if the given content looks like a CUP file, either
+// by its header or by the coordinate notation in its first record.
+func Detect(content []byte) bool {
+	for _, line := range strings.Split(util.DecodeText(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		record, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil || len(record) < 5 {
+			return false
+		}
+		if strings.EqualFold(record[0], "name") && strings.EqualFold(record[1], "code") {
+			return true
+		}
+		lat := strings.TrimSpace(record[3])
+		_, err = spatial.ParseLatitude(lat)
+		return err == nil && strings.Index(lat, ".") == 4 && !strings.Contains(lat, ":")
+	}
+	return false
+}
+
+// parsePoint adds the airfield or waypoint in the given record.
+func (f *File) parsePoint(record []string, header map[string]int) error {
+	col := func(name string) string {
+		if i, ok := header[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	name, code := col("name"), col("code")
+	if code == "" {
+		code = name
+	}
+	lat, err := spatial.ParseLatitude(col("lat"))
+	if err != nil {
+		return err
+	}
+	lon, err := spatial.ParseLongitude(col("lon"))
+	if err != nil {
+		return err
+	}
+	elevation, err := parseDistance(col("elev"))
+	if err != nil {
+		return fmt.Errorf("invalid elevation :: %v", err)
+	}
+	style := 0
+	if v := col("style"); v != "" {
+		if style, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid style :: %v", v)
+		}
+	}
+
+	switch style {
+	case styleGrass, styleOutlanding, styleGliderSite, styleSolid:
+		a := airfield.Airfield{ID: code, ShortName: code, Name: name, Region: col("country"),
+			Flags: styleToAirfield(style), Elevation: round(elevation), Latitude: lat, Longitude: lon}
+		if v := col("rwdir"); v != "" {
+			dir, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid runway direction :: %v", v)
+			}
+			a.Runway = runway(dir)
+		}
+		length, err := parseDistance(col("rwlen"))
+		if err != nil {
+			return fmt.Errorf("invalid runway length :: %v", err)
+		}
+		a.Length = round(length)
+		if v := col("freq"); v != "" {
+			if a.Frequency, err = strconv.ParseFloat(v, 64); err != nil {
+				return fmt.Errorf("invalid frequency :: %v", v)
+			}
+		}
+		f.Airfields = append(f.Airfields, a)
+	default:
+		f.Waypoints = append(f.Waypoints, waypoint.Waypoint{ID: code, Name: name, Description: col("desc"),
+			Region: col("country"), Flags: styleToWaypoint(style), Elevation: round(elevation),
+			Latitude: lat, Longitude: lon})
+	}
+	return nil
+}
+
+// parseTask handles the records in the related tasks section.
+func (f *File) parseTask(record []string) error {
+	key, value := record[0], ""
+	if n := strings.Index(record[0], "="); n != -1 {
+		key, value = record[0][:n], record[0][n+1:]
+	}
+	switch {
+	case strings.EqualFold(key, "Options"):
+		if len(f.Tasks) == 0 {
+			return fmt.Errorf("task options with no task")
+		}
+		t := &f.Tasks[len(f.Tasks)-1]
+		t.Options = attributes(record[1:])
+	case strings.EqualFold(key, "ObsZone"):
+		if len(f.Tasks) == 0 {
+			return fmt.Errorf("observation zone with no task")
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid observation zone :: %v", value)
+		}
+		t := &f.Tasks[len(f.Tasks)-1]
+		if t.Zones == nil {
+			t.Zones = map[int]map[string]string{}
+		}
+		t.Zones[n] = attributes(record[1:])
+	case strings.EqualFold(key, "Point"), strings.EqualFold(key, "STARTS"):
+		// task local waypoints and alternate starts, not supported
+	case value != "":
+		return fmt.Errorf("unrecognized task record :: %v", key)
+	default:
+		t := Task{Description: record[0]}
+		for _, w := range record[1:] {
+			if w = strings.TrimSpace(w); w != "" {
+				t.Waypoints = append(t.Waypoints, w)
+			}
+		}
+		f.Tasks = append(f.Tasks, t)
+	}
+	return nil
+}
+
+// attributes returns the given key=value pairs as a map.
+func attributes(record []string) map[string]string {
+	result := map[string]string{}
+	for _, r := range record {
+		if n := strings.Index(r, "="); n != -1 {
+			result[strings.TrimSpace(r[:n])] = strings.TrimSpace(r[n+1:])
+		}
+	}
+	return result
+}
+
+// parseDistance parses the given distance, returning it in meters. The
+// unit can be one of m, km, ft, nm (nautical miles) or ml (statute miles),
+// with no unit being meters.
+func parseDistance(s string) (float64, error) {
+	s = strings.ToLower(s)
+	if s == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		factor float64
+	}{{"km", 1000}, {"nm", 1852}, {"ml", 1609.344}, {"ft", 0.3048}, {"m", 1}}
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.factor
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid distance :: %v", s)
+	}
+	return v * factor, nil
+}
+
+func round(v float64) int {
+	return int(math.Floor(v + 0.5))
+}
+
+// runway returns the runway designators (as in "0927") for the given
+// heading, the lowest first.
+func runway(heading int) string {
+	d1 := ((heading+5)/10+35)%36 + 1
+	d2 := (d1+17)%36 + 1
+	if d1 > d2 {
+		d1, d2 = d2, d1
+	}
+	return fmt.Sprintf("%02d%02d", d1, d2)
+}
+
+// styleToAirfield returns the airfield flags for the given style.
+func styleToAirfield(style int) int {
+	switch style {
+	case styleGrass:
+		return airfield.Grass
+	case styleOutlanding:
+		return airfield.Outlanding
+	case styleGliderSite:
+		return airfield.GliderSite
+	}
+	return airfield.Asphalt
+}
+
+// airfieldToStyle returns the style for the given airfield flags, the
+// reverse of styleToAirfield.
+func airfieldToStyle(flags int) int {
+	switch {
+	case flags&airfield.Outlanding != 0:
+		return styleOutlanding
+	case flags&airfield.GliderSite != 0:
+		return styleGliderSite
+	case flags&(airfield.Asphalt|airfield.Concrete) != 0:
+		return styleSolid
+	}
+	return styleGrass
+}
+
+// styleToWaypoint returns the waypoint flags for the given style.
+func styleToWaypoint(style int) int {
+	if i := style - styleMountainPass; i >= 0 && i < len(waypointFlags) {
+		return waypointFlags[i]
+	}
+	return 0
+}
+
+// waypointToStyle returns the style for the given waypoint flags, the
+// reverse of styleToWaypoint.
+func waypointToStyle(flags int) int {
+	for i, f := range waypointFlags {
+		if flags&f != 0 {
+			return styleMountainPass + i
+		}
+	}
+	return styleWaypoint
+}
+
+// Write writes the given airfields, waypoints and tasks in the CUP format.
+// Records end in CRLF.
+func Write(w io.Writer, f File) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%v\r\n", strings.Join(columns, ","))
+	for _, a := range f.Airfields {
+		rwdir := ""
+		if len(a.Runway) >= 2 {
+			if d, err := strconv.Atoi(a.Runway[:2]); err == nil {
+				rwdir = fmt.Sprintf("%03d", d*10%360)
+			}
+		}
+		rwlen, freq := "", ""
+		if a.Length != 0 {
+			rwlen = fmt.Sprintf("%dm", a.Length)
+		}
+		if a.Frequency != 0 {
+			freq = fmt.Sprintf("%.3f", a.Frequency)
+		}
+		writePoint(bw, a.Name, a.ShortName, a.Region, a.Latitude, a.Longitude, a.Elevation,
+			airfieldToStyle(a.Flags), rwdir, rwlen, freq, "")
+	}
+	for _, wp := range f.Waypoints {
+		writePoint(bw, wp.Name, wp.ID, wp.Region, wp.Latitude, wp.Longitude, wp.Elevation,
+			waypointToStyle(wp.Flags), "", "", "", wp.Description)
+	}
+	if len(f.Tasks) > 0 {
+		fmt.Fprintf(bw, "%v\r\n", taskSeparator)
+	}
+	for _, t := range f.Tasks {
+		fields := []string{quote(t.Description)}
+		for _, w := range t.Waypoints {
+			fields = append(fields, quote(w))
+		}
+		fmt.Fprintf(bw, "%v\r\n", strings.Join(fields, ","))
+		if len(t.Options) > 0 {
+			fmt.Fprintf(bw, "Options,%v\r\n", joinAttributes(t.Options))
+		}
+		zones := []int{}
+		for n := range t.Zones {
+			zones = append(zones, n)
+		}
+		sort.Ints(zones)
+		for _, n := range zones {
+			fmt.Fprintf(bw, "ObsZone=%d,%v\r\n", n, joinAttributes(t.Zones[n]))
+		}
+	}
+	return bw.Flush()
+}
+
+// writePoint writes a single CUP point record.
+func writePoint(w io.Writer, name string, code string, country string, lat float64, lon float64,
+	elevation int, style int, rwdir string, rwlen string, freq string, desc string) {
+	if freq != "" {
+		freq = quote(freq)
+	}
+	fmt.Fprintf(w, "%v,%v,%v,%v,%v,%dm,%d,%v,%v,%v,%v\r\n", quote(name), quote(code), country,
+		spatial.FormatLatitude(lat, spatial.CUP), spatial.FormatLongitude(lon, spatial.CUP),
+		elevation, style, rwdir, rwlen, freq, quote(desc))
+}
+
+// joinAttributes returns the given attributes as key=value pairs, sorted
+// by key.
+func joinAttributes(attrs map[string]string) string {
+	keys := []string{}
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + attrs[k]
+	}
+	return strings.Join(keys, ",")
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
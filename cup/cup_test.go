@@ -0,0 +1,305 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package cup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const testCup = "\ufeff" + `name,code,country,lat,lon,elev,style,rwdir,rwlen,freq,desc
+"Annecy Meythet","LFLP",FR,4555.783N,00606.383E,463.0m,5,040,1700.0m,"120.075","Airfield"
+"Challes","LFLE",FR,4533.650N,00558.617E,296m,4,180,620m,"122.500",""
+"Chambery Sud",,FR,4530.000N,00600.000E,1000ft,3,,300m,,""
+"Col du Galibier","GALIBIER",FR,4503.833N,00624.483E,2642m,6,,,,"Mountain pass"
+"Mont Blanc","MTBLANC",FR,4549.950N,00651.867E,4808m,7,,,,""
+"Bridge","BRIDGE",IT,4500.000N,00700.000E,300m,1,,,,""
+-----Related Tasks-----
+"Savoy","Challes","Annecy Meythet","Col du Galibier","Challes"
+Options,NoStart=12:00:00,TaskTime=03:00:00
+ObsZone=0,Style=2,R1=5000m,A1=180,Line=1
+ObsZone=1,Style=1,R1=500m,A1=45
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(strings.Replace(testCup, "\n", "\r\n", -1)))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	airfields := []airfield.Airfield{
+		airfield.Airfield{ID: "LFLP", ShortName: "LFLP", Name: "Annecy Meythet", Region: "FR",
+			Flags: airfield.Asphalt, Elevation: 463, Runway: "0422", Length: 1700, Frequency: 120.075},
+		airfield.Airfield{ID: "LFLE", ShortName: "LFLE", Name: "Challes", Region: "FR",
+			Flags: airfield.GliderSite, Elevation: 296, Runway: "1836", Length: 620, Frequency: 122.5},
+		airfield.Airfield{ID: "Chambery Sud", ShortName: "Chambery Sud", Name: "Chambery Sud", Region: "FR",
+			Flags: airfield.Outlanding, Elevation: 305, Length: 300},
+	}
+	waypoints := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "GALIBIER", Name: "Col du Galibier", Description: "Mountain pass",
+			Region: "FR", Flags: waypoint.MountainPass, Elevation: 2642},
+		waypoint.Waypoint{ID: "MTBLANC", Name: "Mont Blanc", Region: "FR", Flags: waypoint.MountainTop, Elevation: 4808},
+		waypoint.Waypoint{ID: "BRIDGE", Name: "Bridge", Region: "IT", Elevation: 300},
+	}
+	if math.Abs(f.Airfields[0].Latitude-(45+55.783/60)) > 1e-9 || math.Abs(f.Airfields[0].Longitude-(6+6.383/60)) > 1e-9 {
+		t.Errorf("wrong position :: %v %v", f.Airfields[0].Latitude, f.Airfields[0].Longitude)
+	}
+	for i := range f.Airfields {
+		f.Airfields[i].Latitude, f.Airfields[i].Longitude = 0, 0
+	}
+	for i := range f.Waypoints {
+		f.Waypoints[i].Latitude, f.Waypoints[i].Longitude = 0, 0
+	}
+	if !reflect.DeepEqual(f.Airfields, airfields) {
+		t.Errorf("expected %+v got %+v", airfields, f.Airfields)
+	}
+	if !reflect.DeepEqual(f.Waypoints, waypoints) {
+		t.Errorf("expected %+v got %+v", waypoints, f.Waypoints)
+	}
+	tasks := []Task{
+		Task{Description: "Savoy", Waypoints: []string{"Challes", "Annecy Meythet", "Col du Galibier", "Challes"},
+			Options: map[string]string{"NoStart": "12:00:00", "TaskTime": "03:00:00"},
+			Zones: map[int]map[string]string{
+				0: map[string]string{"Style": "2", "R1": "5000m", "A1": "180", "Line": "1"},
+				1: map[string]string{"Style": "1", "R1": "500m", "A1": "45"},
+			}},
+	}
+	if !reflect.DeepEqual(f.Tasks, tasks) {
+		t.Errorf("expected %+v got %+v", tasks, f.Tasks)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	content := "name,code,country,lat,lon,elev,style,rwdir,rwlen,rwwidth,freq,desc,userdata\n" +
+		"\"Challes\",\"LFLE\",FR,4533.650N,00558.617E,296m,4,180,620m,30m,\"122.500\",\"\",\"\"\n"
+	f, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if len(f.Airfields) != 1 || f.Airfields[0].Frequency != 122.5 || f.Airfields[0].Length != 620 {
+		t.Errorf("wrong airfields :: %+v", f.Airfields)
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	content := "\"Z\xfcrich\",\"LSZH\",CH,4727.500N,00832.900E,432m,5,140,3700m,\"118.100\",\"\"\r\n"
+	f, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if len(f.Airfields) != 1 || f.Airfields[0].Name != "Zürich" {
+		t.Errorf("wrong airfields :: %+v", f.Airfields)
+	}
+}
+
+var detectTests = []struct {
+	t       string
+	content string
+	r       bool
+}{
+	{"header", "name,code,country,lat,lon,elev,style,rwdir,rwlen,freq,desc\n", true},
+	{"no header", "\"Challes\",\"LFLE\",FR,4533.650N,00558.617E,296m,4,180,620m,\"122.500\",\"\"", true},
+	{"winpilot", "1,45:33.650N,005:58.617E,296M,AT,Challes,LFLE", false},
+	{"gpx", "<?xml version=\"1.0\"?>\n<gpx version=\"1.1\"></gpx>", false},
+	{"empty", "", false},
+}
+
+func TestDetect(t *testing.T) {
+	for _, test := range detectTests {
+		if r := Detect([]byte(test.content)); r != test.r {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, r)
+		}
+	}
+}
+
+var parseErrorTests = []struct {
+	t       string
+	content string
+	line    int
+}{
+	{"bad latitude", "\"A\",\"A\",FR,45AB.000N,00600.000E,300m,1,,,,\"\"", 1},
+	{"bad elevation", "\"A\",\"A\",FR,4500.000N,00600.000E,abcm,1,,,,\"\"", 1},
+	{"bad style", "\"A\",\"A\",FR,4500.000N,00600.000E,300m,X,,,,\"\"", 1},
+	{"bad runway", "\"A\",\"A\",FR,4500.000N,00600.000E,300m,2,X,,,\"\"", 1},
+	{"bad frequency", "\"A\",\"A\",FR,4500.000N,00600.000E,300m,2,,,X,\"\"", 1},
+	{"options with no task", "-----Related Tasks-----\nOptions,NoStart=12:00:00", 2},
+	{"zone with no task", "-----Related Tasks-----\n\nObsZone=0,Style=1", 3},
+	{"bad zone", "-----Related Tasks-----\n\"T\",\"A\"\nObsZone=X,Style=1", 3},
+	{"unknown task record", "-----Related Tasks-----\n\"T\",\"A\"\nFoo=1", 3},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		_, err := Parse([]byte(test.content))
+		perr, ok := err.(util.ParseError)
+		if !ok {
+			t.Errorf("%v :: expected parse error got %v", test.t, err)
+			continue
+		}
+		if perr.Line != test.line {
+			t.Errorf("%v :: expected error in line %v got %v", test.t, test.line, perr)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	f, err := Parse([]byte(testCup))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, f); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	expected := strings.Join([]string{
+		"name,code,country,lat,lon,elev,style,rwdir,rwlen,freq,desc",
+		`"Annecy Meythet","LFLP",FR,4555.783N,00606.383E,463m,5,040,1700m,"120.075",""`,
+		`"Challes","LFLE",FR,4533.650N,00558.617E,296m,4,180,620m,"122.500",""`,
+		`"Chambery Sud","Chambery Sud",FR,4530.000N,00600.000E,305m,3,,300m,,""`,
+		`"Col du Galibier","GALIBIER",FR,4503.833N,00624.483E,2642m,6,,,,"Mountain pass"`,
+		`"Mont Blanc","MTBLANC",FR,4549.950N,00651.867E,4808m,7,,,,""`,
+		`"Bridge","BRIDGE",IT,4500.000N,00700.000E,300m,1,,,,""`,
+		"-----Related Tasks-----",
+		`"Savoy","Challes","Annecy Meythet","Col du Galibier","Challes"`,
+		"Options,NoStart=12:00:00,TaskTime=03:00:00",
+		"ObsZone=0,A1=180,Line=1,R1=5000m,Style=2",
+		"ObsZone=1,A1=45,R1=500m,Style=1",
+		"",
+	}, "\r\n")
+	if buf.String() != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, buf.String())
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written content :: %v", err)
+	}
+	if !reflect.DeepEqual(result.Waypoints, f.Waypoints) || !reflect.DeepEqual(result.Tasks, f.Tasks) {
+		t.Errorf("round trip failed :: expected %+v got %+v", f, result)
+	}
+}
+
+var styleTests = []struct {
+	style int
+	flags int
+}{
+	{6, waypoint.MountainPass},
+	{7, waypoint.MountainTop},
+	{8, waypoint.Mast},
+	{9, waypoint.VOR},
+	{10, waypoint.NDB},
+	{11, waypoint.CoolingTower},
+	{12, waypoint.Dam},
+	{13, waypoint.Tunnel},
+	{14, waypoint.Bridge},
+	{15, waypoint.PowerPlant},
+	{16, waypoint.Castle},
+	{17, waypoint.Intersection},
+}
+
+func TestWaypointStyle(t *testing.T) {
+	for _, test := range styleTests {
+		if r := styleToWaypoint(test.style); r != test.flags {
+			t.Errorf("style %v :: expected flags %v got %v", test.style, test.flags, r)
+		}
+		if r := waypointToStyle(test.flags); r != test.style {
+			t.Errorf("flags %v :: expected style %v got %v", test.flags, test.style, r)
+		}
+	}
+	if r := styleToWaypoint(18); r != 0 {
+		t.Errorf("expected no flags for unknown style got %v", r)
+	}
+}
+
+var runwayTests = []struct {
+	heading int
+	runway  string
+}{
+	{0, "1836"},
+	{40, "0422"},
+	{90, "0927"},
+	{180, "1836"},
+	{275, "1028"},
+	{355, "1836"},
+}
+
+func TestRunway(t *testing.T) {
+	for _, test := range runwayTests {
+		if r := runway(test.heading); r != test.runway {
+			t.Errorf("heading %v :: expected %v got %v", test.heading, test.runway, r)
+		}
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cup")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir :: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	c, _ := New(Config{File: filepath.Join(dir, "test.cup")})
+
+	waypoints := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "W1", Name: "W1", Region: "FR", Elevation: 300, Latitude: 45.5, Longitude: 6.5},
+		waypoint.Waypoint{ID: "W2", Name: "W2", Region: "CH", Flags: waypoint.Dam, Latitude: 46.5, Longitude: 7.5},
+	}
+	airfields := []airfield.Airfield{
+		airfield.Airfield{ID: "A1", ShortName: "A1", Name: "A1", Region: "FR", Flags: airfield.Grass,
+			Runway: "0927", Length: 800, Latitude: 45, Longitude: 6},
+	}
+	if err := c.PutWaypoint(waypoints); err != nil {
+		t.Fatalf("failed to put waypoints :: %v", err)
+	}
+	if err := c.PutAirfield(airfields); err != nil {
+		t.Fatalf("failed to put airfields :: %v", err)
+	}
+	w, err := c.GetWaypoint([]string{}, time.Time{})
+	if err != nil || !reflect.DeepEqual(w, waypoints) {
+		t.Errorf("expected %+v got %+v :: %v", waypoints, w, err)
+	}
+	w, err = c.GetWaypoint([]string{"CH"}, time.Time{})
+	if err != nil || !reflect.DeepEqual(w, waypoints[1:]) {
+		t.Errorf("expected %+v got %+v :: %v", waypoints[1:], w, err)
+	}
+	a, err := c.GetAirfield([]string{""}, time.Time{})
+	if err != nil || !reflect.DeepEqual(a, airfields) {
+		t.Errorf("expected %+v got %+v :: %v", airfields, a, err)
+	}
+	a, err = c.GetAirfield([]string{"CH"}, time.Time{})
+	if err != nil || len(a) != 0 {
+		t.Errorf("expected no airfields got %+v :: %v", a, err)
+	}
+}
+
+func TestPluginMissingFile(t *testing.T) {
+	c, _ := New(Config{File: "/nonexistent/test.cup"})
+	if _, err := c.GetWaypoint([]string{}, time.Time{}); err == nil {
+		t.Errorf("expected error reading missing file")
+	}
+}
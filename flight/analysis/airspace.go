@@ -0,0 +1,250 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/flight"
+	"github.com/rochaporto/ezgliding/spatial"
+)
+
+// AirspaceConfig holds the parameters used when checking a flight against
+// airspace.
+type AirspaceConfig struct {
+	// Classes restricts the check to the given airspace classes (all
+	// classes if empty).
+	Classes []byte
+	// QNH (hPa) used to convert pressure altitudes and flight levels
+	// (standard pressure if zero).
+	QNH float64
+	// Terrain returns the ground elevation (meters) at the given point,
+	// used for AGL and SFC limits. The takeoff altitude is used if nil.
+	Terrain func(lat float64, lon float64) float64
+	// NearMissDistance is the horizontal distance (meters) under which a
+	// close approach to an airspace is reported.
+	NearMissDistance float64
+	// NearMissHeight is the vertical distance (meters) under which a
+	// close approach to an airspace is reported.
+	NearMissHeight float64
+	// ArcResolution is passed to spatial.AirspacePolygon.
+	ArcResolution float64
+}
+
+// DefaultAirspaceConfig reports near misses closer than 500m horizontally
+// or 100m vertically, using standard pressure.
+var DefaultAirspaceConfig = AirspaceConfig{
+	NearMissDistance: 500,
+	NearMissHeight:   100,
+}
+
+// Infringement is a penetration of an airspace, from the first (Entry) to
+// the last (Exit) fix inside it.
+//
+// LateralDepth is the max distance (meters) to the airspace boundary, and
+// VerticalDepth the max distance (meters) to the floor or ceiling, while
+// inside the airspace.
+type Infringement struct {
+	Name          string
+	Class         byte
+	Entry         time.Time
+	Exit          time.Time
+	EntryIndex    int
+	ExitIndex     int
+	LateralDepth  float64
+	VerticalDepth float64
+}
+
+// NearMiss is the closest approach to an airspace which was not entered.
+//
+// Distance is the horizontal distance (meters) to the airspace boundary,
+// zero if the fix was below or above the airspace. Height is the vertical
+// distance (meters) to the floor or ceiling, zero if the fix was at the
+// airspace levels.
+type NearMiss struct {
+	Name     string
+	Class    byte
+	Time     time.Time
+	Index    int
+	Distance float64
+	Height   float64
+}
+
+// AirspaceResult holds the result of checking a flight against airspace,
+// ordered by time.
+type AirspaceResult struct {
+	Infringements []Infringement
+	NearMisses    []NearMiss
+}
+
+// CheckAirspace checks the given flight (from takeoff to landing) against
+// the given airspaces, reporting every penetration and near miss.
+// Airspaces which can't be resolved into a polygon are skipped, and
+// limits which could not be parsed are taken as the ground (floor) or
+// unlimited (ceiling).
+//
+// Pressure or GNSS altitude is used as set in cfg.
+func CheckAirspace(f flight.Flight, airspaces []airspace.Airspace, cfg Config, acfg AirspaceConfig) (AirspaceResult, error) {
+	result := AirspaceResult{Infringements: []Infringement{}, NearMisses: []NearMiss{}}
+	a, err := Analyse(f, cfg)
+	if err != nil {
+		return result, err
+	}
+	pts := f.Points[a.TakeoffIndex : a.LandingIndex+1]
+
+	// altitudes converted to meters AMSL, and the track bounds
+	alts := make([]float64, len(pts))
+	track := []airspace.Point{}
+	for i, pt := range pts {
+		alts[i] = altitudeAMSL(pt, cfg, acfg)
+		track = append(track, airspace.Point{Latitude: pt.Latitude, Longitude: pt.Longitude})
+	}
+	trackBounds := spatial.PolygonBounds(track)
+	terrain := func(pt flight.Point) float64 {
+		if acfg.Terrain != nil {
+			return acfg.Terrain(pt.Latitude, pt.Longitude)
+		}
+		return alts[0]
+	}
+
+	for _, as := range airspaces {
+		if !checkClass(as.Class, acfg.Classes) {
+			continue
+		}
+		polygon, err := spatial.AirspacePolygon(as, acfg.ArcResolution)
+		if err != nil {
+			glog.Warningf("skipping airspace %v :: %v", as.Name, err)
+			continue
+		}
+		bounds := expandBounds(spatial.PolygonBounds(polygon), acfg.NearMissDistance)
+		if !bounds.Intersects(trackBounds) {
+			continue
+		}
+		var current *Infringement
+		var miss *NearMiss
+		missRatio := math.Inf(1)
+		infringed := false
+		for i, pt := range pts {
+			if !bounds.Contains(pt.Latitude, pt.Longitude) {
+				current = nil
+				continue
+			}
+			ground := terrain(pt)
+			floor, ceiling := as.Limits(acfg.QNH, ground)
+			lateral := spatial.PointInPolygon(pt.Latitude, pt.Longitude, polygon)
+			vertical := alts[i] >= floor && alts[i] <= ceiling
+			var distance float64
+			if lateral || vertical {
+				distance = spatial.DistanceToPolygon(pt.Latitude, pt.Longitude, polygon)
+			}
+			height := math.Min(alts[i]-floor, ceiling-alts[i])
+
+			if lateral && vertical {
+				if current == nil {
+					infringed = true
+					result.Infringements = append(result.Infringements, Infringement{
+						Name: as.Name, Class: as.Class, Entry: pt.Time, EntryIndex: a.TakeoffIndex + i,
+					})
+					current = &result.Infringements[len(result.Infringements)-1]
+				}
+				current.Exit, current.ExitIndex = pt.Time, a.TakeoffIndex+i
+				current.LateralDepth = math.Max(current.LateralDepth, distance)
+				current.VerticalDepth = math.Max(current.VerticalDepth, height)
+				continue
+			}
+			current = nil
+			if infringed {
+				continue
+			}
+			// near miss candidate, either beside or below/above the airspace
+			nm := NearMiss{Name: as.Name, Class: as.Class, Time: pt.Time, Index: a.TakeoffIndex + i}
+			var ratio float64
+			if vertical && distance < acfg.NearMissDistance {
+				nm.Distance = distance
+				ratio = distance / acfg.NearMissDistance
+			} else if lateral && -height < acfg.NearMissHeight {
+				nm.Height = -height
+				ratio = -height / acfg.NearMissHeight
+			} else {
+				continue
+			}
+			if ratio < missRatio {
+				missRatio = ratio
+				miss = &nm
+			}
+		}
+		if miss != nil && !infringed {
+			result.NearMisses = append(result.NearMisses, *miss)
+		}
+	}
+	sort.Stable(byEntry(result.Infringements))
+	sort.Stable(byIndex(result.NearMisses))
+	return result, nil
+}
+
+// byEntry sorts infringements by entry time.
+type byEntry []Infringement
+
+func (s byEntry) Len() int           { return len(s) }
+func (s byEntry) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byEntry) Less(i, j int) bool { return s[i].EntryIndex < s[j].EntryIndex }
+
+// byIndex sorts near misses by time.
+type byIndex []NearMiss
+
+func (s byIndex) Len() int           { return len(s) }
+func (s byIndex) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byIndex) Less(i, j int) bool { return s[i].Index < s[j].Index }
+
+// altitudeAMSL returns the altitude (meters AMSL) of the given point,
+// converting pressure altitudes with the configured QNH.
+func altitudeAMSL(pt flight.Point, cfg Config, acfg AirspaceConfig) float64 {
+	if cfg.GNSSAltitude || pt.PressureAltitude == 0 {
+		return float64(pt.GNSSAltitude)
+	}
+	return airspace.PressureToQNHAltitude(float64(pt.PressureAltitude), acfg.QNH)
+}
+
+// checkClass returns true if class is in classes, or classes is empty.
+func checkClass(class byte, classes []byte) bool {
+	if len(classes) == 0 {
+		return true
+	}
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// expandBounds returns the given bounds expanded by d meters.
+func expandBounds(b airspace.BoundingBox, d float64) airspace.BoundingBox {
+	dlat := d / (spatial.EarthRadius * math.Pi / 180)
+	dlon := dlat / math.Max(0.01, math.Cos(math.Max(math.Abs(b.North), math.Abs(b.South))*math.Pi/180))
+	return airspace.BoundingBox{
+		North: b.North + dlat, South: b.South - dlat,
+		East: b.East + dlon, West: b.West - dlon,
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/flight"
+	"github.com/rochaporto/ezgliding/spatial"
+)
+
+// box returns an airspace with the given lat/lon limits.
+func box(name string, class byte, south, north, west, east float64, floor, ceiling string) airspace.Airspace {
+	a := airspace.Airspace{Name: name, Class: class, Floor: floor, Ceiling: ceiling}
+	a.FloorAltitude, _ = airspace.ParseAltitude(floor)
+	a.CeilingAltitude, _ = airspace.ParseAltitude(ceiling)
+	for _, p := range [][2]float64{{south, west}, {north, west}, {north, east}, {south, east}} {
+		a.Segments = append(a.Segments, airspace.Segment{Type: airspace.Polygon,
+			Coordinate1: fmt.Sprintf("%v, %v", p[0], p[1])})
+	}
+	return a
+}
+
+// airspaceTrack flies north from 46N 6E at 25m/s, climbing from 500m at
+// 1m/s, for 10km.
+func airspaceTrack() flight.Flight {
+	return track([]segment{
+		{30, 0, 0, 0, 0},
+		{400, 25, 0, 1, 0},
+		{60, 0, 0, 0, 0},
+	})
+}
+
+var testAirspaces = []airspace.Airspace{
+	// crossed between 633m and 722m, SFC is the takeoff altitude (500m)
+	box("CTR", 'C', 46.03, 46.05, 5.99, 6.01, "SFC", "3000FT AMSL"),
+	// 0.003 degrees (230m) east of the track
+	box("CTR EAST", 'D', 46.06, 46.07, 6.003, 6.02, "SFC", "FL100"),
+	// flown under at 850m to 878m
+	box("TMA", 'R', 46.075, 46.085, 5.99, 6.01, "3000FT AMSL", "FL195"),
+	// far away
+	box("FAR", 'A', 47, 47.1, 6, 6.1, "SFC", "UNL"),
+}
+
+func TestCheckAirspace(t *testing.T) {
+	f := airspaceTrack()
+	r, err := CheckAirspace(f, testAirspaces, DefaultConfig, DefaultAirspaceConfig)
+	if err != nil {
+		t.Fatalf("failed to check airspace :: %v", err)
+	}
+	if len(r.Infringements) != 1 {
+		t.Fatalf("expected 1 infringement got %+v", r.Infringements)
+	}
+	inf := r.Infringements[0]
+	if inf.Name != "CTR" || inf.Class != 'C' {
+		t.Errorf("wrong airspace infringed :: %+v", inf)
+	}
+	entry := f.Points[inf.EntryIndex]
+	exit := f.Points[inf.ExitIndex]
+	if !near(entry.Latitude, 46.03, 0.0003) || !near(exit.Latitude, 46.05, 0.0003) ||
+		inf.Entry != entry.Time || inf.Exit != exit.Time {
+		t.Errorf("wrong entry or exit :: %+v", inf)
+	}
+	// half width of the airspace, and half way between the floor and ceiling
+	if !near(inf.LateralDepth, spatial.Distance(46.04, 6, 46.04, 6.01), 5) {
+		t.Errorf("wrong lateral depth :: %v", inf.LateralDepth)
+	}
+	if !near(inf.VerticalDepth, (914.4-500)/2, 2) {
+		t.Errorf("wrong vertical depth :: %v", inf.VerticalDepth)
+	}
+
+	if len(r.NearMisses) != 2 {
+		t.Fatalf("expected 2 near misses got %+v", r.NearMisses)
+	}
+	if nm := r.NearMisses[0]; nm.Name != "CTR EAST" || !near(nm.Distance, 231, 2) || nm.Height != 0 {
+		t.Errorf("wrong lateral near miss :: %+v", nm)
+	}
+	if nm := r.NearMisses[1]; nm.Name != "TMA" || !near(nm.Height, 914.4-878, 2) || nm.Distance != 0 {
+		t.Errorf("wrong vertical near miss :: %+v", nm)
+	}
+}
+
+func TestCheckAirspaceGNSS(t *testing.T) {
+	// gnss altitude is 50m higher, going into the TMA
+	cfg := DefaultConfig
+	cfg.GNSSAltitude = true
+	r, err := CheckAirspace(airspaceTrack(), testAirspaces, cfg, DefaultAirspaceConfig)
+	if err != nil {
+		t.Fatalf("failed to check airspace :: %v", err)
+	}
+	if len(r.Infringements) != 2 || r.Infringements[1].Name != "TMA" {
+		t.Errorf("expected TMA infringement got %+v", r.Infringements)
+	}
+	if len(r.NearMisses) != 1 || r.NearMisses[0].Name != "CTR EAST" {
+		t.Errorf("expected one near miss got %+v", r.NearMisses)
+	}
+}
+
+func TestCheckAirspaceQNH(t *testing.T) {
+	// high pressure puts the pressure altitudes ~140m higher
+	acfg := DefaultAirspaceConfig
+	acfg.QNH = 1030
+	r, err := CheckAirspace(airspaceTrack(), testAirspaces, DefaultConfig, acfg)
+	if err != nil {
+		t.Fatalf("failed to check airspace :: %v", err)
+	}
+	if len(r.Infringements) != 2 || r.Infringements[1].Name != "TMA" {
+		t.Errorf("expected TMA infringement got %+v", r.Infringements)
+	}
+}
+
+func TestCheckAirspaceClasses(t *testing.T) {
+	acfg := DefaultAirspaceConfig
+	acfg.Classes = []byte{'D'}
+	r, err := CheckAirspace(airspaceTrack(), testAirspaces, DefaultConfig, acfg)
+	if err != nil {
+		t.Fatalf("failed to check airspace :: %v", err)
+	}
+	if len(r.Infringements) != 0 || len(r.NearMisses) != 1 || r.NearMisses[0].Class != 'D' {
+		t.Errorf("expected only class D results got %+v", r)
+	}
+}
+
+func TestCheckAirspaceTerrain(t *testing.T) {
+	// with the ground at 700m the CTR is only entered above it
+	acfg := DefaultAirspaceConfig
+	acfg.Terrain = func(lat float64, lon float64) float64 { return 700 }
+	r, err := CheckAirspace(airspaceTrack(), testAirspaces[:1], DefaultConfig, acfg)
+	if err != nil {
+		t.Fatalf("failed to check airspace :: %v", err)
+	}
+	if len(r.Infringements) != 1 || !near(r.Infringements[0].Entry.Sub(airspaceTrack().Points[0].Time).Seconds(), 230, 2) {
+		t.Errorf("expected infringement above 700m got %+v", r.Infringements)
+	}
+}
+
+func TestCheckAirspaceUnknownLimits(t *testing.T) {
+	// the CTR with limits which can't be parsed is still entered
+	unknown := []airspace.Airspace{box("CTR", 'C', 46.03, 46.05, 5.99, 6.01, "ask ATC", "FL 95 (ask ATC)")}
+	if unknown[0].FloorAltitude.Reference != airspace.Unknown || unknown[0].CeilingAltitude.Reference != airspace.Unknown {
+		t.Fatalf("expected unknown limits got %+v", unknown[0])
+	}
+	r, err := CheckAirspace(airspaceTrack(), unknown, DefaultConfig, DefaultAirspaceConfig)
+	if err != nil {
+		t.Fatalf("failed to check airspace :: %v", err)
+	}
+	if len(r.Infringements) != 1 || r.Infringements[0].Name != "CTR" {
+		t.Errorf("expected CTR infringement got %+v", r.Infringements)
+	}
+}
+
+func TestCheckAirspaceError(t *testing.T) {
+	if _, err := CheckAirspace(flight.NewFlight(), testAirspaces, DefaultConfig, DefaultAirspaceConfig); err == nil {
+		t.Errorf("expected error for flight with no points")
+	}
+	bad := append([]airspace.Airspace{{Name: "bad", Segments: []airspace.Segment{{Type: airspace.Circle}}}}, testAirspaces...)
+	r, err := CheckAirspace(airspaceTrack(), bad, DefaultConfig, DefaultAirspaceConfig)
+	if err != nil {
+		t.Errorf("expected invalid airspace to be skipped got %v", err)
+	}
+	if len(r.Infringements) != 1 || len(r.NearMisses) != 2 {
+		t.Errorf("expected the valid airspaces to be checked got %+v", r)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package analysis provides flight analysis functionality.
+//
+// This includes detection of takeoff and landing, the segmentation of the
+// flight track in circling (thermalling) and gliding phases, and distance
+// optimization (free distance, triangles, out and return).
+package analysis
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rochaporto/ezgliding/flight"
+	"github.com/rochaporto/ezgliding/spatial"
+)
+
+// Config holds the parameters used when analysing a flight.
+type Config struct {
+	// TakeoffSpeed is the ground speed (m/s) above which the glider is
+	// considered to be flying.
+	TakeoffSpeed float64
+	// SpeedWindow is the time over which the ground speed is averaged
+	// when detecting takeoff and landing.
+	SpeedWindow time.Duration
+	// MinTurnRate is the turn rate (degrees/s) above which the glider is
+	// considered to be turning.
+	MinTurnRate float64
+	// CirclingEnter is how long the glider must keep turning in the same
+	// direction for a circling phase to start.
+	CirclingEnter time.Duration
+	// CirclingExit is how long the glider must fly straight for a
+	// circling phase to end.
+	CirclingExit time.Duration
+	// VarioWindow is the time over which the climb rate is averaged when
+	// looking for the peak climb in a thermal.
+	VarioWindow time.Duration
+	// GNSSAltitude selects GNSS altitude instead of pressure altitude.
+	GNSSAltitude bool
+	// OptimizePoints is the number of fixes the track is reduced to when
+	// optimizing distances, before refining on the full track.
+	OptimizePoints int
+	// ClosingRatio is the max distance between start and finish for closed
+	// courses (triangles, out and return), as a ratio of the course distance.
+	ClosingRatio float64
+}
+
+// DefaultConfig holds the default analysis parameters.
+var DefaultConfig = Config{
+	TakeoffSpeed:  10,
+	SpeedWindow:   10 * time.Second,
+	MinTurnRate:   4,
+	CirclingEnter: 15 * time.Second,
+	CirclingExit:  10 * time.Second,
+	VarioWindow:   10 * time.Second,
+
+	OptimizePoints: 400,
+	ClosingRatio:   0.2,
+}
+
+// PhaseType is one of Gliding, Circling.
+type PhaseType int
+
+const (
+	// Gliding is a straight flight phase.
+	Gliding PhaseType = iota
+	// Circling is a thermalling phase.
+	Circling
+)
+
+func (t PhaseType) String() string {
+	if t == Circling {
+		return "circling"
+	}
+	return "gliding"
+}
+
+// Phase is a segment of the flight track, either gliding or circling.
+//
+// StartIndex and EndIndex are the indexes of the Start and End fixes in
+// Flight.Points. AltitudeChange is positive for altitude gained and
+// negative for altitude lost (meters), and Distance is the straight
+// distance from Start to End (meters).
+type Phase struct {
+	Type           PhaseType
+	Start          flight.Point
+	End            flight.Point
+	StartIndex     int
+	EndIndex       int
+	Duration       time.Duration
+	AltitudeChange int64
+	Distance       float64
+}
+
+// Analysis holds the result of analysing a flight.
+type Analysis struct {
+	Takeoff      flight.Point
+	Landing      flight.Point
+	TakeoffIndex int
+	LandingIndex int
+	Phases       []Phase
+}
+
+// Analyse detects takeoff and landing in the given flight, and splits the
+// track in between in gliding and circling phases.
+//
+// Points are expected to be ordered by time.
+func Analyse(f flight.Flight, cfg Config) (Analysis, error) {
+	a := Analysis{}
+	pts := f.Points
+	if len(pts) < 2 {
+		return a, errors.New("not enough points in flight")
+	}
+	a.TakeoffIndex = -1
+	for i := range pts {
+		if groundSpeed(pts, i, cfg.SpeedWindow) > cfg.TakeoffSpeed {
+			a.TakeoffIndex = i
+			break
+		}
+	}
+	if a.TakeoffIndex == -1 {
+		return a, errors.New("no takeoff detected")
+	}
+	a.LandingIndex = len(pts) - 1
+	for i := len(pts) - 1; i > a.TakeoffIndex; i-- {
+		if groundSpeed(pts, i, -cfg.SpeedWindow) > cfg.TakeoffSpeed {
+			a.LandingIndex = i
+			break
+		}
+	}
+	a.Takeoff = pts[a.TakeoffIndex]
+	a.Landing = pts[a.LandingIndex]
+	a.Phases = phases(pts[:a.LandingIndex+1], a.TakeoffIndex, cfg)
+	return a, nil
+}
+
+// phases splits pts starting at index start in gliding and circling phases.
+func phases(pts []flight.Point, start int, cfg Config) []Phase {
+	result := []Phase{}
+	state := Gliding
+	phaseStart, candidate := start, -1
+	var direction float64
+	for i := start + 1; i < len(pts); i++ {
+		rate := turnRate(pts, i)
+		turning := math.Abs(rate) >= cfg.MinTurnRate
+		if state == Gliding && turning && candidate != -1 && rate*direction < 0 {
+			// changed turn direction, not circling
+			candidate = -1
+		}
+		if turning == (state == Circling) {
+			candidate = -1
+			continue
+		}
+		if candidate == -1 {
+			candidate, direction = i-1, rate
+		}
+		needed := cfg.CirclingEnter
+		if state == Circling {
+			needed = cfg.CirclingExit
+		}
+		if pts[i].Time.Sub(pts[candidate].Time) >= needed {
+			if candidate > phaseStart {
+				result = append(result, newPhase(state, pts, phaseStart, candidate, cfg))
+			}
+			state, phaseStart, candidate = 1-state, candidate, -1
+		}
+	}
+	if len(pts)-1 > phaseStart {
+		result = append(result, newPhase(state, pts, phaseStart, len(pts)-1, cfg))
+	}
+	return result
+}
+
+func newPhase(t PhaseType, pts []flight.Point, start int, end int, cfg Config) Phase {
+	return Phase{
+		Type: t, Start: pts[start], End: pts[end],
+		StartIndex: start, EndIndex: end,
+		Duration:       pts[end].Time.Sub(pts[start].Time),
+		AltitudeChange: Altitude(pts[end], cfg) - Altitude(pts[start], cfg),
+		Distance:       distance(pts[start], pts[end]),
+	}
+}
+
+// Altitude returns the altitude of pt, pressure or GNSS as given in cfg.
+// If the pressure altitude is not available GNSS altitude is used.
+func Altitude(pt flight.Point, cfg Config) int64 {
+	if cfg.GNSSAltitude || pt.PressureAltitude == 0 {
+		return pt.GNSSAltitude
+	}
+	return pt.PressureAltitude
+}
+
+// groundSpeed returns the average speed (m/s) from pts[i] over the given
+// window. A negative window looks at the points before pts[i].
+func groundSpeed(pts []flight.Point, i int, window time.Duration) float64 {
+	step := 1
+	if window < 0 {
+		step, window = -1, -window
+	}
+	for j := i + step; j >= 0 && j < len(pts); j = j + step {
+		dt := pts[j].Time.Sub(pts[i].Time)
+		if dt < 0 {
+			dt = -dt
+		}
+		if dt >= window {
+			return distance(pts[i], pts[j]) / dt.Seconds()
+		}
+	}
+	return 0
+}
+
+// turnRate returns the turn rate (degrees/s) at pts[i], positive to the
+// right. It is zero if the track direction is undefined.
+func turnRate(pts []flight.Point, i int) float64 {
+	dt := pts[i].Time.Sub(pts[i-1].Time).Seconds()
+	if dt <= 0 {
+		return 0
+	}
+	return turn(pts, i) / dt
+}
+
+// turn returns the change in track direction (degrees) at pts[i], positive
+// to the right. It is zero if the track direction is undefined.
+func turn(pts []flight.Point, i int) float64 {
+	if i < 2 || distance(pts[i-2], pts[i-1]) < 1 || distance(pts[i-1], pts[i]) < 1 {
+		return 0
+	}
+	delta := bearing(pts[i-1], pts[i]) - bearing(pts[i-2], pts[i-1])
+	for delta > 180 {
+		delta -= 360
+	}
+	for delta < -180 {
+		delta += 360
+	}
+	return delta
+}
+
+// distance returns the great circle distance (meters) between p1 and p2.
+func distance(p1 flight.Point, p2 flight.Point) float64 {
+	return spatial.Distance(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
+}
+
+// bearing returns the initial bearing (degrees) from p1 to p2.
+func bearing(p1 flight.Point, p2 flight.Point) float64 {
+	return spatial.InitialBearing(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rochaporto/ezgliding/flight"
+)
+
+// segment describes a part of a synthetic track, flown for duration
+// seconds at the given speed (m/s), turn rate (degrees/s) and vario (m/s),
+// with a wind drift to the east (m/s).
+type segment struct {
+	duration int
+	speed    float64
+	turn     float64
+	vario    float64
+	drift    float64
+}
+
+// track returns a flight with one fix per second following the segments.
+func track(segments []segment) flight.Flight {
+	f := flight.NewFlight()
+	t := time.Date(2015, 7, 1, 12, 0, 0, 0, time.UTC)
+	lat, lon, alt, heading := 46.0, 6.0, 500.0, 0.0
+	f.Points = append(f.Points, fix(t, lat, lon, alt))
+	for _, s := range segments {
+		for i := 0; i < s.duration; i++ {
+			heading = math.Mod(heading+s.turn+360, 360)
+			lat += s.speed * math.Cos(heading*math.Pi/180) / 111195
+			lon += (s.speed*math.Sin(heading*math.Pi/180) + s.drift) / (111195 * math.Cos(lat*math.Pi/180))
+			alt += s.vario
+			t = t.Add(time.Second)
+			f.Points = append(f.Points, fix(t, lat, lon, alt))
+		}
+	}
+	return f
+}
+
+func fix(t time.Time, lat float64, lon float64, alt float64) flight.Point {
+	pt := flight.NewPoint()
+	pt.Time, pt.Latitude, pt.Longitude = t, lat, lon
+	pt.PressureAltitude = int64(alt)
+	pt.GNSSAltitude = int64(alt) + 50
+	return pt
+}
+
+// near returns true if v is within tolerance of expected.
+func near(v float64, expected float64, tolerance float64) bool {
+	return math.Abs(v-expected) <= tolerance
+}
+
+func TestAnalyse(t *testing.T) {
+	f := track([]segment{
+		{60, 0, 0, 0, 0},
+		{100, 25, 0, 1, 0},
+		{120, 20, 18, 2, 0},
+		{120, 30, 0, -1, 0},
+		{60, 30, -10, -1, 0},
+		{100, 30, 0, -1, 0},
+		{60, 0, 0, 0, 0},
+	})
+	a, err := Analyse(f, DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to analyse flight :: %v", err)
+	}
+	if !near(float64(a.TakeoffIndex), 60, 5) || a.Takeoff.Time != f.Points[a.TakeoffIndex].Time {
+		t.Errorf("wrong takeoff detected :: %v", a.TakeoffIndex)
+	}
+	if !near(float64(a.LandingIndex), 560, 10) || a.Landing.Time != f.Points[a.LandingIndex].Time {
+		t.Errorf("wrong landing detected :: %v", a.LandingIndex)
+	}
+	expected := []struct {
+		t        PhaseType
+		duration float64
+		altitude float64
+	}{
+		{Gliding, 100, 100},
+		{Circling, 120, 240},
+		{Gliding, 120, -120},
+		{Circling, 60, -60},
+		{Gliding, 100, -100},
+	}
+	if len(a.Phases) != len(expected) {
+		t.Fatalf("expected %v phases but got %v :: %+v", len(expected), len(a.Phases), a.Phases)
+	}
+	for i, e := range expected {
+		p := a.Phases[i]
+		if p.Type != e.t || !near(p.Duration.Seconds(), e.duration, 15) ||
+			!near(float64(p.AltitudeChange), e.altitude, 15) {
+			t.Errorf("phase %v: expected %v %vs %vm but got %v %v %vm",
+				i, e.t, e.duration, e.altitude, p.Type, p.Duration, p.AltitudeChange)
+		}
+		if i > 0 && p.StartIndex != a.Phases[i-1].EndIndex {
+			t.Errorf("phase %v does not start where previous ended", i)
+		}
+	}
+	if a.Phases[0].StartIndex != a.TakeoffIndex || a.Phases[len(a.Phases)-1].EndIndex != a.LandingIndex {
+		t.Errorf("phases do not cover the flight")
+	}
+}
+
+func TestAnalyseSTurns(t *testing.T) {
+	segments := []segment{{10, 0, 0, 0, 0}}
+	for i := 0; i < 10; i++ {
+		segments = append(segments, segment{12, 25, 10, 0, 0}, segment{12, 25, -10, 0, 0})
+	}
+	a, err := Analyse(track(segments), DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to analyse flight :: %v", err)
+	}
+	if len(a.Phases) != 1 || a.Phases[0].Type != Gliding {
+		t.Errorf("expected a single gliding phase but got %+v", a.Phases)
+	}
+}
+
+func TestAnalyseErrors(t *testing.T) {
+	if _, err := Analyse(track([]segment{}), DefaultConfig); err == nil {
+		t.Errorf("expected error for flight with no points")
+	}
+	if _, err := Analyse(track([]segment{{100, 1, 0, 0, 0}}), DefaultConfig); err == nil {
+		t.Errorf("expected error for flight with no takeoff")
+	}
+}
+
+func TestAltitude(t *testing.T) {
+	pt := flight.Point{PressureAltitude: 100, GNSSAltitude: 200}
+	if Altitude(pt, DefaultConfig) != 100 {
+		t.Errorf("expected pressure altitude")
+	}
+	if Altitude(pt, Config{GNSSAltitude: true}) != 200 {
+		t.Errorf("expected gnss altitude")
+	}
+	if Altitude(flight.Point{GNSSAltitude: 200}, DefaultConfig) != 200 {
+		t.Errorf("expected gnss altitude with missing pressure altitude")
+	}
+}
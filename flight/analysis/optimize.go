@@ -0,0 +1,336 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"errors"
+	"math"
+
+	"github.com/rochaporto/ezgliding/flight"
+)
+
+// faiRatio is the min length of each leg of a FAI triangle, as a ratio
+// of the triangle distance.
+const faiRatio = 0.28
+
+// Score is the best distance (meters) found for a given course type, and
+// the fixes defining it.
+//
+// For free distance Points holds the start, turnpoints and finish. For
+// closed courses it holds the start, the turnpoints and the finish, and
+// Distance has the closing distance (start to finish) already subtracted.
+type Score struct {
+	Distance float64
+	Points   []flight.Point
+}
+
+// Scores holds the optimized distances of a flight.
+//
+// Free3 and Free5 are the free distances through up to 3 and 5
+// turnpoints. FAITriangle is the best triangle with all legs at least 28%
+// of the total, FlatTriangle the best triangle of any shape.
+type Scores struct {
+	Free3        Score
+	Free5        Score
+	FAITriangle  Score
+	FlatTriangle Score
+	OutAndReturn Score
+}
+
+// Optimize returns the best distances for the given flight.
+//
+// The search is done on a reduced track (see Config.OptimizePoints), and
+// the resulting fixes are then refined on the full track. Fixes with a V
+// (invalid) fix validity are ignored.
+func Optimize(f flight.Flight, cfg Config) (Scores, error) {
+	pts := []flight.Point{}
+	for _, pt := range f.Points {
+		if pt.FixValidity != 'V' {
+			pts = append(pts, pt)
+		}
+	}
+	if len(pts) < 2 {
+		return Scores{}, errors.New("not enough points in flight")
+	}
+	o := newOptimizer(pts, cfg)
+	return Scores{
+		Free3:        o.score(o.free(4), o.freeDistance),
+		Free5:        o.score(o.free(6), o.freeDistance),
+		FAITriangle:  o.score(o.triangle(true), o.triangleDistance(true)),
+		FlatTriangle: o.score(o.triangle(false), o.triangleDistance(false)),
+		OutAndReturn: o.score(o.outAndReturn(), o.outAndReturnDistance),
+	}, nil
+}
+
+// objective returns the distance for the given solution (indexes in the
+// full track), and false if the solution is not valid.
+type objective func(sol []int) (float64, bool)
+
+// optimizer holds the full and reduced tracks used during optimization.
+type optimizer struct {
+	pts    []flight.Point
+	idx    []int
+	d      [][]float64
+	stride int
+	cfg    Config
+}
+
+func newOptimizer(pts []flight.Point, cfg Config) *optimizer {
+	n := cfg.OptimizePoints
+	if n < 2 {
+		n = 2
+	}
+	o := &optimizer{pts: pts, stride: (len(pts) + n - 1) / n, cfg: cfg}
+	for i := 0; i < len(pts); i += o.stride {
+		o.idx = append(o.idx, i)
+	}
+	if o.idx[len(o.idx)-1] != len(pts)-1 {
+		o.idx = append(o.idx, len(pts)-1)
+	}
+	o.d = make([][]float64, len(o.idx))
+	for i := range o.idx {
+		o.d[i] = make([]float64, len(o.idx))
+		for j := 0; j < i; j++ {
+			o.d[i][j] = distance(pts[o.idx[i]], pts[o.idx[j]])
+			o.d[j][i] = o.d[i][j]
+		}
+	}
+	return o
+}
+
+// dist returns the distance between fixes i and j of the full track.
+func (o *optimizer) dist(i int, j int) float64 {
+	return distance(o.pts[i], o.pts[j])
+}
+
+// full converts a solution in the reduced track to the full track.
+func (o *optimizer) full(sol []int) []int {
+	if sol == nil {
+		return nil
+	}
+	result := make([]int, len(sol))
+	for i, s := range sol {
+		result[i] = o.idx[s]
+	}
+	return result
+}
+
+// score refines the given solution and returns the resulting Score.
+func (o *optimizer) score(sol []int, obj objective) Score {
+	if sol == nil {
+		return Score{}
+	}
+	sol = o.refine(sol, obj)
+	d, _ := obj(sol)
+	s := Score{Distance: d}
+	for _, i := range sol {
+		s.Points = append(s.Points, o.pts[i])
+	}
+	return s
+}
+
+// refine improves the given solution by moving each of its fixes (one at a
+// time) around its position in the full track, up to the reduction stride.
+func (o *optimizer) refine(sol []int, obj objective) []int {
+	best, _ := obj(sol)
+	for pass, improved := 0, true; improved && pass < 10; pass++ {
+		improved = false
+		for k := range sol {
+			lo, hi := sol[k]-o.stride, sol[k]+o.stride
+			if k > 0 && lo < sol[k-1] {
+				lo = sol[k-1]
+			}
+			if k < len(sol)-1 && hi > sol[k+1] {
+				hi = sol[k+1]
+			}
+			lo, hi = int(math.Max(float64(lo), 0)), int(math.Min(float64(hi), float64(len(o.pts)-1)))
+			current := sol[k]
+			for x := lo; x <= hi; x++ {
+				sol[k] = x
+				if d, ok := obj(sol); ok && d > best {
+					best, current, improved = d, x, true
+				}
+			}
+			sol[k] = current
+		}
+	}
+	return sol
+}
+
+// free returns the best free distance with the given number of legs.
+func (o *optimizer) free(legs int) []int {
+	n := len(o.idx)
+	if n <= legs {
+		legs = n - 1
+	}
+	// best[l][i] is the best distance with l legs ending at i
+	best := make([][]float64, legs+1)
+	prev := make([][]int, legs+1)
+	for l := range best {
+		best[l] = make([]float64, n)
+		prev[l] = make([]int, n)
+	}
+	for l := 1; l <= legs; l++ {
+		for i := 0; i < n; i++ {
+			best[l][i] = -1
+			for m := l - 1; m < i; m++ {
+				if best[l-1][m] < 0 {
+					continue
+				}
+				if d := best[l-1][m] + o.d[m][i]; d > best[l][i] {
+					best[l][i], prev[l][i] = d, m
+				}
+			}
+		}
+	}
+	end := 0
+	for i := range best[legs] {
+		if best[legs][i] > best[legs][end] {
+			end = i
+		}
+	}
+	sol := make([]int, legs+1)
+	sol[legs] = end
+	for l := legs; l > 0; l-- {
+		sol[l-1] = prev[l][sol[l]]
+	}
+	return o.full(sol)
+}
+
+func (o *optimizer) freeDistance(sol []int) (float64, bool) {
+	var d float64
+	for i := 1; i < len(sol); i++ {
+		if sol[i] < sol[i-1] {
+			return 0, false
+		}
+		d += o.dist(sol[i-1], sol[i])
+	}
+	return d, true
+}
+
+// closing returns, for each pair a<=c in the reduced track, the closest
+// start and finish fixes s<=a and f>=c.
+func (o *optimizer) closing() ([][]int, [][]int) {
+	n := len(o.idx)
+	start := make([][]int, n)
+	finish := make([][]int, n)
+	for s := 0; s < n; s++ {
+		// finish[s][c] is the closest f>=c to s
+		finish[s] = make([]int, n)
+		finish[s][n-1] = n - 1
+		for c := n - 2; c >= s; c-- {
+			finish[s][c] = c
+			if o.d[s][finish[s][c+1]] < o.d[s][c] {
+				finish[s][c] = finish[s][c+1]
+			}
+		}
+	}
+	for a := 0; a < n; a++ {
+		// start[a][c] is the s<=a for which finish[s][c] is closest
+		start[a] = make([]int, n)
+		for c := a; c < n; c++ {
+			start[a][c] = a
+			if a > 0 {
+				s := start[a-1][c]
+				if o.d[s][finish[s][c]] < o.d[a][finish[a][c]] {
+					start[a][c] = s
+				}
+			}
+		}
+	}
+	return start, finish
+}
+
+// triangle returns the best triangle as start, three turnpoints and
+// finish. If fai is true only FAI triangles are considered.
+func (o *optimizer) triangle(fai bool) []int {
+	n := len(o.idx)
+	start, finish := o.closing()
+	var best float64
+	var sol []int
+	for a := 0; a < n; a++ {
+		for c := a + 2; c < n; c++ {
+			s := start[a][c]
+			f := finish[s][c]
+			gap := o.d[s][f]
+			for b := a + 1; b < c; b++ {
+				d1, d2, d3 := o.d[a][b], o.d[b][c], o.d[c][a]
+				p := d1 + d2 + d3
+				if p-gap <= best || gap > o.cfg.ClosingRatio*p {
+					continue
+				}
+				if fai && math.Min(d1, math.Min(d2, d3)) < faiRatio*p {
+					continue
+				}
+				best, sol = p-gap, []int{s, a, b, c, f}
+			}
+		}
+	}
+	return o.full(sol)
+}
+
+func (o *optimizer) triangleDistance(fai bool) objective {
+	return func(sol []int) (float64, bool) {
+		for i := 1; i < len(sol); i++ {
+			if sol[i] < sol[i-1] {
+				return 0, false
+			}
+		}
+		d1, d2, d3 := o.dist(sol[1], sol[2]), o.dist(sol[2], sol[3]), o.dist(sol[3], sol[1])
+		p, gap := d1+d2+d3, o.dist(sol[0], sol[4])
+		if gap > o.cfg.ClosingRatio*p {
+			return 0, false
+		}
+		if fai && math.Min(d1, math.Min(d2, d3)) < faiRatio*p {
+			return 0, false
+		}
+		return p - gap, true
+	}
+}
+
+// outAndReturn returns the best out and return as start, turnpoint and
+// finish.
+func (o *optimizer) outAndReturn() []int {
+	n := len(o.idx)
+	_, finish := o.closing()
+	var best float64
+	var sol []int
+	for s := 0; s < n; s++ {
+		for t := s + 1; t < n; t++ {
+			f := finish[s][t]
+			d, gap := 2*o.d[s][t], o.d[s][f]
+			if d-gap > best && gap <= o.cfg.ClosingRatio*d {
+				best, sol = d-gap, []int{s, t, f}
+			}
+		}
+	}
+	return o.full(sol)
+}
+
+func (o *optimizer) outAndReturnDistance(sol []int) (float64, bool) {
+	if sol[1] < sol[0] || sol[2] < sol[1] {
+		return 0, false
+	}
+	d, gap := 2*o.dist(sol[0], sol[1]), o.dist(sol[0], sol[2])
+	if gap > o.cfg.ClosingRatio*d {
+		return 0, false
+	}
+	return d - gap, true
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+// triangleTrack is an equilateral (FAI) triangle with 100km legs.
+var triangleTrack = []segment{
+	{10, 0, 0, 0, 0},
+	{3333, 30, 0, 0, 0},
+	{1, 30, 120, 0, 0},
+	{3333, 30, 0, 0, 0},
+	{1, 30, 120, 0, 0},
+	{3333, 30, 0, 0, 0},
+	{10, 0, 0, 0, 0},
+}
+
+// outAndReturnTrack goes 100km north and back.
+var outAndReturnTrack = []segment{
+	{10, 0, 0, 0, 0},
+	{3333, 30, 0, 0, 0},
+	{1, 30, 180, 0, 0},
+	{3333, 30, 0, 0, 0},
+	{10, 0, 0, 0, 0},
+}
+
+// flatTriangleTrack is a triangle with legs of 100km, 50km and 86.6km.
+var flatTriangleTrack = []segment{
+	{10, 0, 0, 0, 0},
+	{3333, 30, 0, 0, 0},
+	{1, 30, 120, 0, 0},
+	{1666, 30, 0, 0, 0},
+	{1, 30, 90, 0, 0},
+	{2886, 30, 0, 0, 0},
+	{10, 0, 0, 0, 0},
+}
+
+type OptimizeTest struct {
+	t string
+	s []segment
+	r map[string]float64
+}
+
+var optimizeTests = []OptimizeTest{
+	{
+		"fai triangle", triangleTrack,
+		map[string]float64{"free3": 300, "free5": 300, "fai": 300, "flat": 300, "oar": 200},
+	},
+	{
+		"out and return", outAndReturnTrack,
+		map[string]float64{"free3": 200, "free5": 200, "fai": 0, "flat": 200, "oar": 200},
+	},
+	{
+		"flat triangle", flatTriangleTrack,
+		map[string]float64{"free3": 236.6, "free5": 236.6, "flat": 236.6, "oar": 200},
+	},
+}
+
+func TestOptimize(t *testing.T) {
+	for _, test := range optimizeTests {
+		scores, err := Optimize(track(test.s), DefaultConfig)
+		if err != nil {
+			t.Errorf("%v failed :: %v", test.t, err)
+			continue
+		}
+		result := map[string]Score{
+			"free3": scores.Free3, "free5": scores.Free5, "fai": scores.FAITriangle,
+			"flat": scores.FlatTriangle, "oar": scores.OutAndReturn,
+		}
+		npoints := map[string]int{"free3": 5, "free5": 7, "fai": 5, "flat": 5, "oar": 3}
+		for k, expected := range test.r {
+			s := result[k]
+			if !near(s.Distance/1000, expected, expected*0.02) {
+				t.Errorf("%v failed :: expected %v distance %vkm but got %v", test.t, k, expected, s.Distance/1000)
+			}
+			if (expected > 0 && len(s.Points) != npoints[k]) || (expected == 0 && s.Points != nil) {
+				t.Errorf("%v failed :: wrong %v points %+v", test.t, k, s.Points)
+			}
+			for i := 1; i < len(s.Points); i++ {
+				if s.Points[i].Time.Before(s.Points[i-1].Time) {
+					t.Errorf("%v failed :: %v points not ordered", test.t, k)
+				}
+			}
+		}
+	}
+}
+
+func TestOptimizeErrors(t *testing.T) {
+	if _, err := Optimize(track([]segment{}), DefaultConfig); err == nil {
+		t.Errorf("expected error for flight with no points")
+	}
+}
+
+// longTrack returns a 10 hour track at 1Hz, with thermals and glides in
+// changing directions.
+func longTrack() []segment {
+	s := []segment{{10, 0, 0, 0, 0}}
+	for i := 0; len(s) < 240; i++ {
+		s = append(s, segment{200, 20, 18, 2, 3}, segment{100, 30, float64(i%7) * 10, -1, 0})
+	}
+	return s
+}
+
+func TestOptimizeTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long optimization test in short mode")
+	}
+	f := track(longTrack())
+	start := time.Now()
+	if _, err := Optimize(f, DefaultConfig); err != nil {
+		t.Fatalf("failed to optimize :: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("optimization of %v points took %v", len(f.Points), d)
+	}
+}
+
+func BenchmarkOptimize(b *testing.B) {
+	f := track(longTrack())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Optimize(f, DefaultConfig)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rochaporto/ezgliding/flight"
+)
+
+// ZoneType is one of Line, Cylinder, FAISector, Keyhole.
+type ZoneType int
+
+const (
+	// Line is a start or finish line, perpendicular to the task leg.
+	Line ZoneType = iota
+	// Cylinder is a circle around the task point (also a finish ring).
+	Cylinder
+	// FAISector is a 90 degree sector, symmetric to the bisector of the
+	// task legs and pointing out of the course.
+	FAISector
+	// Keyhole is a FAI sector combined with a (smaller) cylinder.
+	Keyhole
+)
+
+// Zone is the observation zone of a task point.
+//
+// Radius is half the length for lines, the radius for cylinders and the
+// radius of the sector for FAI sectors and keyholes (zero for unlimited).
+// InnerRadius is the radius of the keyhole cylinder.
+type Zone struct {
+	Type        ZoneType
+	Radius      float64
+	InnerRadius float64
+}
+
+// TaskZones holds the observation zones used for each kind of task point.
+type TaskZones struct {
+	Start     Zone
+	Turnpoint Zone
+	Finish    Zone
+}
+
+// DefaultTaskZones has a 1km start line, 500m turnpoint cylinders and a
+// 1km finish line.
+var DefaultTaskZones = TaskZones{
+	Start:     Zone{Type: Line, Radius: 500},
+	Turnpoint: Zone{Type: Cylinder, Radius: 500},
+	Finish:    Zone{Type: Line, Radius: 500},
+}
+
+// TaskPointResult holds whether a task point was achieved, and when.
+// Fix is the track fix where the zone was reached or crossed.
+type TaskPointResult struct {
+	Point    flight.Point
+	Achieved bool
+	Time     time.Time
+	Fix      flight.Point
+}
+
+// TaskResult holds the result of checking a flight against a task.
+//
+// Points has the start, turnpoints and finish. Distance is the task
+// distance between the task points (meters), AchievedDistance the part of
+// it up to the last achieved point. Duration and Speed (m/s) are from
+// start to finish, and only set if the task was completed.
+type TaskResult struct {
+	Points           []TaskPointResult
+	Distance         float64
+	AchievedDistance float64
+	Completed        bool
+	Duration         time.Duration
+	Speed            float64
+}
+
+// CheckTask verifies the flight track against the given task, using the
+// given observation zones.
+//
+// The start is the last start crossing before reaching the first
+// turnpoint. Turnpoints must be reached in order, and the finish after
+// the last one.
+func CheckTask(f flight.Flight, task flight.Task, zones TaskZones) (TaskResult, error) {
+	result := TaskResult{}
+	points := append([]flight.Point{task.Start}, task.Turnpoints...)
+	points = append(points, task.Finish)
+	for i, pt := range points {
+		if pt.Latitude == 0 && pt.Longitude == 0 {
+			return result, errors.New("task point missing or invalid")
+		}
+		result.Points = append(result.Points, TaskPointResult{Point: pt})
+		if i > 0 {
+			result.Distance += distance(points[i-1], pt)
+		}
+	}
+	n := len(points)
+	z := make([]Zone, n)
+	for i := range z {
+		z[i] = zones.Turnpoint
+	}
+	z[0], z[n-1] = zones.Start, zones.Finish
+
+	next := 0
+	pts := f.Points
+	for i := 1; i < len(pts) && next < n; i++ {
+		// a new start before reaching the first turnpoint is a restart
+		if next <= 1 && reached(points, 0, z[0], pts[i-1], pts[i]) {
+			result.Points[0].Achieved, result.Points[0].Time, result.Points[0].Fix = true, pts[i].Time, pts[i]
+			next = 1
+			continue
+		}
+		if next > 0 && reached(points, next, z[next], pts[i-1], pts[i]) {
+			result.Points[next].Achieved, result.Points[next].Time, result.Points[next].Fix = true, pts[i].Time, pts[i]
+			result.AchievedDistance += distance(points[next-1], points[next])
+			next++
+		}
+	}
+	if next == n {
+		result.Completed = true
+		result.Duration = result.Points[n-1].Time.Sub(result.Points[0].Time)
+		if result.Duration > 0 {
+			result.Speed = result.Distance / result.Duration.Seconds()
+		}
+	}
+	return result, nil
+}
+
+// reached returns true if the track segment from p to q reaches the zone of
+// points[i].
+func reached(points []flight.Point, i int, z Zone, p flight.Point, q flight.Point) bool {
+	c := points[i]
+	switch z.Type {
+	case Line:
+		// oriented along the next leg for the start, the previous otherwise
+		var dir float64
+		if i == 0 {
+			dir = bearing(c, points[1])
+		} else {
+			dir = bearing(points[i-1], c)
+		}
+		along1, across1 := project(c, p, dir)
+		along2, across2 := project(c, q, dir)
+		if along1 >= 0 || along2 < 0 {
+			return false
+		}
+		across := across1 + (across2-across1)*(-along1)/(along2-along1)
+		return math.Abs(across) <= z.Radius
+	case Cylinder:
+		return distance(c, q) <= z.Radius
+	case FAISector:
+		return inSector(points, i, z.Radius, q)
+	case Keyhole:
+		return distance(c, q) <= z.InnerRadius || inSector(points, i, z.Radius, q)
+	}
+	return false
+}
+
+// inSector returns true if p is inside the FAI sector of points[i] with
+// the given radius (zero for unlimited).
+func inSector(points []flight.Point, i int, radius float64, p flight.Point) bool {
+	c := points[i]
+	if radius > 0 && distance(c, p) > radius {
+		return false
+	}
+	along, across := project(c, p, sectorBisector(points, i))
+	return along > 0 && math.Abs(across) <= along
+}
+
+// sectorBisector returns the direction (degrees) of the FAI sector of
+// points[i], pointing away from the task legs.
+func sectorBisector(points []flight.Point, i int) float64 {
+	var x, y float64
+	for _, j := range []int{i - 1, i + 1} {
+		if j >= 0 && j < len(points) {
+			b := bearing(points[i], points[j]) * math.Pi / 180
+			x, y = x+math.Sin(b), y+math.Cos(b)
+		}
+	}
+	if math.Hypot(x, y) < 1e-9 {
+		// straight course, take the right side of the incoming leg
+		return math.Mod(bearing(points[i-1], points[i])+90, 360)
+	}
+	return math.Mod(math.Atan2(-x, -y)*180/math.Pi+360, 360)
+}
+
+// project returns the position of p relative to c, along and across (to
+// the right) the given direction (degrees), in meters.
+func project(c flight.Point, p flight.Point, dir float64) (float64, float64) {
+	d := distance(c, p)
+	a := (bearing(c, p) - dir) * math.Pi / 180
+	return d * math.Cos(a), d * math.Sin(a)
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/rochaporto/ezgliding/flight"
+)
+
+// triangleTask returns the triangle track with a matching task. The start
+// is 5km after takeoff, the finish 5km before landing, and the turnpoints
+// are moved the given distance (meters) towards the triangle center.
+func triangleTask(offset float64) (flight.Flight, flight.Task) {
+	f := track(triangleTrack)
+	b, c := f.Points[10+3333], f.Points[10+3333+1+3333]
+	center := flight.Point{
+		Latitude:  (f.Points[0].Latitude + b.Latitude + c.Latitude) / 3,
+		Longitude: (f.Points[0].Longitude + b.Longitude + c.Longitude) / 3,
+	}
+	towards := func(p flight.Point) flight.Point {
+		d := distance(p, center)
+		return flight.Point{
+			Latitude:  p.Latitude + (center.Latitude-p.Latitude)*offset/d,
+			Longitude: p.Longitude + (center.Longitude-p.Longitude)*offset/d,
+		}
+	}
+	task := flight.Task{
+		Start:      f.Points[10+166],
+		Turnpoints: []flight.Point{towards(b), towards(c)},
+		Finish:     f.Points[len(f.Points)-10-166],
+	}
+	return f, task
+}
+
+type CheckTaskTest struct {
+	t        string
+	offset   float64
+	zones    TaskZones
+	achieved []bool
+}
+
+var checkTaskTests = []CheckTaskTest{
+	{"cylinders", 0, DefaultTaskZones, []bool{true, true, true, true}},
+	{"missed cylinder", 2000, DefaultTaskZones, []bool{true, false, false, false}},
+	{"fai sectors", 2000, TaskZones{
+		Start: Zone{Type: Line, Radius: 500}, Finish: Zone{Type: Cylinder, Radius: 500},
+		Turnpoint: Zone{Type: FAISector, Radius: 10000},
+	}, []bool{true, true, true, true}},
+	{"keyholes", 2000, TaskZones{
+		Start: Zone{Type: Line, Radius: 500}, Finish: Zone{Type: Line, Radius: 500},
+		Turnpoint: Zone{Type: Keyhole, Radius: 10000, InnerRadius: 500},
+	}, []bool{true, true, true, true}},
+	{"fai sectors too far", -2000, TaskZones{
+		Start: Zone{Type: Line, Radius: 500}, Finish: Zone{Type: Line, Radius: 500},
+		Turnpoint: Zone{Type: FAISector, Radius: 10000},
+	}, []bool{true, false, false, false}},
+	{"short start line", 0, TaskZones{
+		Start: Zone{Type: Line, Radius: 0}, Finish: Zone{Type: Line, Radius: 500},
+		Turnpoint: Zone{Type: Cylinder, Radius: 500},
+	}, []bool{true, true, true, true}},
+}
+
+func TestCheckTask(t *testing.T) {
+	for _, test := range checkTaskTests {
+		f, task := triangleTask(test.offset)
+		r, err := CheckTask(f, task, test.zones)
+		if err != nil {
+			t.Errorf("%v failed :: %v", test.t, err)
+			continue
+		}
+		completed := true
+		for i, a := range test.achieved {
+			if r.Points[i].Achieved != a {
+				t.Errorf("%v failed :: expected point %v achieved %v", test.t, i, a)
+			}
+			if i > 0 && a && !r.Points[i].Time.After(r.Points[i-1].Time) {
+				t.Errorf("%v failed :: point %v achieved out of order", test.t, i)
+			}
+			completed = completed && a
+		}
+		if r.Completed != completed || !near(r.Distance/1000, 290, 10) {
+			t.Errorf("%v failed :: wrong result %+v", test.t, r)
+		}
+		if completed && (!near(r.AchievedDistance, r.Distance, 1) || !near(r.Speed, 30, 1.5)) {
+			t.Errorf("%v failed :: wrong distance or speed %v %v", test.t, r.AchievedDistance, r.Speed)
+		}
+		if !completed && (r.Speed != 0 || r.Duration != 0) {
+			t.Errorf("%v failed :: expected no speed for incomplete task", test.t)
+		}
+	}
+}
+
+func TestCheckTaskRestart(t *testing.T) {
+	f, task := triangleTask(0)
+	// start again: go back before the start line and cross it a second time
+	start := track([]segment{{10, 0, 0, 0, 0}, {300, 30, 0, 0, 0}, {1, 30, 180, 0, 0}, {300, 30, 0, 0, 0}, {1, 30, 180, 0, 0}})
+	offset := start.Points[len(start.Points)-1].Time.Sub(f.Points[0].Time)
+	for i := range f.Points {
+		f.Points[i].Time = f.Points[i].Time.Add(offset)
+	}
+	f.Points = append(start.Points, f.Points...)
+	r, err := CheckTask(f, task, DefaultTaskZones)
+	if err != nil {
+		t.Fatalf("failed to check task :: %v", err)
+	}
+	if !r.Completed || !r.Points[0].Time.After(f.Points[len(start.Points)].Time) {
+		t.Errorf("expected the second start to be taken but got %+v", r.Points[0])
+	}
+}
+
+func TestCheckTaskMissing(t *testing.T) {
+	f, task := triangleTask(0)
+	task.Finish = flight.Point{}
+	if _, err := CheckTask(f, task, DefaultTaskZones); err == nil {
+		t.Errorf("expected error for task with missing finish")
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"math"
+	"time"
+
+	"github.com/rochaporto/ezgliding/flight"
+)
+
+// Direction is one of Left, Right.
+type Direction int
+
+const (
+	// Left is counter clockwise circling.
+	Left Direction = iota
+	// Right is clockwise circling.
+	Right
+)
+
+func (d Direction) String() string {
+	if d == Right {
+		return "right"
+	}
+	return "left"
+}
+
+// MarshalText returns the direction as text, used in the JSON output.
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Thermal holds the statistics of a single thermal (circling phase).
+//
+// Altitudes are in meters, climb rates and wind speed in m/s.
+// CircleTime is the average time taken for a full circle. The wind is
+// estimated from the drift over the full circles flown, and WindDirection
+// is where it blows from (degrees).
+type Thermal struct {
+	Start         time.Time
+	End           time.Time
+	Duration      time.Duration
+	EntryAltitude int64
+	ExitAltitude  int64
+	AverageClimb  float64
+	PeakClimb     float64
+	Direction     Direction
+	CircleTime    time.Duration
+	WindSpeed     float64
+	WindDirection float64
+}
+
+// ThermalStats holds the thermal statistics of a flight.
+//
+// MeanClimb is the altitude gained in all thermals over the total time
+// spent circling (m/s), CirclingPercentage is the share of the flight
+// time spent circling, and Best is the index of the thermal with the best
+// average climb (-1 if there are no thermals).
+type ThermalStats struct {
+	Takeoff            time.Time
+	Landing            time.Time
+	Thermals           []Thermal
+	MeanClimb          float64
+	CirclingPercentage float64
+	Best               int
+}
+
+// Thermals analyses the given flight and returns its thermal statistics.
+func Thermals(f flight.Flight, cfg Config) (ThermalStats, error) {
+	stats := ThermalStats{Thermals: []Thermal{}, Best: -1}
+	a, err := Analyse(f, cfg)
+	if err != nil {
+		return stats, err
+	}
+	stats.Takeoff, stats.Landing = a.Takeoff.Time, a.Landing.Time
+	var gain int64
+	var circling time.Duration
+	for _, p := range a.Phases {
+		if p.Type != Circling {
+			continue
+		}
+		t := thermal(f.Points, p, cfg)
+		if stats.Best == -1 || t.AverageClimb > stats.Thermals[stats.Best].AverageClimb {
+			stats.Best = len(stats.Thermals)
+		}
+		stats.Thermals = append(stats.Thermals, t)
+		gain += p.AltitudeChange
+		circling += p.Duration
+	}
+	if circling > 0 {
+		stats.MeanClimb = float64(gain) / circling.Seconds()
+	}
+	if d := a.Landing.Time.Sub(a.Takeoff.Time); d > 0 {
+		stats.CirclingPercentage = 100 * circling.Seconds() / d.Seconds()
+	}
+	return stats, nil
+}
+
+// thermal returns the statistics of the given circling phase.
+func thermal(pts []flight.Point, p Phase, cfg Config) Thermal {
+	t := Thermal{
+		Start: p.Start.Time, End: p.End.Time, Duration: p.Duration,
+		EntryAltitude: Altitude(p.Start, cfg), ExitAltitude: Altitude(p.End, cfg),
+	}
+	if p.Duration <= 0 {
+		return t
+	}
+	t.AverageClimb = float64(p.AltitudeChange) / p.Duration.Seconds()
+	t.PeakClimb = t.AverageClimb
+	for i := p.StartIndex; i < p.EndIndex; i++ {
+		for j := i + 1; j <= p.EndIndex; j++ {
+			dt := pts[j].Time.Sub(pts[i].Time)
+			if dt < cfg.VarioWindow {
+				continue
+			}
+			climb := float64(Altitude(pts[j], cfg)-Altitude(pts[i], cfg)) / dt.Seconds()
+			t.PeakClimb = math.Max(t.PeakClimb, climb)
+			break
+		}
+	}
+
+	// total heading change, and index at the end of the last full circle
+	var heading float64
+	full, last := 0, p.StartIndex
+	for i := p.StartIndex + 1; i <= p.EndIndex; i++ {
+		heading += turn(pts, i)
+		if n := int(math.Abs(heading) / 360); n > full {
+			full, last = n, i
+		}
+	}
+	if heading > 0 {
+		t.Direction = Right
+	}
+	if heading != 0 {
+		t.CircleTime = time.Duration(float64(p.Duration) * 360 / math.Abs(heading))
+	}
+	if dt := pts[last].Time.Sub(pts[p.StartIndex].Time); last > p.StartIndex && dt > 0 {
+		t.WindSpeed = distance(pts[p.StartIndex], pts[last]) / dt.Seconds()
+		t.WindDirection = math.Mod(bearing(pts[p.StartIndex], pts[last])+180, 360)
+	}
+	return t
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package analysis
+
+import (
+	"testing"
+)
+
+// thermalTrack has two thermals: the first circling right with a west
+// wind, the second circling left with a stronger core at the end.
+var thermalTrack = []segment{
+	{60, 0, 0, 0, 0},
+	{100, 25, 0, 1, 0},
+	{120, 20, 18, 2, 5},
+	{120, 30, 0, -1, 0},
+	{60, 20, -12, 1, 0},
+	{40, 20, -12, 3, 0},
+	{120, 30, 0, -1, 0},
+	{60, 0, 0, 0, 0},
+}
+
+func TestThermals(t *testing.T) {
+	stats, err := Thermals(track(thermalTrack), DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to get thermal stats :: %v", err)
+	}
+	if len(stats.Thermals) != 2 {
+		t.Fatalf("expected 2 thermals but got %+v", stats.Thermals)
+	}
+	expected := []struct {
+		average    float64
+		peak       float64
+		direction  Direction
+		circleTime float64
+		windSpeed  float64
+	}{
+		{2, 2, Right, 20, 5},
+		{1.8, 3, Left, 30, 0},
+	}
+	for i, e := range expected {
+		th := stats.Thermals[i]
+		if !near(th.AverageClimb, e.average, 0.2) || !near(th.PeakClimb, e.peak, 0.2) ||
+			th.Direction != e.direction || !near(th.CircleTime.Seconds(), e.circleTime, 2) ||
+			!near(th.WindSpeed, e.windSpeed, 0.5) {
+			t.Errorf("thermal %v: expected %+v but got %+v", i, e, th)
+		}
+		if th.ExitAltitude-th.EntryAltitude != int64(th.AverageClimb*th.Duration.Seconds()+0.5) {
+			t.Errorf("thermal %v: inconsistent altitudes %+v", i, th)
+		}
+	}
+	if !near(stats.Thermals[0].WindDirection, 270, 10) {
+		t.Errorf("expected west wind but got %v", stats.Thermals[0].WindDirection)
+	}
+	if stats.Best != 0 {
+		t.Errorf("expected first thermal to be the best but got %v", stats.Best)
+	}
+	if !near(stats.MeanClimb, 1.9, 0.2) || !near(stats.CirclingPercentage, 100*220/620.0, 5) {
+		t.Errorf("wrong summary :: %+v", stats)
+	}
+}
+
+func TestThermalsNone(t *testing.T) {
+	stats, err := Thermals(track([]segment{{10, 0, 0, 0, 0}, {100, 25, 0, -1, 0}}), DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to get thermal stats :: %v", err)
+	}
+	if len(stats.Thermals) != 0 || stats.Best != -1 || stats.MeanClimb != 0 || stats.CirclingPercentage != 0 {
+		t.Errorf("expected no thermals but got %+v", stats)
+	}
+}
+
+func TestThermalsError(t *testing.T) {
+	if _, err := Thermals(track([]segment{}), DefaultConfig); err == nil {
+		t.Errorf("expected error for flight with no points")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package flight
+
+import (
+	"errors"
+	"io"
+
+	"github.com/paulmach/go.geojson"
+)
+
+// ExportConfig holds the options used when exporting a flight to other
+// formats (GeoJSON, KML).
+type ExportConfig struct {
+	// GNSSAltitude selects GNSS altitude instead of pressure altitude.
+	// GNSS altitude is also used for fixes with no pressure altitude.
+	GNSSAltitude bool
+	// FixProperties adds the time, altitude and vario of each fix as
+	// properties of the GeoJSON track.
+	FixProperties bool
+}
+
+// errNoPoints is returned when exporting a flight with no track.
+var errNoPoints = errors.New("flight has no points")
+
+// altitude returns the altitude of pt, pressure or GNSS as given in cfg.
+func (cfg ExportConfig) altitude(pt Point) int64 {
+	if cfg.GNSSAltitude || pt.PressureAltitude == 0 {
+		return pt.GNSSAltitude
+	}
+	return pt.PressureAltitude
+}
+
+// varios returns the vertical speed (m/s) at each point, from the altitude
+// change since the previous point. The first point has a vario of 0.
+func (cfg ExportConfig) varios(pts []Point) []float64 {
+	result := make([]float64, len(pts))
+	for i := 1; i < len(pts); i++ {
+		dt := pts[i].Time.Sub(pts[i-1].Time).Seconds()
+		if dt > 0 {
+			result[i] = float64(cfg.altitude(pts[i])-cfg.altitude(pts[i-1])) / dt
+		}
+	}
+	return result
+}
+
+// GeoJSON returns the given flight as a GeoJSON collection with a single
+// LineString feature (the track), with coordinates as lon, lat, altitude.
+//
+// The feature has the pilot, glider and date as properties, and if
+// requested in cfg the Times (RFC 3339), Altitudes (m) and Varios (m/s)
+// of each fix.
+func GeoJSON(f Flight, cfg ExportConfig) (*geojson.FeatureCollection, error) {
+	if len(f.Points) == 0 {
+		return nil, errNoPoints
+	}
+	coordinates := make([][]float64, len(f.Points))
+	for i, pt := range f.Points {
+		coordinates[i] = []float64{pt.Longitude, pt.Latitude, float64(cfg.altitude(pt))}
+	}
+	g := geojson.NewLineStringFeature(coordinates)
+	g.SetProperty("Pilot", f.Header.Pilot)
+	g.SetProperty("GliderType", f.Header.GliderType)
+	g.SetProperty("GliderID", f.Header.GliderID)
+	g.SetProperty("CompetitionID", f.Header.CompetitionID)
+	if !f.Header.Date.IsZero() {
+		g.SetProperty("Date", f.Header.Date.Format("2006-01-02"))
+	}
+	if cfg.FixProperties {
+		times := make([]string, len(f.Points))
+		altitudes := make([]int64, len(f.Points))
+		for i, pt := range f.Points {
+			times[i] = pt.Time.UTC().Format("2006-01-02T15:04:05Z")
+			altitudes[i] = cfg.altitude(pt)
+		}
+		g.SetProperty("Times", times)
+		g.SetProperty("Altitudes", altitudes)
+		g.SetProperty("Varios", cfg.varios(f.Points))
+	}
+	return geojson.NewFeatureCollection().AddFeature(g), nil
+}
+
+// WriteGeoJSON writes the given flight to w in the GeoJSON format, as
+// returned by GeoJSON.
+func WriteGeoJSON(w io.Writer, f Flight, cfg ExportConfig) error {
+	collection, err := GeoJSON(f, cfg)
+	if err != nil {
+		return err
+	}
+	b, err := collection.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package flight
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// exportFlight returns a short flight climbing from 1000m to 1300m, with
+// no pressure altitude in the last point.
+func exportFlight() Flight {
+	f := NewFlight()
+	f.Header.Pilot, f.Header.GliderType, f.Header.GliderID = "Pilot <Test>", "ASW 24", "D-1234"
+	f.Header.Date = time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	for i, alt := range []int64{1000, 1100, 1300, 0} {
+		pt := NewPoint()
+		pt.Time = time.Date(2015, 7, 1, 12, 0, i*10, 0, time.UTC)
+		pt.Latitude, pt.Longitude = 46+float64(i)*0.25, 6.5
+		pt.PressureAltitude, pt.GNSSAltitude = alt, 1020+int64(i)*100
+		f.Points = append(f.Points, pt)
+	}
+	return f
+}
+
+func TestGeoJSON(t *testing.T) {
+	collection, err := GeoJSON(exportFlight(), ExportConfig{FixProperties: true})
+	if err != nil {
+		t.Fatalf("failed to export flight :: %v", err)
+	}
+	if len(collection.Features) != 1 || !collection.Features[0].Geometry.IsLineString() {
+		t.Fatalf("expected a single LineString got %+v", collection.Features)
+	}
+	g := collection.Features[0]
+	expected := [][]float64{{6.5, 46, 1000}, {6.5, 46.25, 1100}, {6.5, 46.5, 1300}, {6.5, 46.75, 1320}}
+	if !reflect.DeepEqual(g.Geometry.LineString, expected) {
+		t.Errorf("wrong track, expected %v got %v", expected, g.Geometry.LineString)
+	}
+	if g.Properties["Pilot"] != "Pilot <Test>" || g.Properties["Date"] != "2015-07-01" {
+		t.Errorf("wrong header properties :: %v", g.Properties)
+	}
+	if v := g.Properties["Varios"].([]float64); !reflect.DeepEqual(v, []float64{0, 10, 20, 2}) {
+		t.Errorf("wrong varios :: %v", v)
+	}
+	if v := g.Properties["Times"].([]string); v[1] != "2015-07-01T12:00:10Z" {
+		t.Errorf("wrong times :: %v", v)
+	}
+
+	collection, _ = GeoJSON(exportFlight(), ExportConfig{GNSSAltitude: true})
+	g = collection.Features[0]
+	if g.Geometry.LineString[0][2] != 1020 {
+		t.Errorf("expected gnss altitude 1020 got %v", g.Geometry.LineString[0][2])
+	}
+	if _, ok := g.Properties["Varios"]; ok {
+		t.Errorf("expected no fix properties :: %v", g.Properties)
+	}
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGeoJSON(&buf, exportFlight(), ExportConfig{}); err != nil {
+		t.Fatalf("failed to write flight :: %v", err)
+	}
+	expected := `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"LineString","coordinates":[[6.5,46,1000],[6.5,46.25,1100],[6.5,46.5,1300],[6.5,46.75,1320]]},"properties":{"CompetitionID":"","Date":"2015-07-01","GliderID":"D-1234","GliderType":"ASW 24","Pilot":"Pilot \u003cTest\u003e"}}]}`
+	if buf.String() != expected {
+		t.Errorf("wrong output, expected\n%v\ngot\n%v", expected, buf.String())
+	}
+	if err := WriteGeoJSON(&buf, NewFlight(), ExportConfig{}); err == nil {
+		t.Errorf("expected error writing flight with no points")
+	}
+}
@@ -88,6 +88,11 @@ type Header struct {
 	CompetitionID    string
 	CompetitionClass string
 	Timezone         time.Location
+	// Extra holds unknown H subrecords and unknown record types, filled in
+	// when parsing in lenient mode. Keys are the record prefix (HFSIT, HPSIT,
+	// X, ...) and values the rest of the line, repeated records being joined
+	// with a new line.
+	Extra map[string]string
 }
 
 // Point represents a gps read (single point in the flight track).
@@ -20,7 +20,11 @@
 package flight
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -38,52 +42,179 @@ const (
 // ParseIGC returns a Flight object corresponding to the given content.
 // content should be a text string in the IGC format.
 func ParseIGC(content string) (Flight, error) {
+	return NewIGCDecoder(strings.NewReader(content)).Decode()
+}
+
+// ParseIGCLenient is the lenient version of ParseIGC.
+// Invalid records are skipped and returned as warnings instead of aborting
+// the parsing, and unknown records are kept in Header.Extra.
+func ParseIGCLenient(content string) (Flight, []error, error) {
+	d := NewIGCDecoder(strings.NewReader(content))
+	d.Lenient = true
+	f, err := d.Decode()
+	return f, d.Warnings, err
+}
+
+// IGCError is returned when decoding an IGC record fails. It holds the
+// line number (starting at 1) and the type of the offending record.
+type IGCError struct {
+	Line   int
+	Record byte
+	Err    error
+}
+
+func (e *IGCError) Error() string {
+	return fmt.Sprintf("line %d :: %c record :: %v", e.Line, e.Record, e.Err)
+}
+
+// unknownRecordError is returned by the parser for records (or H
+// subrecords) it does not know about.
+type unknownRecordError string
+
+func (e unknownRecordError) Error() string {
+	return string(e)
+}
+
+// IGCDecoder reads and decodes IGC records from an input stream.
+//
+// Records are read one line at a time, so the full content is never held
+// in memory. Both LF and CRLF line endings are accepted.
+//
+// Record times are in UTC, on the date given in the HFDTE header and
+// following days for flights crossing midnight. If LocalTime is set they
+// are converted to the timezone in the HFTZN header.
+//
+// By default decoding stops on the first invalid record. In Lenient mode
+// invalid records are skipped and collected in Warnings, while unknown
+// records and H subrecords are kept in Header.Extra.
+type IGCDecoder struct {
+	Lenient   bool
+	LocalTime bool
+	Warnings  []error
+	r         *bufio.Reader
+	line      int
+	p         IGCParser
+}
+
+// NewIGCDecoder returns a new decoder that reads from r.
+func NewIGCDecoder(r io.Reader) *IGCDecoder {
+	return &IGCDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads all remaining records from the input and returns the
+// resulting Flight.
+func (d *IGCDecoder) Decode() (Flight, error) {
 	f := NewFlight()
+	for {
+		err := d.DecodeRecord(&f)
+		if err == io.EOF {
+			return f, nil
+		} else if err != nil {
+			return f, err
+		}
+	}
+}
+
+// DecodeRecord reads the next record from the input and stores its data
+// in f. Empty lines are skipped. It returns io.EOF when there are no more
+// records, or an *IGCError if the record is invalid.
+func (d *IGCDecoder) DecodeRecord(f *Flight) error {
+	var line string
 	var err error
-	p := IGCParser{}
-	lines := strings.Split(content, "\n")
-	for i := range lines {
-		line := strings.TrimSpace(lines[i])
-		// ignore empty lines
-		if len(strings.Trim(line, " ")) < 1 {
-			continue
+	for line == "" {
+		if line, err = d.readLine(); err != nil {
+			return err
 		}
-		switch line[0] {
-		case 'A':
-			err = p.parseA(line, &f)
-		case 'B':
-			err = p.parseB(line, &f)
-		case 'C':
-			if !p.taskDone {
-				err = p.parseC(lines[i:], &f)
+	}
+	n := d.line
+	d.p.localTime = d.LocalTime
+	switch line[0] {
+	case 'A':
+		err = d.p.parseA(line, f)
+	case 'B':
+		err = d.p.parseB(line, f)
+	case 'C':
+		if !d.p.taskDone {
+			var lines []string
+			if lines, err = d.readTask(line); err == nil {
+				err = d.p.parseC(lines, f)
 			}
-		case 'D':
-			err = p.parseD(line, &f)
-		case 'E':
-			err = p.parseE(line, &f)
-		case 'F':
-			err = p.parseF(line, &f)
-		case 'G':
-			err = p.parseG(line, &f)
-		case 'H':
-			err = p.parseH(line, &f)
-		case 'I':
-			err = p.parseI(line)
-		case 'J':
-			err = p.parseJ(line)
-		case 'K':
-			err = p.parseK(line, &f)
-		case 'L':
-			err = p.parseL(line, &f)
-		default:
-			err = fmt.Errorf("invalid record :: %v", line)
-		}
-		if err != nil {
-			return f, err
 		}
+	case 'D':
+		err = d.p.parseD(line, f)
+	case 'E':
+		err = d.p.parseE(line, f)
+	case 'F':
+		err = d.p.parseF(line, f)
+	case 'G':
+		err = d.p.parseG(line, f)
+	case 'H':
+		err = d.p.parseH(line, f)
+	case 'I':
+		err = d.p.parseI(line)
+	case 'J':
+		err = d.p.parseJ(line)
+	case 'K':
+		err = d.p.parseK(line, f)
+	case 'L':
+		err = d.p.parseL(line, f)
+	default:
+		err = unknownRecordError(fmt.Sprintf("invalid record :: %v", line))
 	}
+	if err == nil {
+		return nil
+	}
+	igcErr := &IGCError{Line: n, Record: line[0], Err: err}
+	if !d.Lenient {
+		return igcErr
+	}
+	if _, ok := err.(unknownRecordError); ok {
+		d.p.parseExtra(line, f)
+	}
+	d.Warnings = append(d.Warnings, igcErr)
+	return nil
+}
 
-	return f, nil
+// readLine returns the next line in the input, with surrounding white
+// space (including any CR) removed. It returns io.EOF when the input is
+// exhausted.
+func (d *IGCDecoder) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", io.EOF
+	} else if err != nil && err != io.EOF {
+		return "", err
+	}
+	d.line++
+	return strings.TrimSpace(line), nil
+}
+
+// readTask collects the lines of the C record starting with first. The
+// number of lines to read is taken from the number of turnpoints declared
+// in first, stopping early on the first line which is not a C record; a
+// short task results in fewer lines, left to parseC to report.
+func (d *IGCDecoder) readTask(first string) ([]string, error) {
+	lines := []string{first}
+	if len(first) < 25 {
+		return lines, nil
+	}
+	nTP, err := strconv.Atoi(first[23:25])
+	if err != nil {
+		return lines, nil
+	}
+	for i := 0; i < nTP+4; i++ {
+		if next, err := d.r.Peek(1); err != nil || next[0] != 'C' {
+			break
+		}
+		line, err := d.readLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
 }
 
 type field struct {
@@ -98,6 +229,41 @@ type IGCParser struct {
 	JFields  []field
 	taskDone bool
 	numSat   int
+	// localTime is set to convert record times to timezone
+	localTime bool
+	timezone  *time.Location
+	// days is the number of midnight rollovers seen since the flight date
+	days int
+	last time.Time
+}
+
+// recordTime returns the time of a record given its HHMMSS value.
+//
+// The time is anchored to Header.Date (if available), with a day added
+// each time the clock goes back more than 12 hours (crossing midnight
+// UTC). Small backward steps between records are kept as they are.
+func (p *IGCParser) recordTime(hhmmss string, f *Flight) (time.Time, error) {
+	clock, err := time.Parse(TimeFormat, hhmmss)
+	if err != nil {
+		return clock, err
+	}
+	d := f.Header.Date
+	if d.IsZero() {
+		d = clock
+	}
+	t := time.Date(d.Year(), d.Month(), d.Day()+p.days,
+		clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+	if !p.last.IsZero() && p.last.Sub(t) > 12*time.Hour {
+		p.days++
+		t = t.AddDate(0, 0, 1)
+	}
+	if t.After(p.last) {
+		p.last = t
+	}
+	if p.localTime && p.timezone != nil {
+		return t.In(p.timezone), nil
+	}
+	return t, nil
 }
 
 func (p *IGCParser) parseA(line string, f *Flight) error {
@@ -111,17 +277,21 @@ func (p *IGCParser) parseA(line string, f *Flight) error {
 }
 
 func (p *IGCParser) parseB(line string, f *Flight) error {
-	if len(line) < 37 {
+	if len(line) < 35 {
 		return fmt.Errorf("line too short :: %v", line)
 	}
 	pt := NewPoint()
 	var err error
-	pt.Time, err = time.Parse(TimeFormat, line[1:7])
+	pt.Time, err = p.recordTime(line[1:7], f)
 	if err != nil {
 		return err
 	}
-	pt.Latitude = spatial.DMD2Decimal(line[7:15])
-	pt.Longitude = spatial.DMD2Decimal(line[15:24])
+	if pt.Latitude, err = spatial.ParseLatitude(line[7:15]); err != nil {
+		return err
+	}
+	if pt.Longitude, err = spatial.ParseLongitude(line[15:24]); err != nil {
+		return err
+	}
 	if line[24] == 'A' || line[24] == 'V' {
 		pt.FixValidity = line[24]
 	} else {
@@ -135,8 +305,8 @@ func (p *IGCParser) parseB(line string, f *Flight) error {
 	if err != nil {
 		return err
 	}
-	for _, f := range p.IFields {
-		pt.IData[f.tlc] = line[f.start-1 : f.end]
+	if err = extensionData(line, p.IFields, pt.IData); err != nil {
+		return err
 	}
 	pt.NumSatellites = p.numSat
 	f.Points = append(f.Points, pt)
@@ -193,11 +363,15 @@ func (p *IGCParser) taskPoint(line string) (Point, error) {
 	if len(line) < 18 {
 		return Point{}, fmt.Errorf("line too short :: %v", line)
 	}
-	return Point{
-		Latitude:    spatial.DMD2Decimal(line[1:9]),
-		Longitude:   spatial.DMD2Decimal(line[9:18]),
-		Description: line[18:],
-	}, nil
+	lat, err := spatial.ParseLatitude(line[1:9])
+	if err != nil {
+		return Point{}, err
+	}
+	lon, err := spatial.ParseLongitude(line[9:18])
+	if err != nil {
+		return Point{}, err
+	}
+	return Point{Latitude: lat, Longitude: lon, Description: line[18:]}, nil
 }
 
 func (p *IGCParser) parseD(line string, f *Flight) error {
@@ -214,7 +388,7 @@ func (p *IGCParser) parseE(line string, f *Flight) error {
 	if len(line) < 10 {
 		return fmt.Errorf("line too short :: %v", line)
 	}
-	t, err := time.Parse(TimeFormat, line[1:7])
+	t, err := p.recordTime(line[1:7], f)
 	if err != nil {
 		return err
 	}
@@ -229,7 +403,7 @@ func (p *IGCParser) parseF(line string, f *Flight) error {
 	if len(line) < 7 {
 		return fmt.Errorf("line too short :: %v", line)
 	}
-	t, err := time.Parse(TimeFormat, line[1:7])
+	t, err := p.recordTime(line[1:7], f)
 	if err != nil {
 		return err
 	}
@@ -260,10 +434,12 @@ func (p *IGCParser) parseH(line string, f *Flight) error {
 
 	switch line[2:5] {
 	case "DTE":
-		if len(line) < 11 {
+		// also handles the HFDTEDATE:DDMMYY,NN format (with flight number)
+		date := strings.TrimPrefix(line[5:], "DATE:")
+		if len(date) < 6 {
 			return fmt.Errorf("line too short :: %v", line)
 		}
-		f.Header.Date, err = time.Parse(DateFormat, line[5:11])
+		f.Header.Date, err = time.Parse(DateFormat, date[:6])
 	case "FXA":
 		if len(line) < 8 {
 			return fmt.Errorf("line too short :: %v", line)
@@ -301,52 +477,91 @@ func (p *IGCParser) parseH(line string, f *Flight) error {
 		if err != nil {
 			return err
 		}
-		f.Header.Timezone = *time.FixedZone("", int(z*3600))
+		loc := time.FixedZone("", int(z*3600))
+		f.Header.Timezone = *loc
+		p.timezone = loc
 	default:
-		err = fmt.Errorf("unknown record :: %v", line)
+		err = unknownRecordError(fmt.Sprintf("unknown record :: %v", line))
 	}
 
 	return err
 }
 
-func (p *IGCParser) parseI(line string) error {
-	if len(line) < 3 {
-		return fmt.Errorf("line too short :: %v", line)
+// parseExtra stores an unknown record in Header.Extra. H subrecords are
+// keyed by their prefix (type, source and three letter code), other records
+// by their type. Repeated records are joined with a new line.
+func (p *IGCParser) parseExtra(line string, f *Flight) {
+	key, value := line[:1], line[1:]
+	if line[0] == 'H' && len(line) >= 5 {
+		key, value = line[:5], line[5:]
 	}
-	n, err := strconv.ParseInt(line[1:3], 10, 0)
-	if err != nil {
-		return fmt.Errorf("invalid number of I fields :: %v", line)
+	if f.Header.Extra == nil {
+		f.Header.Extra = make(map[string]string)
 	}
-	if len(line) != int(n*7+3) {
-		return fmt.Errorf("wrong line size :: %v", line)
+	if v, ok := f.Header.Extra[key]; ok {
+		value = v + "\n" + value
 	}
-	for i := 0; i < int(n); i++ {
-		s := i*7 + 3
-		start, _ := strconv.ParseInt(line[s:s+2], 10, 0)
-		end, _ := strconv.ParseInt(line[s+2:s+4], 10, 0)
-		tlc := line[s+4 : s+7]
-		p.IFields = append(p.IFields, field{start: start, end: end, tlc: tlc})
+	f.Header.Extra[key] = value
+}
+
+func (p *IGCParser) parseI(line string) error {
+	fields, err := parseExtensions(line)
+	if err != nil {
+		return err
 	}
+	p.IFields = append(p.IFields, fields...)
 	return nil
 }
 
 func (p *IGCParser) parseJ(line string) error {
+	fields, err := parseExtensions(line)
+	if err != nil {
+		return err
+	}
+	p.JFields = append(p.JFields, fields...)
+	return nil
+}
+
+// parseExtensions returns the extension fields defined in an I or J
+// record.
+func parseExtensions(line string) ([]field, error) {
 	if len(line) < 3 {
-		return fmt.Errorf("line too short :: %v", line)
+		return nil, fmt.Errorf("line too short :: %v", line)
 	}
 	n, err := strconv.ParseInt(line[1:3], 10, 0)
 	if err != nil {
-		return fmt.Errorf("invalid number of J fields :: %v", line)
+		return nil, fmt.Errorf("invalid number of %c fields :: %v", line[0], line)
 	}
 	if len(line) != int(n*7+3) {
-		return fmt.Errorf("wrong line size :: %v", line)
+		return nil, fmt.Errorf("wrong line size :: %v", line)
 	}
-	for i := 0; i < int(n); i++ {
+	fields := make([]field, n)
+	for i := range fields {
 		s := i*7 + 3
-		start, _ := strconv.ParseInt(line[s:s+2], 10, 0)
-		end, _ := strconv.ParseInt(line[s+2:s+4], 10, 0)
-		tlc := line[s+4 : s+7]
-		p.JFields = append(p.JFields, field{start: start, end: end, tlc: tlc})
+		start, err := strconv.ParseInt(line[s:s+2], 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field start :: %v", line)
+		}
+		end, err := strconv.ParseInt(line[s+2:s+4], 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field end :: %v", line)
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("invalid field columns %d-%d :: %v", start, end, line)
+		}
+		fields[i] = field{start: start, end: end, tlc: line[s+4 : s+7]}
+	}
+	return fields, nil
+}
+
+// extensionData stores in data the values of the given extension fields
+// in line, failing if the line is too short to hold them.
+func extensionData(line string, fields []field, data map[string]string) error {
+	for _, f := range fields {
+		if int(f.end) > len(line) {
+			return fmt.Errorf("line too short for field %v :: %v", f.tlc, line)
+		}
+		data[f.tlc] = line[f.start-1 : f.end]
 	}
 	return nil
 }
@@ -355,13 +570,13 @@ func (p *IGCParser) parseK(line string, f *Flight) error {
 	if len(line) < 7 {
 		return fmt.Errorf("line too short :: %v", line)
 	}
-	t, err := time.Parse(TimeFormat, line[1:7])
+	t, err := p.recordTime(line[1:7], f)
 	if err != nil {
 		return err
 	}
 	fields := make(map[string]string)
-	for _, f := range p.JFields {
-		fields[f.tlc] = line[f.start-1 : f.end]
+	if err = extensionData(line, p.JFields, fields); err != nil {
+		return err
 	}
 	f.K[t] = fields
 	return nil
@@ -382,3 +597,239 @@ func stripUpTo(s string, sep string) string {
 	}
 	return s[i+1:]
 }
+
+// WriteIGC writes the given flight to w in the IGC format.
+//
+// Records are written in the order given in the spec: A, H, I, J, C, D,
+// followed by the B, E, F and K records ordered by time, and finally
+// L and G. Fields not available in the Flight are left out.
+func WriteIGC(w io.Writer, f Flight) error {
+	bw := bufio.NewWriter(w)
+	iFields := dataFields(f.pointData(), 36)
+	jFields := dataFields(f.kData(), 8)
+
+	if f.Header.Manufacturer != "" {
+		fmt.Fprintf(bw, "A%v%v%v\r\n", f.Header.Manufacturer, f.Header.UniqueID, f.Header.AdditionalData)
+	}
+	writeIGCHeader(bw, f.Header)
+	writeIGCFields(bw, 'I', iFields)
+	writeIGCFields(bw, 'J', jFields)
+	if !reflect.DeepEqual(f.Task, (Task{})) {
+		writeIGCTask(bw, f.Task)
+	}
+	if f.DGPSStationID != "" {
+		fmt.Fprintf(bw, "D2%v\r\n", f.DGPSStationID)
+	}
+
+	// merge the time keyed records with the points, keeping the points order
+	records := f.timedRecords(jFields)
+	for _, pt := range f.Points {
+		for len(records) > 0 && !records[0].t.After(pt.Time) {
+			fmt.Fprintf(bw, "%v\r\n", records[0].line)
+			records = records[1:]
+		}
+		fmt.Fprintf(bw, "B%v%v%v%c%05d%05d", pt.Time.UTC().Format(TimeFormat),
+			spatial.FormatLatitude(pt.Latitude, spatial.IGC),
+			spatial.FormatLongitude(pt.Longitude, spatial.IGC), fixValidity(pt.FixValidity), pt.PressureAltitude, pt.GNSSAltitude)
+		for _, fd := range iFields {
+			fmt.Fprintf(bw, "%-*v", fd.end-fd.start+1, pt.IData[fd.tlc])
+		}
+		fmt.Fprintf(bw, "\r\n")
+	}
+	for _, r := range records {
+		fmt.Fprintf(bw, "%v\r\n", r.line)
+	}
+
+	for _, l := range f.Logbook {
+		fmt.Fprintf(bw, "L%v%v\r\n", l.Type, l.Text)
+	}
+	for s := f.Signature; s != ""; {
+		n := len(s)
+		if n > 75 {
+			n = 75
+		}
+		fmt.Fprintf(bw, "G%v\r\n", s[:n])
+		s = s[n:]
+	}
+	return bw.Flush()
+}
+
+// writeIGCHeader writes the H records for all the non empty header fields.
+func writeIGCHeader(w io.Writer, h Header) {
+	if !h.Date.IsZero() {
+		fmt.Fprintf(w, "HFDTE%v\r\n", h.Date.Format(DateFormat))
+	}
+	if h.FixAccuracy != 0 {
+		fmt.Fprintf(w, "HFFXA%03d\r\n", h.FixAccuracy)
+	}
+	fields := []struct {
+		prefix string
+		value  string
+	}{
+		{"HFPLTPILOTINCHARGE:", h.Pilot},
+		{"HFCM2CREW2:", h.Crew},
+		{"HFGTYGLIDERTYPE:", h.GliderType},
+		{"HFGIDGLIDERID:", h.GliderID},
+		{"HFDTM100GPSDATUM:", h.GPSDatum},
+		{"HFRFWFIRMWAREVERSION:", h.FirmwareVersion},
+		{"HFRHWHARDWAREVERSION:", h.HardwareVersion},
+		{"HFFTYFRTYPE:", h.FlightRecorder},
+		{"HFGPS", h.GPS},
+		{"HFPRSPRESSALTSENSOR:", h.PressureSensor},
+		{"HFCIDCOMPETITIONID:", h.CompetitionID},
+		{"HFCCLCOMPETITIONCLASS:", h.CompetitionClass},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			fmt.Fprintf(w, "%v%v\r\n", field.prefix, field.value)
+		}
+	}
+	_, offset := time.Unix(0, 0).In(&h.Timezone).Zone()
+	if offset != 0 {
+		fmt.Fprintf(w, "HFTZNTIMEZONE:%v\r\n", strconv.FormatFloat(float64(offset)/3600, 'f', -1, 64))
+	}
+	// unknown records as they were read, H subrecords first
+	hKeys, keys := []string{}, []string{}
+	for k := range h.Extra {
+		if strings.HasPrefix(k, "H") {
+			hKeys = append(hKeys, k)
+		} else if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(hKeys)
+	sort.Strings(keys)
+	for _, k := range append(hKeys, keys...) {
+		for _, v := range strings.Split(h.Extra[k], "\n") {
+			fmt.Fprintf(w, "%v%v\r\n", k, v)
+		}
+	}
+}
+
+// writeIGCFields writes an I or J record declaring the given fields.
+func writeIGCFields(w io.Writer, record byte, fields []field) {
+	if len(fields) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%c%02d", record, len(fields))
+	for _, fd := range fields {
+		fmt.Fprintf(w, "%02d%02d%v", fd.start, fd.end, fd.tlc)
+	}
+	fmt.Fprintf(w, "\r\n")
+}
+
+// writeIGCTask writes the C records for the given task.
+func writeIGCTask(w io.Writer, t Task) {
+	declaration, flight := "000000000000", "000000"
+	if !t.DeclarationDate.IsZero() {
+		declaration = t.DeclarationDate.Format(DateFormat + TimeFormat)
+	}
+	if !t.FlightDate.IsZero() {
+		flight = t.FlightDate.Format(DateFormat)
+	}
+	fmt.Fprintf(w, "C%v%v%04d%02d%v\r\n", declaration, flight, t.Number, len(t.Turnpoints), t.Description)
+	points := append([]Point{t.Takeoff, t.Start}, t.Turnpoints...)
+	points = append(points, t.Finish, t.Landing)
+	for _, pt := range points {
+		fmt.Fprintf(w, "C%v%v%v\r\n", spatial.FormatLatitude(pt.Latitude, spatial.IGC),
+			spatial.FormatLongitude(pt.Longitude, spatial.IGC), pt.Description)
+	}
+}
+
+// timedRecord is a record line keyed by its time, used to write the E,
+// F and K records in order.
+type timedRecord struct {
+	t     time.Time
+	order int
+	line  string
+}
+
+type byTime []timedRecord
+
+func (r byTime) Len() int      { return len(r) }
+func (r byTime) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byTime) Less(i, j int) bool {
+	if r[i].t.Equal(r[j].t) {
+		return r[i].order < r[j].order
+	}
+	return r[i].t.Before(r[j].t)
+}
+
+// timedRecords returns the F, E and K record lines of the flight sorted by
+// time. For records with the same time F comes first, then E and K.
+func (f Flight) timedRecords(jFields []field) []timedRecord {
+	records := []timedRecord{}
+	for t, sats := range f.Satellites {
+		line := "F" + t.UTC().Format(TimeFormat)
+		for _, s := range sats {
+			line = line + fmt.Sprintf("%02d", s)
+		}
+		records = append(records, timedRecord{t, 0, line})
+	}
+	for t, events := range f.Events {
+		for code, text := range events {
+			records = append(records, timedRecord{t, 1, "E" + t.UTC().Format(TimeFormat) + code + text})
+		}
+	}
+	for t, data := range f.K {
+		line := "K" + t.UTC().Format(TimeFormat)
+		for _, fd := range jFields {
+			line = line + fmt.Sprintf("%-*v", fd.end-fd.start+1, data[fd.tlc])
+		}
+		records = append(records, timedRecord{t, 2, line})
+	}
+	sort.Stable(byTime(records))
+	return records
+}
+
+// pointData returns the IData entries of all the flight points.
+func (f Flight) pointData() []map[string]string {
+	data := []map[string]string{}
+	for _, pt := range f.Points {
+		data = append(data, pt.IData)
+	}
+	return data
+}
+
+// kData returns the K record entries of the flight.
+func (f Flight) kData() []map[string]string {
+	data := []map[string]string{}
+	for _, k := range f.K {
+		data = append(data, k)
+	}
+	return data
+}
+
+// dataFields returns the I/J field definitions needed to hold the given
+// data, sorted by code and starting at column start. The width of each
+// field is the widest of its values.
+func dataFields(data []map[string]string, start int64) []field {
+	widths := make(map[string]int)
+	for _, d := range data {
+		for tlc, v := range d {
+			if len(v) > widths[tlc] {
+				widths[tlc] = len(v)
+			}
+		}
+	}
+	tlcs := []string{}
+	for tlc := range widths {
+		tlcs = append(tlcs, tlc)
+	}
+	sort.Strings(tlcs)
+	fields := []field{}
+	for _, tlc := range tlcs {
+		end := start + int64(widths[tlc]) - 1
+		fields = append(fields, field{start: start, end: end, tlc: tlc})
+		start = end + 1
+	}
+	return fields
+}
+
+// fixValidity returns v if it is a valid fix validity, and 'A' otherwise.
+func fixValidity(v byte) byte {
+	if v == 'A' || v == 'V' {
+		return v
+	}
+	return 'A'
+}
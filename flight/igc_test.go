@@ -20,8 +20,11 @@
 package flight
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -80,6 +83,14 @@ HFTZNTimezone:2.00
 		"HFDTE330203", Flight{}, true},
 	{"H record failure date too short",
 		"HFDTE33", Flight{}, true},
+	{"H record date with flight number",
+		"HFDTEDATE:010203,01", Flight{
+			Header: Header{Date: time.Date(2003, time.February, 01, 0, 0, 0, 0, time.UTC)},
+			K:      map[time.Time]map[string]string{}, Events: map[time.Time]map[string]string{},
+			Satellites: map[time.Time][]int{}, Sources: make(map[string]Source),
+		}, false},
+	{"H record failure date with prefix too short",
+		"HFDTEDATE:0102", Flight{}, true},
 	{"H record failure bad fix accuracy",
 		"HFFXAAAA", Flight{}, true},
 	{"H record failure fix accuracy too short",
@@ -185,6 +196,10 @@ GJNJK2489IERGNV3089IVJE9GO398535J3894N358954983O0934
 		"B110001", Flight{}, true},
 	{"point/fix bad time",
 		"B3103105107212N00149174WV002930043519608024", Flight{}, true},
+	{"point/fix bad latitude",
+		"B16031051x7212N00149174WV002930043519608024", Flight{}, true},
+	{"point/fix bad longitude",
+		"B1603105107212N00149174SV002930043519608024", Flight{}, true},
 	{"point/fix bad fix validity",
 		"B1603105107212N00149174WX002930043519608024", Flight{}, true},
 	{"point/fix bad pressure altitude",
@@ -197,12 +212,26 @@ GJNJK2489IERGNV3089IVJE9GO398535J3894N358954983O0934
 		"I0a", Flight{}, true},
 	{"irecord wrong size with fields",
 		"I02AAA0102BBB030", Flight{}, true},
+	{"irecord invalid field start",
+		"I01XX38FXA", Flight{}, true},
+	{"irecord invalid field end",
+		"I0136XXFXA", Flight{}, true},
+	{"irecord field start zero",
+		"I010038FXA", Flight{}, true},
+	{"irecord field end before start",
+		"I013836FXA", Flight{}, true},
+	{"point/fix too short for i fields",
+		"I013638FXA\nB1602455107126N00149300WA0028800429", Flight{}, true},
 	{"jrecord wrong size",
 		"J0", Flight{}, true},
 	{"jrecord invalid value for field number",
 		"J0a", Flight{}, true},
 	{"jrecord wrong size with fields",
 		"J02AAA0102BBB030", Flight{}, true},
+	{"jrecord field end before start",
+		"J011208HDT", Flight{}, true},
+	{"k too short for j fields",
+		"J010812HDT\nK16024510", Flight{}, true},
 	{"k wrong size",
 		"K16024", Flight{}, true},
 	{"k invalid date",
@@ -315,6 +344,282 @@ func TestIGCParse(t *testing.T) {
 	}
 }
 
+type IGCDecoderErrorTest struct {
+	t string
+	c string
+	l int
+	r byte
+}
+
+var decoderErrorTests = []IGCDecoderErrorTest{
+	{"error in first line", "AFLA0", 1, 'A'},
+	{"error after empty lines", "AFLA001\n\n\nHFDTE330203", 4, 'H'},
+	{"error with crlf endings", "AFLA001\r\nHFFXA500\r\nB16024", 3, 'B'},
+	{"error in record after task",
+		"C150701213841160701000101500KTri\nC5111359N00101899WEZ TAKEOFF\nC5110179N00102644WEZ START\nC5209092N00255227WEZ TP1\nC5110179N00102644WEZ FINISH\nC5111359N00101899WEZ LANDING\nRANDOM", 7, 'R'},
+}
+
+func TestIGCDecoderError(t *testing.T) {
+	for _, test := range decoderErrorTests {
+		_, err := NewIGCDecoder(strings.NewReader(test.c)).Decode()
+		if err == nil {
+			t.Errorf("%v failed :: expected error", test.t)
+			continue
+		}
+		igcErr, ok := err.(*IGCError)
+		if !ok {
+			t.Errorf("%v failed :: expected IGCError but got %T", test.t, err)
+			continue
+		}
+		if igcErr.Line != test.l || igcErr.Record != test.r {
+			t.Errorf("%v failed :: expected error at line %v record %c but got %v",
+				test.t, test.l, test.r, igcErr)
+		}
+	}
+}
+
+func TestIGCDecoderCRLF(t *testing.T) {
+	for _, test := range parseTests {
+		if test.e {
+			continue
+		}
+		c := strings.Replace(test.c, "\n", "\r\n", -1)
+		result, err := NewIGCDecoder(strings.NewReader(c)).Decode()
+		if err != nil {
+			t.Errorf("%v failed :: %v", test.t, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.r) {
+			t.Errorf("%v failed :: expected\n%+v\ngot\n%+v", test.t, test.r, result)
+		}
+	}
+}
+
+func TestIGCDecoderRecord(t *testing.T) {
+	d := NewIGCDecoder(strings.NewReader("AFLA001\n\nHFDTE010203\n"))
+	f := NewFlight()
+	if err := d.DecodeRecord(&f); err != nil || f.Header.Manufacturer != "FLA" {
+		t.Errorf("failed to decode A record :: %v %+v", err, f.Header)
+	}
+	if err := d.DecodeRecord(&f); err != nil || f.Header.Date.IsZero() {
+		t.Errorf("failed to decode H record :: %v %+v", err, f.Header)
+	}
+	if err := d.DecodeRecord(&f); err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+}
+
+func TestIGCDecoderShortTask(t *testing.T) {
+	c := `HFDTE010203
+C150701213841160701000102500KTri
+C5111359N00101899WEZ TAKEOFF
+C5110179N00102644WEZ START
+B1602455107126N00149300WA0028800429
+B1603105107212N00149174WA0029300435
+`
+	d := NewIGCDecoder(strings.NewReader(c))
+	d.Lenient = true
+	f, err := d.Decode()
+	if err != nil {
+		t.Fatalf("lenient decode failed :: %v", err)
+	}
+	if len(d.Warnings) != 1 || d.Warnings[0].(*IGCError).Line != 2 {
+		t.Errorf("expected a warning for the task in line 2 but got %v", d.Warnings)
+	}
+	if len(f.Points) != 2 {
+		t.Errorf("expected the fixes after the task to be parsed but got %+v", f.Points)
+	}
+}
+
+func TestIGCParseLenient(t *testing.T) {
+	c := `
+AFLA001
+HFDTE010203
+HFSITSite:EZ SITE
+HPALGALTGPS:GEO
+HFALPALTPRESSURE:ISA
+HFFRSSecurity:OK
+HFFXAAAA
+XRANDOM GARBAGE
+XMORE GARBAGE
+B16024
+B1602455107126N00149300WA002880042919509020
+`
+	f, warnings, err := ParseIGCLenient(c)
+	if err != nil {
+		t.Fatalf("lenient parse failed :: %v", err)
+	}
+	extra := map[string]string{
+		"HFSIT": "Site:EZ SITE", "HPALG": "ALTGPS:GEO", "HFALP": "ALTPRESSURE:ISA",
+		"HFFRS": "Security:OK", "X": "RANDOM GARBAGE\nMORE GARBAGE",
+	}
+	if !reflect.DeepEqual(f.Header.Extra, extra) {
+		t.Errorf("expected extra %v but got %v", extra, f.Header.Extra)
+	}
+	// unknown records are written back as they were read
+	var buf bytes.Buffer
+	if err := WriteIGC(&buf, f); err != nil {
+		t.Fatalf("failed to write flight :: %v", err)
+	}
+	expected := "HFALPALTPRESSURE:ISA\r\nHFFRSSecurity:OK\r\nHFSITSite:EZ SITE\r\nHPALGALTGPS:GEO\r\n" +
+		"XRANDOM GARBAGE\r\nXMORE GARBAGE\r\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("expected unknown records %q in\n%v", expected, buf.String())
+	}
+	lines := []int{4, 5, 6, 7, 8, 9, 10, 11}
+	if len(warnings) != len(lines) {
+		t.Fatalf("expected %v warnings but got %v :: %v", len(lines), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.(*IGCError).Line != lines[i] {
+			t.Errorf("expected warning at line %v but got %v", lines[i], w)
+		}
+	}
+	if len(f.Points) != 1 || f.Header.Manufacturer != "FLA" || f.Header.Date.IsZero() {
+		t.Errorf("failed to parse valid records :: %+v", f)
+	}
+	if _, err := ParseIGC(c); err == nil {
+		t.Errorf("expected strict parse to fail")
+	}
+}
+
+func TestIGCParseLenientExtensions(t *testing.T) {
+	c := `
+AFLA001
+HFDTE010203
+I023638FXA3940SIU
+J010812HDT
+B1602455107126N00149300WA0028800429
+B1602505107126N00149300WA002880042902002
+K16024510
+K16025009090
+`
+	f, warnings, err := ParseIGCLenient(c)
+	if err != nil {
+		t.Fatalf("lenient parse failed :: %v", err)
+	}
+	lines := []int{6, 8}
+	if len(warnings) != len(lines) {
+		t.Fatalf("expected %v warnings but got %v :: %v", len(lines), len(warnings), warnings)
+	}
+	for i, w := range warnings {
+		if w.(*IGCError).Line != lines[i] {
+			t.Errorf("expected warning at line %v but got %v", lines[i], w)
+		}
+	}
+	if len(f.Points) != 1 || f.Points[0].IData["SIU"] != "02" {
+		t.Errorf("expected one point with extension data but got %+v", f.Points)
+	}
+	if len(f.K) != 1 {
+		t.Errorf("expected one k record but got %v", f.K)
+	}
+}
+
+func TestWriteIGC(t *testing.T) {
+	for _, test := range parseTests {
+		if test.e {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := WriteIGC(&buf, test.r); err != nil {
+			t.Errorf("%v failed :: %v", test.t, err)
+			continue
+		}
+		result, err := ParseIGC(buf.String())
+		if err != nil {
+			t.Errorf("%v failed :: %v\n%v", test.t, err, buf.String())
+			continue
+		}
+		if !reflect.DeepEqual(result, test.r) {
+			t.Errorf("%v failed :: expected\n%+v\ngot\n%+v", test.t, test.r, result)
+		}
+	}
+}
+
+func TestWriteIGCOrder(t *testing.T) {
+	f := NewFlight()
+	f.Header.Manufacturer, f.Header.UniqueID = "FLA", "001"
+	f.Header.Extra = map[string]string{"HFSIT": "SITE:EZ SITE"}
+	f.Signature = "ABCDEF"
+	for _, s := range []int{10, 20} {
+		pt := NewPoint()
+		pt.Time = time.Date(0, 1, 1, 16, 0, s, 0, time.UTC)
+		pt.Latitude, pt.Longitude, pt.FixValidity = -45.5, 6.25, 'A'
+		f.Points = append(f.Points, pt)
+	}
+	f.Events[time.Date(0, 1, 1, 16, 0, 20, 0, time.UTC)] = map[string]string{"PEV": ""}
+	f.Satellites[time.Date(0, 1, 1, 16, 0, 20, 0, time.UTC)] = []int{1, 2}
+	f.Logbook = []LogEntry{LogEntry{Type: "PLT", Text: "LOG TEXT"}}
+	var buf bytes.Buffer
+	if err := WriteIGC(&buf, f); err != nil {
+		t.Fatalf("failed to write flight :: %v", err)
+	}
+	expected := "AFLA001\r\nHFSITSITE:EZ SITE\r\n" +
+		"B1600104530000S00615000EA0000000000\r\nF1600200102\r\nE160020PEV\r\n" +
+		"B1600204530000S00615000EA0000000000\r\nLPLTLOG TEXT\r\nGABCDEF\r\n"
+	if buf.String() != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, buf.String())
+	}
+}
+
+const midnightTestIGC = `
+HFDTE311214
+HFTZNTIMEZONE:-3
+F235950040609
+B2359505107126N00149300WA0028800429
+E235958PEV
+B0000105107212N00149174WA0029300435
+K000010
+B0000055107212N00149174WA0029300435
+`
+
+func TestIGCRecordTime(t *testing.T) {
+	f, err := ParseIGC(midnightTestIGC)
+	if err != nil {
+		t.Fatalf("failed to parse flight :: %v", err)
+	}
+	times := []time.Time{
+		time.Date(2014, time.December, 31, 23, 59, 50, 0, time.UTC),
+		time.Date(2015, time.January, 1, 0, 0, 10, 0, time.UTC),
+		time.Date(2015, time.January, 1, 0, 0, 5, 0, time.UTC),
+	}
+	for i, pt := range f.Points {
+		if !pt.Time.Equal(times[i]) || pt.Time.Location() != time.UTC {
+			t.Errorf("expected point time %v but got %v", times[i], pt.Time)
+		}
+	}
+	if _, ok := f.Satellites[times[0]]; !ok {
+		t.Errorf("expected satellites at %v but got %v", times[0], f.Satellites)
+	}
+	if _, ok := f.Events[time.Date(2014, time.December, 31, 23, 59, 58, 0, time.UTC)]; !ok {
+		t.Errorf("expected event before midnight but got %v", f.Events)
+	}
+	if _, ok := f.K[times[1]]; !ok {
+		t.Errorf("expected k record at %v but got %v", times[1], f.K)
+	}
+}
+
+func TestIGCRecordLocalTime(t *testing.T) {
+	d := NewIGCDecoder(strings.NewReader(midnightTestIGC))
+	d.LocalTime = true
+	f, err := d.Decode()
+	if err != nil {
+		t.Fatalf("failed to parse flight :: %v", err)
+	}
+	pt := f.Points[1]
+	if !pt.Time.Equal(time.Date(2015, time.January, 1, 0, 0, 10, 0, time.UTC)) {
+		t.Errorf("wrong point time :: %v", pt.Time)
+	}
+	if _, offset := pt.Time.Zone(); offset != -3*3600 || pt.Time.Day() != 31 {
+		t.Errorf("expected local time but got %v", pt.Time)
+	}
+	var buf bytes.Buffer
+	WriteIGC(&buf, f)
+	if !strings.Contains(buf.String(), "B0000105107212N00149174WA0029300435") {
+		t.Errorf("expected utc times in written flight but got\n%v", buf.String())
+	}
+}
+
 func TestStripUpToMissing(t *testing.T) {
 	s := "nocolonhere"
 	r := stripUpTo(s, ":")
@@ -323,6 +628,24 @@ func TestStripUpToMissing(t *testing.T) {
 	}
 }
 
+func TestIGCParseMinimalFix(t *testing.T) {
+	// B records with no extensions are 35 characters long
+	for _, c := range []string{
+		"B1602455107126N00149300WA0028800429",
+		"B1602455107126N00149300WA0028800429X",
+	} {
+		f, err := ParseIGC("HFDTE010203\n" + c)
+		if err != nil {
+			t.Errorf("failed to parse %v :: %v", c, err)
+		} else if len(f.Points) != 1 || f.Points[0].GNSSAltitude != 429 {
+			t.Errorf("wrong points for %v :: %+v", c, f.Points)
+		}
+	}
+	if _, err := ParseIGC("B1602455107126N00149300WA002880042"); err == nil {
+		t.Errorf("expected error for 34 character fix")
+	}
+}
+
 func BenchmarkIGCParse(b *testing.B) {
 	c, err := ioutil.ReadFile("t/sample-igc")
 	if err != nil {
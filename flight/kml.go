@@ -0,0 +1,160 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package flight
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// altitudeColors are the KML colors (aabbggrr) of the track from the lowest
+// to the highest altitude band.
+var altitudeColors = []string{"ffff0000", "ffffff00", "ff00ff00", "ff00ffff", "ff0080ff", "ff0000ff"}
+
+// WriteKML writes the given flight to w in the KML format, for Google Earth.
+//
+// The track is written as a 3D line extruded to the ground, split in
+// segments colored by altitude (from blue to red). The task, if any, is
+// written as a line over the ground, and the full track as a timestamped
+// gx:Track for replaying the flight.
+func WriteKML(w io.Writer, f Flight, cfg ExportConfig) error {
+	if len(f.Points) == 0 {
+		return errNoPoints
+	}
+	bw := bufio.NewWriter(w)
+	name := f.Header.Pilot
+	if !f.Header.Date.IsZero() {
+		name = name + " " + f.Header.Date.Format("2006-01-02")
+	}
+	fmt.Fprintf(bw, "%v\n", xml.Header+`<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">`)
+	fmt.Fprintf(bw, "<Document>\n<name>%v</name>\n", escape(name))
+	for i, c := range altitudeColors {
+		fmt.Fprintf(bw, "<Style id=\"alt%d\"><LineStyle><color>%v</color><width>2</width></LineStyle>"+
+			"<PolyStyle><color>40%v</color></PolyStyle></Style>\n", i, c, c[2:])
+	}
+	fmt.Fprintf(bw, "<Style id=\"task\"><LineStyle><color>ffffffff</color><width>2</width></LineStyle></Style>\n")
+	fmt.Fprintf(bw, "<Style id=\"replay\"><LineStyle><color>ff00ffff</color><width>2</width></LineStyle></Style>\n")
+
+	writeKMLTrack(bw, f.Points, cfg)
+	writeKMLTask(bw, f.Task)
+
+	fmt.Fprintf(bw, "<Placemark>\n<name>Replay</name>\n<styleUrl>#replay</styleUrl>\n")
+	fmt.Fprintf(bw, "<gx:Track>\n<altitudeMode>absolute</altitudeMode>\n")
+	for _, pt := range f.Points {
+		fmt.Fprintf(bw, "<when>%v</when>\n", pt.Time.UTC().Format(time.RFC3339))
+	}
+	for _, pt := range f.Points {
+		fmt.Fprintf(bw, "<gx:coord>%v %v %v</gx:coord>\n", formatFloat(pt.Longitude),
+			formatFloat(pt.Latitude), cfg.altitude(pt))
+	}
+	fmt.Fprintf(bw, "</gx:Track>\n</Placemark>\n")
+	fmt.Fprintf(bw, "</Document>\n</kml>\n")
+	return bw.Flush()
+}
+
+// writeKMLTrack writes the track placemarks, one for each run of points in
+// the same altitude band. Each segment starts at the end of the previous
+// one, so that the track has no gaps.
+func writeKMLTrack(w io.Writer, pts []Point, cfg ExportConfig) {
+	min, max := cfg.altitude(pts[0]), cfg.altitude(pts[0])
+	for _, pt := range pts {
+		if a := cfg.altitude(pt); a < min {
+			min = a
+		} else if a > max {
+			max = a
+		}
+	}
+	band := func(pt Point) int {
+		return int((cfg.altitude(pt) - min) * int64(len(altitudeColors)) / (max - min + 1))
+	}
+
+	fmt.Fprintf(w, "<Folder>\n<name>Track</name>\n")
+	for start := 0; start < len(pts)-1 || start == 0; {
+		b := band(pts[start])
+		end := start + 1
+		for end < len(pts) && band(pts[end]) == b {
+			end++
+		}
+		fmt.Fprintf(w, "<Placemark>\n<styleUrl>#alt%d</styleUrl>\n<LineString>\n", b)
+		fmt.Fprintf(w, "<extrude>1</extrude>\n<altitudeMode>absolute</altitudeMode>\n<coordinates>\n")
+		for i := start; i <= end && i < len(pts); i++ {
+			fmt.Fprintf(w, "%v,%v,%v\n", formatFloat(pts[i].Longitude), formatFloat(pts[i].Latitude),
+				cfg.altitude(pts[i]))
+		}
+		fmt.Fprintf(w, "</coordinates>\n</LineString>\n</Placemark>\n")
+		start = end
+	}
+	fmt.Fprintf(w, "</Folder>\n")
+}
+
+// writeKMLTask writes the task (start, turnpoints and finish) as a line,
+// if the flight has one.
+func writeKMLTask(w io.Writer, t Task) {
+	pts := []Point{}
+	for _, pt := range append(append([]Point{t.Start}, t.Turnpoints...), t.Finish) {
+		if pt.Latitude != 0 || pt.Longitude != 0 {
+			pts = append(pts, pt)
+		}
+	}
+	if len(pts) < 2 {
+		return
+	}
+	fmt.Fprintf(w, "<Placemark>\n<name>Task</name>\n")
+	if t.Description != "" {
+		fmt.Fprintf(w, "<description>%v</description>\n", escape(t.Description))
+	}
+	fmt.Fprintf(w, "<styleUrl>#task</styleUrl>\n<LineString>\n<tessellate>1</tessellate>\n")
+	fmt.Fprintf(w, "<altitudeMode>clampToGround</altitudeMode>\n<coordinates>\n")
+	for _, pt := range pts {
+		fmt.Fprintf(w, "%v,%v,0\n", formatFloat(pt.Longitude), formatFloat(pt.Latitude))
+	}
+	fmt.Fprintf(w, "</coordinates>\n</LineString>\n</Placemark>\n")
+}
+
+// WriteKMZ writes the given flight to w in the KMZ format, a zip archive
+// with the KML given by WriteKML as doc.kml.
+func WriteKMZ(w io.Writer, f Flight, cfg ExportConfig) error {
+	zw := zip.NewWriter(w)
+	fw, err := zw.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+	if err = WriteKML(fw, f, cfg); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// escape returns s with the XML special characters escaped.
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
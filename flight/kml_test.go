@@ -0,0 +1,110 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package flight
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWriteKML(t *testing.T) {
+	f := exportFlight()
+	f.Task = Task{Description: "100km triangle",
+		Start:      Point{Latitude: 46, Longitude: 6.5},
+		Turnpoints: []Point{Point{Latitude: 46.5, Longitude: 7}, Point{Latitude: 46.5, Longitude: 6}},
+		Finish:     Point{Latitude: 46, Longitude: 6.5},
+	}
+	var buf bytes.Buffer
+	if err := WriteKML(&buf, f, ExportConfig{}); err != nil {
+		t.Fatalf("failed to write flight :: %v", err)
+	}
+	// check it is well formed
+	var doc struct{}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid kml :: %v\n%v", err, buf.String())
+	}
+	kml := buf.String()
+	for _, s := range []string{
+		"<name>Pilot &lt;Test&gt; 2015-07-01</name>",
+		// 1000m and 1100m in the lowest bands, 1300m and 1320m in the highest
+		"<styleUrl>#alt0</styleUrl>\n<LineString>\n<extrude>1</extrude>\n<altitudeMode>absolute</altitudeMode>\n" +
+			"<coordinates>\n6.5,46,1000\n6.5,46.25,1100\n</coordinates>",
+		"<styleUrl>#alt1</styleUrl>\n<LineString>\n<extrude>1</extrude>\n<altitudeMode>absolute</altitudeMode>\n" +
+			"<coordinates>\n6.5,46.25,1100\n6.5,46.5,1300\n</coordinates>",
+		"<styleUrl>#alt5</styleUrl>\n<LineString>\n<extrude>1</extrude>\n<altitudeMode>absolute</altitudeMode>\n" +
+			"<coordinates>\n6.5,46.5,1300\n6.5,46.75,1320\n</coordinates>",
+		"<name>Task</name>\n<description>100km triangle</description>",
+		"<coordinates>\n6.5,46,0\n7,46.5,0\n6,46.5,0\n6.5,46,0\n</coordinates>",
+		"<when>2015-07-01T12:00:30Z</when>",
+		"<gx:coord>6.5 46.75 1320</gx:coord>",
+	} {
+		if !strings.Contains(kml, s) {
+			t.Errorf("missing in kml output :: %v\n%v", s, kml)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteKML(&buf, NewFlight(), ExportConfig{}); err == nil {
+		t.Errorf("expected error writing flight with no points")
+	}
+}
+
+func TestWriteKMLSinglePoint(t *testing.T) {
+	f := exportFlight()
+	f.Points = f.Points[:1]
+	var buf bytes.Buffer
+	if err := WriteKML(&buf, f, ExportConfig{}); err != nil {
+		t.Fatalf("failed to write flight :: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<coordinates>\n6.5,46,1000\n</coordinates>") {
+		t.Errorf("expected track with a single point :: %v", buf.String())
+	}
+	if strings.Contains(buf.String(), "<name>Task</name>") {
+		t.Errorf("expected no task :: %v", buf.String())
+	}
+}
+
+func TestWriteKMZ(t *testing.T) {
+	var buf, kml bytes.Buffer
+	if err := WriteKMZ(&buf, exportFlight(), ExportConfig{}); err != nil {
+		t.Fatalf("failed to write flight :: %v", err)
+	}
+	WriteKML(&kml, exportFlight(), ExportConfig{})
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid kmz :: %v", err)
+	}
+	if len(r.File) != 1 || r.File[0].Name != "doc.kml" {
+		t.Fatalf("expected a single doc.kml in kmz got %v", r.File)
+	}
+	rc, _ := r.File[0].Open()
+	defer rc.Close()
+	content, _ := ioutil.ReadAll(rc)
+	if string(content) != kml.String() {
+		t.Errorf("wrong kml in kmz, expected\n%v\ngot\n%v", kml.String(), string(content))
+	}
+	if err := WriteKMZ(&buf, NewFlight(), ExportConfig{}); err == nil {
+		t.Errorf("expected error writing flight with no points")
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package flight
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// SignatureStatus is the result of validating the G record of a flight.
+type SignatureStatus int
+
+const (
+	// SignatureUnsupported means no validator is available for the
+	// flight manufacturer.
+	SignatureUnsupported SignatureStatus = iota
+	// SignatureValid means the flight content matches its signature.
+	SignatureValid
+	// SignatureInvalid means the flight content does not match its
+	// signature, or the signature is missing.
+	SignatureInvalid
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureValid:
+		return "valid"
+	case SignatureInvalid:
+		return "invalid"
+	default:
+		return "unsupported"
+	}
+}
+
+// Validator is implemented by security algorithms able to check the
+// G record signature of IGC files.
+type Validator interface {
+	// Validate returns true if signature is valid for the given content.
+	Validate(content []byte, signature string) (bool, error)
+}
+
+// Signer is implemented by validators which can also produce signatures.
+type Signer interface {
+	// Sign returns the signature for the given content.
+	Sign(content []byte) (string, error)
+}
+
+// validators holds the registered validators, keyed by manufacturer code,
+// guarded by validatorsMutex.
+var (
+	validators      = map[string]Validator{}
+	validatorsMutex sync.RWMutex
+)
+
+// RegisterValidator sets the validator to use for flights recorded by
+// the given manufacturer. The manufacturer must be one of Manufacturers.
+func RegisterValidator(manufacturer string, v Validator) error {
+	if _, ok := Manufacturers[manufacturer]; !ok {
+		return fmt.Errorf("unknown manufacturer :: %v", manufacturer)
+	}
+	validatorsMutex.Lock()
+	defer validatorsMutex.Unlock()
+	validators[manufacturer] = v
+	return nil
+}
+
+// ValidateIGC checks the G record of the given IGC content, using the
+// validator registered for the manufacturer in its A record.
+func ValidateIGC(r io.Reader) (SignatureStatus, error) {
+	content, signature, err := signedContent(r)
+	if err != nil {
+		return SignatureUnsupported, err
+	}
+	manufacturer := ""
+	if len(content) >= 4 && content[0] == 'A' {
+		manufacturer = string(content[1:4])
+	}
+	return validate(manufacturer, content, signature)
+}
+
+// ValidateFlight checks the signature of the given flight, using the
+// validator registered for its manufacturer.
+//
+// The signed content is taken from the flight as written by WriteIGC, so
+// this is only meaningful for flights signed with SignFlight. Use
+// ValidateIGC for the original recorder files.
+func ValidateFlight(f Flight) (SignatureStatus, error) {
+	content, err := flightContent(f)
+	if err != nil {
+		return SignatureUnsupported, err
+	}
+	return validate(f.Header.Manufacturer, content, f.Signature)
+}
+
+// SignFlight sets the signature of the given flight using s, matching the
+// content checked by ValidateFlight.
+func SignFlight(f *Flight, s Signer) error {
+	content, err := flightContent(*f)
+	if err != nil {
+		return err
+	}
+	f.Signature, err = s.Sign(content)
+	return err
+}
+
+func validate(manufacturer string, content []byte, signature string) (SignatureStatus, error) {
+	validatorsMutex.RLock()
+	v, ok := validators[manufacturer]
+	validatorsMutex.RUnlock()
+	if !ok {
+		return SignatureUnsupported, nil
+	}
+	if signature == "" {
+		return SignatureInvalid, nil
+	}
+	valid, err := v.Validate(content, signature)
+	if err != nil {
+		return SignatureUnsupported, err
+	} else if !valid {
+		return SignatureInvalid, nil
+	}
+	return SignatureValid, nil
+}
+
+// flightContent returns the signed content of the given flight.
+func flightContent(f Flight) ([]byte, error) {
+	var buf bytes.Buffer
+	f.Signature = ""
+	if err := WriteIGC(&buf, f); err != nil {
+		return nil, err
+	}
+	content, _, err := signedContent(&buf)
+	return content, err
+}
+
+// signedContent splits IGC content in the part covered by the signature
+// and the signature itself. The signed content is made of all non empty
+// lines except G records, with line endings removed. The signature is the
+// concatenation of all G records.
+func signedContent(r io.Reader) ([]byte, string, error) {
+	var content bytes.Buffer
+	signature := ""
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, "", err
+		}
+		line = strings.TrimSpace(line)
+		if line != "" && line[0] == 'G' {
+			signature = signature + line[1:]
+		} else if line != "" {
+			content.WriteString(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return content.Bytes(), signature, nil
+}
+
+// LocalValidator validates signatures made with a locally held key. The
+// signature is the hex encoded HMAC-SHA256 of the signed content.
+//
+// It can be registered for any manufacturer whose recorders (or software)
+// share the key, and is also used to re-sign files modified by ezgliding.
+type LocalValidator struct {
+	Key []byte
+}
+
+// Validate returns true if signature is valid for the given content.
+func (v LocalValidator) Validate(content []byte, signature string) (bool, error) {
+	expected, err := v.Sign(content)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))), nil
+}
+
+// Sign returns the signature for the given content.
+func (v LocalValidator) Sign(content []byte) (string, error) {
+	if len(v.Key) == 0 {
+		return "", fmt.Errorf("no key given for local validator")
+	}
+	mac := hmac.New(sha256.New, v.Key)
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// TestKey is the publicly known key used by TestValidator.
+const TestKey = "ezgliding test key"
+
+// TestValidator is a LocalValidator using TestKey. It must only be used
+// for testing, as anyone can produce valid signatures with it.
+var TestValidator = LocalValidator{Key: []byte(TestKey)}
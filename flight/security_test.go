@@ -0,0 +1,126 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package flight
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const securityTestIGC = `AXYY001
+HFDTE010203
+HFPLTPILOTINCHARGE:EZ PILOT
+B1602455107126N00149300WA0028800429
+B1603105107212N00149174WA0029300435
+`
+
+type ValidateTest struct {
+	t string
+	c string
+	r SignatureStatus
+}
+
+func TestValidateIGC(t *testing.T) {
+	if err := RegisterValidator("XYY", TestValidator); err != nil {
+		t.Fatalf("failed to register validator :: %v", err)
+	}
+	defer delete(validators, "XYY")
+	content, _, _ := signedContent(strings.NewReader(securityTestIGC))
+	signature, _ := TestValidator.Sign(content)
+	signed := securityTestIGC + "G" + signature[:32] + "\r\nG" + signature[32:] + "\r\n"
+
+	tests := []ValidateTest{
+		{"valid signature", signed, SignatureValid},
+		{"valid signature with crlf", strings.Replace(signed, "\n", "\r\n", -1), SignatureValid},
+		{"modified fix", strings.Replace(signed, "00429", "00430", 1), SignatureInvalid},
+		{"removed fix", strings.Replace(signed, "B1603105107212N00149174WA0029300435\n", "", 1), SignatureInvalid},
+		{"bad signature", securityTestIGC + "G" + strings.Repeat("0", 64), SignatureInvalid},
+		{"missing signature", securityTestIGC, SignatureInvalid},
+		{"unsupported manufacturer", strings.Replace(signed, "AXYY", "AFLA", 1), SignatureUnsupported},
+		{"missing a record", strings.Replace(signed, "AXYY001\n", "", 1), SignatureUnsupported},
+	}
+	for _, test := range tests {
+		r, err := ValidateIGC(strings.NewReader(test.c))
+		if err != nil {
+			t.Errorf("%v failed :: %v", test.t, err)
+		} else if r != test.r {
+			t.Errorf("%v failed :: expected %v but got %v", test.t, test.r, r)
+		}
+	}
+}
+
+func TestSignFlight(t *testing.T) {
+	if err := RegisterValidator("XYY", TestValidator); err != nil {
+		t.Fatalf("failed to register validator :: %v", err)
+	}
+	defer delete(validators, "XYY")
+	f, err := ParseIGC(securityTestIGC)
+	if err != nil {
+		t.Fatalf("failed to parse flight :: %v", err)
+	}
+	if err = SignFlight(&f, TestValidator); err != nil {
+		t.Fatalf("failed to sign flight :: %v", err)
+	}
+	if r, err := ValidateFlight(f); err != nil || r != SignatureValid {
+		t.Errorf("expected valid signature but got %v %v", r, err)
+	}
+	var buf bytes.Buffer
+	WriteIGC(&buf, f)
+	if r, err := ValidateIGC(&buf); err != nil || r != SignatureValid {
+		t.Errorf("expected valid signature in written file but got %v %v", r, err)
+	}
+	f.Header.Pilot = "ANONYMOUS"
+	if r, err := ValidateFlight(f); err != nil || r != SignatureInvalid {
+		t.Errorf("expected invalid signature but got %v %v", r, err)
+	}
+}
+
+func TestRegisterValidatorUnknown(t *testing.T) {
+	if err := RegisterValidator("ZZZ", TestValidator); err == nil {
+		t.Errorf("expected error registering unknown manufacturer")
+	}
+}
+
+func TestRegisterValidatorConcurrent(t *testing.T) {
+	defer delete(validators, "XYY")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterValidator("XYY", TestValidator)
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := ValidateIGC(strings.NewReader(securityTestIGC)); err != nil {
+				t.Errorf("failed to validate :: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLocalValidatorNoKey(t *testing.T) {
+	if _, err := (LocalValidator{}).Validate([]byte("content"), "signature"); err == nil {
+		t.Errorf("expected error validating without a key")
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package gpx provides functionality to read and write waypoints in the
+// GPS Exchange Format (GPX).
+//
+// Landable points use the Garmin airfield symbols (Airport, Glider Area,
+// Private Field). The attributes with no GPX equivalent (region, flags,
+// runway, ...) are kept in an ezgliding specific extension, ignored by
+// other applications.
+package gpx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const (
+	// Namespace is the GPX 1.1 namespace.
+	Namespace = "http://www.topografix.com/GPX/1/1"
+	// ExtensionNamespace is the namespace of the ezgliding extension.
+	ExtensionNamespace = "http://github.com/rochaporto/ezgliding"
+)
+
+// Garmin symbols for landable points.
+const (
+	symAirport      = "Airport"
+	symGliderArea   = "Glider Area"
+	symPrivateField = "Private Field"
+	symWaypoint     = "Waypoint"
+)
+
+// symbols maps waypoint flags to the corresponding Garmin symbol.
+var symbols = []struct {
+	flag int
+	sym  string
+}{
+	{waypoint.MountainTop, "Summit"},
+	{waypoint.Mast, "Tall Tower"},
+	{waypoint.Dam, "Dam"},
+	{waypoint.Tunnel, "Tunnel"},
+	{waypoint.Bridge, "Bridge"},
+}
+
+// document is the root of a GPX file.
+type document struct {
+	XMLName   xml.Name `xml:"gpx"`
+	Xmlns     string   `xml:"xmlns,attr,omitempty"`
+	Version   string   `xml:"version,attr"`
+	Creator   string   `xml:"creator,attr"`
+	Waypoints []wpt    `xml:"wpt"`
+}
+
+// wpt is a single waypoint.
+type wpt struct {
+	Latitude   float64     `xml:"lat,attr"`
+	Longitude  float64     `xml:"lon,attr"`
+	Elevation  float64     `xml:"ele,omitempty"`
+	Time       string      `xml:"time,omitempty"`
+	Name       string      `xml:"name"`
+	Desc       string      `xml:"desc,omitempty"`
+	Sym        string      `xml:"sym,omitempty"`
+	Extensions *extensions `xml:"extensions"`
+}
+
+type extensions struct {
+	Point *point `xml:"http://github.com/rochaporto/ezgliding point"`
+}
+
+// point holds the ezgliding attributes of a waypoint.
+type point struct {
+	ID        string  `xml:"id,omitempty"`
+	Region    string  `xml:"region,omitempty"`
+	ICAO      string  `xml:"icao,omitempty"`
+	Flags     int     `xml:"flags,omitempty"`
+	Catalog   int     `xml:"catalog,omitempty"`
+	Runway    string  `xml:"runway,omitempty"`
+	Length    int     `xml:"length,omitempty"`
+	Frequency float64 `xml:"frequency,omitempty"`
+}
+
+// Parse parses the given GPX content, returning the landable points as
+// airfields and all others as waypoints. Routes and tracks are ignored.
+//
+// Documents can be in UTF-8 or ISO-8859-1 (Latin-1), as written by some
+// older GPS tools.
+func Parse(content []byte) ([]airfield.Airfield, []waypoint.Waypoint, error) {
+	doc := document{}
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.CharsetReader = charsetReader
+	if err := d.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid gpx document :: %v", err)
+	}
+	airfields := []airfield.Airfield{}
+	waypoints := []waypoint.Waypoint{}
+	for _, w := range doc.Waypoints {
+		if w.Latitude < -90 || w.Latitude > 90 || w.Longitude < -180 || w.Longitude > 180 {
+			return nil, nil, fmt.Errorf("waypoint %v :: invalid position %v %v", w.Name, w.Latitude, w.Longitude)
+		}
+		var update time.Time
+		if w.Time != "" {
+			t, err := time.Parse(time.RFC3339, w.Time)
+			if err != nil {
+				return nil, nil, fmt.Errorf("waypoint %v :: invalid time %v", w.Name, w.Time)
+			}
+			update = t.UTC()
+		}
+		p := point{}
+		if w.Extensions != nil && w.Extensions.Point != nil {
+			p = *w.Extensions.Point
+		}
+		if p.ID == "" {
+			p.ID = w.Name
+		}
+		elevation := int(math.Floor(w.Elevation + 0.5))
+
+		switch w.Sym {
+		case symAirport, symGliderArea, symPrivateField:
+			if p.Flags == 0 {
+				p.Flags = symToAirfield(w.Sym)
+			}
+			airfields = append(airfields, airfield.Airfield{ID: p.ID, ShortName: p.ID, Name: w.Name,
+				Region: p.Region, ICAO: p.ICAO, Flags: p.Flags, Catalog: p.Catalog, Length: p.Length, Elevation: elevation,
+				Runway: p.Runway, Frequency: p.Frequency, Latitude: w.Latitude, Longitude: w.Longitude,
+				Update: update})
+		default:
+			if p.Flags == 0 {
+				p.Flags = symToWaypoint(w.Sym)
+			}
+			waypoints = append(waypoints, waypoint.Waypoint{ID: p.ID, Name: w.Name, Description: w.Desc,
+				Region: p.Region, Flags: p.Flags, Elevation: elevation, Latitude: w.Latitude,
+				Longitude: w.Longitude, Update: update})
+		}
+	}
+	return airfields, waypoints, nil
+}
+
+// charsetReader converts ISO-8859-1 (Latin-1) input to UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1":
+	default:
+		return nil, fmt.Errorf("unsupported charset :: %v", charset)
+	}
+	content, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(util.DecodeLatin1(content)), nil
+}
+
+func symToAirfield(sym string) int {
+	switch sym {
+	case symGliderArea:
+		return airfield.GliderSite
+	case symPrivateField:
+		return airfield.Outlanding
+	}
+	return 0
+}
+
+func airfieldToSym(flags int) string {
+	switch {
+	case flags&airfield.Outlanding != 0:
+		return symPrivateField
+	case flags&airfield.GliderSite != 0:
+		return symGliderArea
+	}
+	return symAirport
+}
+
+func symToWaypoint(sym string) int {
+	for _, s := range symbols {
+		if strings.EqualFold(s.sym, sym) {
+			return s.flag
+		}
+	}
+	return 0
+}
+
+func waypointToSym(flags int) string {
+	for _, s := range symbols {
+		if flags&s.flag != 0 {
+			return s.sym
+		}
+	}
+	return symWaypoint
+}
+
+// Detect returns true if the given content looks like a GPX document.
+func Detect(content []byte) bool {
+	return strings.Contains(string(content), "<gpx")
+}
+
+// Write writes the given airfields and waypoints as a GPX 1.1 document.
+func Write(w io.Writer, airfields []airfield.Airfield, waypoints []waypoint.Waypoint) error {
+	doc := document{Xmlns: Namespace, Version: "1.1", Creator: "ezgliding"}
+	for _, a := range airfields {
+		doc.Waypoints = append(doc.Waypoints, wpt{Latitude: a.Latitude, Longitude: a.Longitude,
+			Elevation: float64(a.Elevation), Time: formatTime(a.Update), Name: a.Name,
+			Sym: airfieldToSym(a.Flags), Extensions: &extensions{&point{ID: a.ShortName, Region: a.Region,
+				ICAO: a.ICAO, Flags: a.Flags, Catalog: a.Catalog, Runway: a.Runway, Length: a.Length,
+				Frequency: a.Frequency}}})
+	}
+	for _, wp := range waypoints {
+		doc.Waypoints = append(doc.Waypoints, wpt{Latitude: wp.Latitude, Longitude: wp.Longitude,
+			Elevation: float64(wp.Elevation), Time: formatTime(wp.Update), Name: wp.Name, Desc: wp.Description,
+			Sym: waypointToSym(wp.Flags), Extensions: &extensions{&point{ID: wp.ID, Region: wp.Region,
+				Flags: wp.Flags}}})
+	}
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package gpx
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="GPSBabel" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="45.560833" lon="5.97695">
+    <ele>296.4</ele>
+    <time>2015-01-01T12:00:00Z</time>
+    <name>Challes</name>
+    <sym>Glider Area</sym>
+  </wpt>
+  <wpt lat="45.5" lon="6">
+    <name>Chambery Sud</name>
+    <sym>Private Field</sym>
+  </wpt>
+  <wpt lat="45.829167" lon="6.864444">
+    <ele>4808</ele>
+    <name>Mont Blanc</name>
+    <desc>Summit</desc>
+    <sym>Summit</sym>
+  </wpt>
+  <wpt lat="-45.5" lon="-6.25">
+    <name>Start</name>
+  </wpt>
+  <trk><name>ignored</name></trk>
+</gpx>
+`
+
+func TestParse(t *testing.T) {
+	airfields, waypoints, err := Parse([]byte(testGPX))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	ea := []airfield.Airfield{
+		airfield.Airfield{ID: "Challes", ShortName: "Challes", Name: "Challes", Flags: airfield.GliderSite,
+			Elevation: 296, Latitude: 45.560833, Longitude: 5.97695,
+			Update: time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC)},
+		airfield.Airfield{ID: "Chambery Sud", ShortName: "Chambery Sud", Name: "Chambery Sud",
+			Flags: airfield.Outlanding, Latitude: 45.5, Longitude: 6},
+	}
+	ew := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "Mont Blanc", Name: "Mont Blanc", Description: "Summit", Flags: waypoint.MountainTop,
+			Elevation: 4808, Latitude: 45.829167, Longitude: 6.864444},
+		waypoint.Waypoint{ID: "Start", Name: "Start", Latitude: -45.5, Longitude: -6.25},
+	}
+	if !reflect.DeepEqual(airfields, ea) {
+		t.Errorf("expected %+v got %+v", ea, airfields)
+	}
+	if !reflect.DeepEqual(waypoints, ew) {
+		t.Errorf("expected %+v got %+v", ew, waypoints)
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	content := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<gpx version=\"1.1\"><wpt lat=\"45.5\" lon=\"6\"><name>Col de l'Iseran \xe9t\xe9</name></wpt></gpx>"
+	_, waypoints, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse latin-1 content :: %v", err)
+	}
+	if len(waypoints) != 1 || waypoints[0].Name != "Col de l'Iseran \u00e9t\u00e9" {
+		t.Errorf("wrong waypoints parsed :: %+v", waypoints)
+	}
+}
+
+var parseErrorTests = []struct {
+	t       string
+	content string
+}{
+	{"invalid xml", "<gpx><wpt></gpx>"},
+	{"invalid latitude", `<gpx><wpt lat="95" lon="6"><name>A</name></wpt></gpx>`},
+	{"invalid longitude", `<gpx><wpt lat="45" lon="x"><name>A</name></wpt></gpx>`},
+	{"invalid time", `<gpx><wpt lat="45" lon="6"><time>yesterday</time><name>A</name></wpt></gpx>`},
+	{"unsupported charset", `<?xml version="1.0" encoding="UTF-16"?><gpx></gpx>`},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		if _, _, err := Parse([]byte(test.content)); err == nil {
+			t.Errorf("%v :: expected error but got success", test.t)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	airfields := []airfield.Airfield{
+		airfield.Airfield{ID: "LFLE", ShortName: "LFLE", Name: "Challes", Region: "FR", ICAO: "LFLE",
+			Flags: airfield.GliderSite | airfield.Grass, Catalog: 5, Length: 620, Elevation: 296, Runway: "1836",
+			Frequency: 122.5, Latitude: 45.560833, Longitude: 5.97695,
+			Update: time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	waypoints := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "DAM", Name: "Roselend & Dam", Description: "Lake", Region: "FR",
+			Flags: waypoint.Dam, Elevation: 1560, Latitude: 45.68, Longitude: 6.62},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, airfields, waypoints); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="ezgliding">
+  <wpt lat="45.560833" lon="5.97695">
+    <ele>296</ele>
+    <time>2015-01-01T12:00:00Z</time>
+    <name>Challes</name>
+    <sym>Glider Area</sym>
+    <extensions>
+      <point xmlns="http://github.com/rochaporto/ezgliding">
+        <id>LFLE</id>
+        <region>FR</region>
+        <icao>LFLE</icao>
+        <flags>1032</flags>
+        <catalog>5</catalog>
+        <runway>1836</runway>
+        <length>620</length>
+        <frequency>122.5</frequency>
+      </point>
+    </extensions>
+  </wpt>
+  <wpt lat="45.68" lon="6.62">
+    <ele>1560</ele>
+    <name>Roselend &amp; Dam</name>
+    <desc>Lake</desc>
+    <sym>Dam</sym>
+    <extensions>
+      <point xmlns="http://github.com/rochaporto/ezgliding">
+        <id>DAM</id>
+        <region>FR</region>
+        <flags>64</flags>
+      </point>
+    </extensions>
+  </wpt>
+</gpx>
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, buf.String())
+	}
+	ra, rw, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written content :: %v", err)
+	}
+	if !reflect.DeepEqual(ra, airfields) || !reflect.DeepEqual(rw, waypoints) {
+		t.Errorf("round trip failed :: expected %+v %+v got %+v %+v", airfields, waypoints, ra, rw)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if !Detect([]byte(testGPX)) {
+		t.Errorf("expected gpx content to be detected")
+	}
+	if Detect([]byte("OziExplorer Waypoint File Version 1.1\nWGS 84\n")) {
+		t.Errorf("expected ozi content not to be detected")
+	}
+}
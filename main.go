@@ -40,8 +40,13 @@ func main() {
 		Commands: []*commander.Command{
 			cli.CmdAirfieldGet,
 			cli.CmdAirfieldPut,
+			cli.CmdAirspaceCheck,
+			cli.CmdAirspaceConvert,
 			cli.CmdAirspaceGet,
+			cli.CmdFlightExport,
 			cli.CmdFlightGet,
+			cli.CmdFlightStats,
+			cli.CmdWaypointConvert,
 			cli.CmdWaypointGet,
 			cli.CmdWaypointPut,
 			cli.CmdWeb,
@@ -0,0 +1,313 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package openaip provides functionality for parsing and writing airspace
+// information in the OpenAIP XML format.
+//
+// The format is described at http://www.openaip.net.
+package openaip
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/spatial"
+)
+
+// categories maps the OpenAIP airspace categories which are not a class
+// letter to the corresponding (OpenAir) class.
+var categories = map[string]byte{
+	"CTR":        'C',
+	"DANGER":     'Q',
+	"RESTRICTED": 'R',
+	"PROHIBITED": 'P',
+	"GLIDING":    'W',
+	"WAVE":       'W',
+}
+
+// document is the root of an OpenAIP file.
+type document struct {
+	XMLName    xml.Name `xml:"OPENAIP"`
+	Version    string   `xml:"VERSION,attr,omitempty"`
+	DataFormat string   `xml:"DATAFORMAT,attr,omitempty"`
+	Airspaces  []asp    `xml:"AIRSPACES>ASP"`
+}
+
+// asp is a single airspace definition.
+type asp struct {
+	Category string   `xml:"CATEGORY,attr"`
+	Version  string   `xml:"VERSION,omitempty"`
+	ID       string   `xml:"ID,omitempty"`
+	Country  string   `xml:"COUNTRY,omitempty"`
+	Name     string   `xml:"NAME"`
+	Top      altLimit `xml:"ALTLIMIT_TOP"`
+	Bottom   altLimit `xml:"ALTLIMIT_BOTTOM"`
+	Polygon  string   `xml:"GEOMETRY>POLYGON"`
+}
+
+// altLimit is a vertical limit, with reference one of MSL, GND or STD
+// and unit one of F, FL or M.
+type altLimit struct {
+	Reference string `xml:"REFERENCE,attr"`
+	Alt       struct {
+		Unit  string `xml:"UNIT,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"ALT"`
+}
+
+// Fetch gets and returns the airspace definitions at the given location
+// Both http URIs and local (relative or absolute) paths are supported.
+func Fetch(location string) ([]airspace.Airspace, error) {
+	var content []byte
+
+	resp, err := http.Get(location)
+	// case http
+	if err == nil {
+		defer resp.Body.Close()
+		content, err = ioutil.ReadAll(resp.Body)
+	} else { // case file
+		content, err = ioutil.ReadFile(location)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Parse(content)
+}
+
+// Parse parses the content given, retrieving the corresponding array
+// of Airspace objects.
+//
+// OpenAIP geometries are always polygons, resulting in airspaces with
+// only Polygon segments. The category is kept in Type.
+func Parse(content []byte) ([]airspace.Airspace, error) {
+	var doc document
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("invalid openaip document :: %v", err)
+	}
+	result := []airspace.Airspace{}
+	for _, a := range doc.Airspaces {
+		aspace, err := parseAirspace(a)
+		if err != nil {
+			return nil, fmt.Errorf("airspace %v :: %v", a.Name, err)
+		}
+		result = append(result, aspace)
+	}
+	return result, nil
+}
+
+// parseAirspace converts the given OpenAIP airspace.
+func parseAirspace(a asp) (airspace.Airspace, error) {
+	var err error
+	category := strings.ToUpper(strings.TrimSpace(a.Category))
+	if category == "" {
+		return airspace.Airspace{}, fmt.Errorf("missing category")
+	}
+	result := airspace.Airspace{ID: a.ID, Name: strings.TrimSpace(a.Name), Type: category,
+		Class: class(category)}
+	if result.FloorAltitude, err = parseAltLimit(a.Bottom); err != nil {
+		return airspace.Airspace{}, err
+	}
+	if result.CeilingAltitude, err = parseAltLimit(a.Top); err != nil {
+		return airspace.Airspace{}, err
+	}
+	result.Floor, result.Ceiling = result.FloorAltitude.String(), result.CeilingAltitude.String()
+
+	points := strings.Split(a.Polygon, ",")
+	for i, p := range points {
+		values := strings.Fields(p)
+		if len(values) != 2 {
+			return airspace.Airspace{}, fmt.Errorf("invalid polygon point :: %v", p)
+		}
+		lon, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return airspace.Airspace{}, fmt.Errorf("invalid longitude :: %v", values[0])
+		}
+		lat, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return airspace.Airspace{}, fmt.Errorf("invalid latitude :: %v", values[1])
+		}
+		c := spatial.FormatLatitude(lat, spatial.OpenAirDecimal) + " " + spatial.FormatLongitude(lon, spatial.OpenAirDecimal)
+		// the polygon is closed, skip the last point
+		if i == len(points)-1 && len(result.Segments) > 0 && c == result.Segments[0].Coordinate1 {
+			break
+		}
+		result.Segments = append(result.Segments, airspace.Segment{
+			Type: airspace.Polygon, Clockwise: true, Coordinate1: c})
+	}
+	if len(result.Segments) < 3 {
+		return airspace.Airspace{}, fmt.Errorf("polygon with less than 3 points")
+	}
+	return result, nil
+}
+
+// parseAltLimit converts the given OpenAIP vertical limit.
+func parseAltLimit(l altLimit) (airspace.Altitude, error) {
+	result := airspace.Altitude{}
+	v, err := strconv.ParseFloat(strings.TrimSpace(l.Alt.Value), 64)
+	if err != nil {
+		return result, fmt.Errorf("invalid altitude :: %v", l.Alt.Value)
+	}
+	result.Value = v
+	switch strings.ToUpper(l.Alt.Unit) {
+	case "F", "FT":
+		result.Unit = airspace.Feet
+	case "FL":
+		result.Unit = airspace.FlightLevel
+	case "M":
+		result.Unit = airspace.Meters
+	default:
+		return result, fmt.Errorf("invalid altitude unit :: %v", l.Alt.Unit)
+	}
+	switch strings.ToUpper(l.Reference) {
+	case "MSL":
+		result.Reference = airspace.AMSL
+	case "GND":
+		result.Reference = airspace.AGL
+		if v == 0 {
+			result = airspace.Altitude{Reference: airspace.SFC}
+		}
+	case "STD":
+		result.Reference = airspace.STD
+	default:
+		return result, fmt.Errorf("invalid altitude reference :: %v", l.Reference)
+	}
+	return result, nil
+}
+
+// Write writes the given airspaces in the OpenAIP format.
+//
+// Arcs and circles are resolved to polygons, with a vertex every
+// spatial.DefaultArcResolution degrees.
+func Write(w io.Writer, airspaces []airspace.Airspace) error {
+	doc := document{DataFormat: "1.1"}
+	for _, a := range airspaces {
+		aspace, err := writeAirspace(a)
+		if err != nil {
+			return fmt.Errorf("airspace %v :: %v", a.Name, err)
+		}
+		doc.Airspaces = append(doc.Airspaces, aspace)
+	}
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// writeAirspace converts the given airspace to OpenAIP.
+func writeAirspace(a airspace.Airspace) (asp, error) {
+	result := asp{ID: a.ID, Name: a.Name, Category: category(a)}
+	if result.Category == "" {
+		return asp{}, fmt.Errorf("missing class")
+	}
+	var err error
+	if result.Bottom, err = altLimitFor(a.Floor, a.FloorAltitude); err != nil {
+		return asp{}, err
+	}
+	if result.Top, err = altLimitFor(a.Ceiling, a.CeilingAltitude); err != nil {
+		return asp{}, err
+	}
+	polygon, err := spatial.AirspacePolygon(a, spatial.DefaultArcResolution)
+	if err != nil {
+		return asp{}, err
+	}
+	points := make([]string, len(polygon))
+	for i, p := range polygon {
+		points[i] = formatFloat(p.Longitude) + " " + formatFloat(p.Latitude)
+	}
+	result.Polygon = strings.Join(points, ", ")
+	return result, nil
+}
+
+// class returns the class for the given OpenAIP category, the first
+// letter for the categories not in categories (as in OpenAir).
+func class(category string) byte {
+	if c, ok := categories[category]; ok {
+		return c
+	}
+	return category[0]
+}
+
+// category returns the OpenAIP category for the given airspace, the type
+// if it matches the class or one derived from the class otherwise.
+func category(a airspace.Airspace) string {
+	if t := strings.ToUpper(a.Type); t != "" && class(t) == a.Class {
+		return t
+	}
+	switch {
+	case a.Class >= 'A' && a.Class <= 'G':
+		return string(a.Class)
+	case a.Class == 'Q':
+		return "DANGER"
+	case a.Class == 'R':
+		return "RESTRICTED"
+	case a.Class == 'P':
+		return "PROHIBITED"
+	case a.Class == 'W':
+		return "WAVE"
+	case a.Class == 0:
+		return ""
+	}
+	return "OTH"
+}
+
+// altLimitFor converts the given altitude to an OpenAIP vertical limit.
+// Meters are converted to feet, and UNL is given as FL999. Unknown
+// altitudes have no OpenAIP notation and return an error with the raw text.
+func altLimitFor(raw string, a airspace.Altitude) (altLimit, error) {
+	result := altLimit{}
+	if a.Reference == airspace.Unknown {
+		return result, fmt.Errorf("unknown altitude :: %v", raw)
+	}
+	value, unit := a.Value, "F"
+	switch a.Unit {
+	case airspace.FlightLevel:
+		unit = "FL"
+	case airspace.Meters:
+		value = float64(int(a.Value/0.3048 + 0.5))
+	}
+	switch a.Reference {
+	case airspace.SFC:
+		result.Reference, value, unit = "GND", 0, "F"
+	case airspace.UNL:
+		result.Reference, value, unit = "STD", 999, "FL"
+	case airspace.AGL:
+		result.Reference = "GND"
+	case airspace.STD:
+		result.Reference = "STD"
+	default:
+		result.Reference = "MSL"
+	}
+	result.Alt.Unit, result.Alt.Value = unit, formatFloat(value)
+	return result, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,221 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package openaip
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/spatial"
+)
+
+const testOpenAIP = `<?xml version="1.0" encoding="UTF-8"?>
+<OPENAIP VERSION="367810a0f94887bf79cd9432d2a01142b0426795" DATAFORMAT="1.1">
+<AIRSPACES>
+  <ASP CATEGORY="CTR">
+    <VERSION>a7e8a6a3b4d3a4c1e4b0b0e7f2d4b5a9c9e8d7f6</VERSION>
+    <ID>150464</ID>
+    <COUNTRY>CH</COUNTRY>
+    <NAME>CTR GENEVE</NAME>
+    <ALTLIMIT_TOP REFERENCE="MSL">
+      <ALT UNIT="F">4500</ALT>
+    </ALTLIMIT_TOP>
+    <ALTLIMIT_BOTTOM REFERENCE="GND">
+      <ALT UNIT="F">0</ALT>
+    </ALTLIMIT_BOTTOM>
+    <GEOMETRY>
+      <POLYGON>6.0 46.0, 6.5 46.0, 6.5 46.5, 6.0 46.0</POLYGON>
+    </GEOMETRY>
+  </ASP>
+  <ASP CATEGORY="D">
+    <ID>150465</ID>
+    <NAME>TMA GENEVE 1</NAME>
+    <ALTLIMIT_TOP REFERENCE="STD">
+      <ALT UNIT="FL">195</ALT>
+    </ALTLIMIT_TOP>
+    <ALTLIMIT_BOTTOM REFERENCE="GND">
+      <ALT UNIT="M">300</ALT>
+    </ALTLIMIT_BOTTOM>
+    <GEOMETRY>
+      <POLYGON>6.1 46.1, 6.2 46.1, 6.2 46.2, 6.1 46.2</POLYGON>
+    </GEOMETRY>
+  </ASP>
+</AIRSPACES>
+</OPENAIP>
+`
+
+func polygon(coordinates ...string) []airspace.Segment {
+	result := []airspace.Segment{}
+	for _, c := range coordinates {
+		result = append(result, airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: c})
+	}
+	return result
+}
+
+var testAirspaces = []airspace.Airspace{
+	airspace.Airspace{
+		ID: "150464", Class: 'C', Name: "CTR GENEVE", Type: "CTR",
+		Floor: "SFC", Ceiling: "4500FT AMSL",
+		FloorAltitude:   airspace.Altitude{Reference: airspace.SFC},
+		CeilingAltitude: airspace.Altitude{Value: 4500},
+		Segments: polygon("46:00:00 N 006:00:00 E", "46:00:00 N 006:30:00 E",
+			"46:30:00 N 006:30:00 E"),
+	},
+	airspace.Airspace{
+		ID: "150465", Class: 'D', Name: "TMA GENEVE 1", Type: "D",
+		Floor: "300M AGL", Ceiling: "FL195",
+		FloorAltitude:   airspace.Altitude{Value: 300, Unit: airspace.Meters, Reference: airspace.AGL},
+		CeilingAltitude: airspace.Altitude{Value: 195, Unit: airspace.FlightLevel, Reference: airspace.STD},
+		Segments: polygon("46:06:00 N 006:06:00 E", "46:06:00 N 006:12:00 E",
+			"46:12:00 N 006:12:00 E", "46:12:00 N 006:06:00 E"),
+	},
+}
+
+func TestParse(t *testing.T) {
+	result, err := Parse([]byte(testOpenAIP))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if !reflect.DeepEqual(result, testAirspaces) {
+		t.Errorf("wrong airspaces, expected\n%+v\ngot\n%+v", testAirspaces, result)
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	// points which are not whole seconds are kept to the millisecond
+	c := strings.Replace(testOpenAIP, "6.0 46.0, 6.5 46.0", "6.123456 46.654321, 6.5 46.0", 1)
+	result, err := Parse([]byte(c))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	lat, lon, err := spatial.ParsePosition(result[0].Segments[0].Coordinate1)
+	if err != nil || math.Abs(lat-46.654321) > 1e-6 || math.Abs(lon-6.123456) > 1e-6 {
+		t.Errorf("expected 46.654321 6.123456 got %v %v :: %v", lat, lon, err)
+	}
+}
+
+type ParseErrorTest struct {
+	t string
+	c string
+}
+
+var parseErrorTests = []ParseErrorTest{
+	{"not xml", "AC A"},
+	{"missing category", `<OPENAIP><AIRSPACES><ASP></ASP></AIRSPACES></OPENAIP>`},
+	{"bad altitude", `<OPENAIP><AIRSPACES><ASP CATEGORY="A">
+<ALTLIMIT_BOTTOM REFERENCE="MSL"><ALT UNIT="F">abc</ALT></ALTLIMIT_BOTTOM></ASP></AIRSPACES></OPENAIP>`},
+	{"bad altitude unit", `<OPENAIP><AIRSPACES><ASP CATEGORY="A">
+<ALTLIMIT_BOTTOM REFERENCE="MSL"><ALT UNIT="X">100</ALT></ALTLIMIT_BOTTOM></ASP></AIRSPACES></OPENAIP>`},
+	{"bad altitude reference", `<OPENAIP><AIRSPACES><ASP CATEGORY="A">
+<ALTLIMIT_BOTTOM REFERENCE="X"><ALT UNIT="F">100</ALT></ALTLIMIT_BOTTOM></ASP></AIRSPACES></OPENAIP>`},
+	{"bad polygon", `<OPENAIP><AIRSPACES><ASP CATEGORY="A">
+<ALTLIMIT_TOP REFERENCE="STD"><ALT UNIT="FL">100</ALT></ALTLIMIT_TOP>
+<ALTLIMIT_BOTTOM REFERENCE="MSL"><ALT UNIT="F">100</ALT></ALTLIMIT_BOTTOM>
+<GEOMETRY><POLYGON>6.0 46.0, 6.5, 6.0 46.0</POLYGON></GEOMETRY></ASP></AIRSPACES></OPENAIP>`},
+	{"short polygon", `<OPENAIP><AIRSPACES><ASP CATEGORY="A">
+<ALTLIMIT_TOP REFERENCE="STD"><ALT UNIT="FL">100</ALT></ALTLIMIT_TOP>
+<ALTLIMIT_BOTTOM REFERENCE="MSL"><ALT UNIT="F">100</ALT></ALTLIMIT_BOTTOM>
+<GEOMETRY><POLYGON>6.0 46.0, 6.5 46.0, 6.0 46.0</POLYGON></GEOMETRY></ASP></AIRSPACES></OPENAIP>`},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		if _, err := Parse([]byte(test.c)); err == nil {
+			t.Errorf("%v failed :: expected an error", test.t)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testAirspaces); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	if !strings.Contains(buf.String(), `<ASP CATEGORY="CTR">`) {
+		t.Errorf("missing CTR category in output :: %v", buf.String())
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written airspace :: %v", err)
+	}
+	expected := append([]airspace.Airspace{}, testAirspaces...)
+	// meters are written in feet
+	expected[1].Floor = "984FT AGL"
+	expected[1].FloorAltitude = airspace.Altitude{Value: 984, Reference: airspace.AGL}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("wrong airspaces, expected\n%+v\ngot\n%+v", expected, result)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	circle := airspace.Airspace{Class: 'Q', Name: "D1", Type: "DANGER",
+		FloorAltitude: airspace.Altitude{Value: 2000}, CeilingAltitude: airspace.Altitude{Reference: airspace.UNL},
+		Segments: []airspace.Segment{airspace.Segment{Type: airspace.Circle, X: "46:00:00 N 006:00:00 E", Radius: 2}}}
+	var buf bytes.Buffer
+	if err := Write(&buf, []airspace.Airspace{circle}); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written airspace :: %v", err)
+	}
+	if len(result) != 1 || result[0].Class != 'Q' || result[0].Type != "DANGER" || len(result[0].Segments) != 72 {
+		t.Errorf("wrong circle airspace :: %+v", result)
+	}
+	if result[0].Ceiling != "FL999" {
+		t.Errorf("expected UNL as FL999 got %v", result[0].Ceiling)
+	}
+
+	for _, a := range []airspace.Airspace{
+		airspace.Airspace{Name: "no class"},
+		airspace.Airspace{Class: 'A', Name: "no segments"},
+		airspace.Airspace{Class: 'A', Name: "unknown floor", Floor: "ask ATC",
+			FloorAltitude: airspace.Altitude{Reference: airspace.Unknown}, Segments: circle.Segments},
+	} {
+		if err := Write(&buf, []airspace.Airspace{a}); err == nil {
+			t.Errorf("expected error writing %v", a.Name)
+		}
+	}
+}
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		a airspace.Airspace
+		r string
+	}{
+		{airspace.Airspace{Class: 'C', Type: "CTR"}, "CTR"},
+		{airspace.Airspace{Class: 'D', Type: "CTR"}, "D"},
+		{airspace.Airspace{Class: 'T', Type: "TMZ"}, "TMZ"},
+		{airspace.Airspace{Class: 'R'}, "RESTRICTED"},
+		{airspace.Airspace{Class: 'Q'}, "DANGER"},
+		{airspace.Airspace{Class: 'P'}, "PROHIBITED"},
+		{airspace.Airspace{Class: 'W'}, "WAVE"},
+		{airspace.Airspace{Class: 'X'}, "OTH"},
+	}
+	for _, test := range tests {
+		if r := category(test.a); r != test.r {
+			t.Errorf("expected category %v for %+v got %v", test.r, test.a, r)
+		}
+	}
+}
@@ -33,13 +33,12 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/golang/glog"
 	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/util"
 )
 
-// Local temporary storage for airspace pen/brush types
-// Key is the airspace class, value in the Pen object
-var airspacePens = map[byte]airspace.Pen{}
-
 // Fetch gets and returns the airspace definitions at the given location
 // Both http URIs and local (relative or absolute) paths are supported.
 func Fetch(location string) ([]airspace.Airspace, error) {
@@ -61,19 +60,25 @@ func Fetch(location string) ([]airspace.Airspace, error) {
 
 // Parse parses the content given, retrieving the corresponding array
 // of Airspace objects.
+//
+// Both the original and the extended (AY, AF, AG, AA) formats are
+// supported. Terrain elements (TO, TC) are skipped.
+//
+// Pens (SP) and brushes (SB) apply only to the airspace declaring them.
+//
+// Parse keeps no state between calls, and is safe for concurrent use.
 func Parse(content []byte) ([]airspace.Airspace, error) {
-	items := strings.Split(string(content), "*\n")
-	result := []airspace.Airspace{}
-	for i := range items {
-		airspace, found, err := parseSingle([]byte(items[i]))
-		if err != nil {
-			return nil, err
-		}
-		if found {
-			result = append(result, airspace)
+	p := parser{clockwise: true}
+	for _, t := range tokenize(content) {
+		if err := p.parseRecord(t); err != nil {
+			return nil, util.ParseError{Line: t.line, Err: err}
 		}
 	}
-	return result, nil
+	p.flush()
+	if p.result == nil {
+		return []airspace.Airspace{}, nil
+	}
+	return p.result, nil
 }
 
 // styleToAirspace converts the given value to the corresponding enum
@@ -91,86 +96,281 @@ func styleToAirspace(value int) airspace.PenStyle {
 	}
 }
 
-// parseSingle expects a single airspace definition in the content object,
-// returning the corresponding Airspace object.
-// It is usually called by Parse.
-func parseSingle(content []byte) (airspace.Airspace, bool, error) {
-	var aspace airspace.Airspace
-	var x string
-	var clockwise bool
-	found := false
-
-	lines := strings.Split(string(content), "\n")
-	for i := range lines {
-		line := strings.Trim(lines[i], " ")
+// record is a single line of an OpenAir file, split in key and value.
+type record struct {
+	line  int
+	key   string
+	value string
+}
+
+// tokenize splits the given content in records, dropping empty lines and
+// comments. Lines can end in LF or CRLF.
+func tokenize(content []byte) []record {
+	result := []record{}
+	lines := strings.Split(strings.TrimPrefix(string(content), "\ufeff"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
 		if len(line) == 0 || line[0] == '*' { // comment or empty
 			continue
 		}
-		elems := strings.SplitN(line, " ", 2)
-		key, value := elems[0], elems[1]
-		switch key {
-		case "AC":
-			aspace.Class = value[0]
-			aspace.Pen = airspacePens[aspace.Class]
-		case "AN":
-			found = true
-			aspace.Name = strings.Trim(value, " ")
-		case "AL":
-			aspace.Floor = value
-		case "AH":
-			aspace.Ceiling = value
-		case "DA":
-			values := strings.Split(value, ",")
-			angleStart, _ := strconv.ParseFloat(values[1], 64)
-			angleEnd, _ := strconv.ParseFloat(values[2], 64)
-			radius, _ := strconv.ParseFloat(values[0], 64)
-			aspace.Segments = append(aspace.Segments,
-				airspace.Segment{Type: airspace.Arc, X: x, Clockwise: clockwise,
-					Radius: radius, AngleStart: angleStart, AngleEnd: angleEnd})
-		case "DB":
-			values := strings.Split(value, ",")
-			aspace.Segments = append(aspace.Segments,
-				airspace.Segment{Type: airspace.Arc, X: x, Clockwise: clockwise,
-					Coordinate1: values[0], Coordinate2: values[1]})
-		case "DC":
-			radius, _ := strconv.ParseFloat(value, 64)
-			aspace.Segments = append(aspace.Segments,
-				airspace.Segment{Type: airspace.Circle, X: x, Clockwise: clockwise,
-					Radius: radius})
-		case "DP":
-			aspace.Segments = append(aspace.Segments,
-				airspace.Segment{Type: airspace.Polygon, X: x, Clockwise: clockwise, Coordinate1: value})
-		case "V":
-			splitequals := strings.Split(value, "=")
-			varkey := splitequals[0]
-			varvalue := strings.Trim(splitequals[1], " ")
-			switch varkey {
-			case "X":
-				x = varvalue
-			case "D":
-				clockwise = (varvalue == "+")
-			}
-		case "SP": // pen to draw (including color)
-			split := strings.Split(value, ",")
-			width, _ := strconv.Atoi(split[1])
-			r, _ := strconv.Atoi(split[2])
-			g, _ := strconv.Atoi(split[3])
-			b, _ := strconv.Atoi(split[4])
-			airspacePens[aspace.Class] = airspace.Pen{
-				Style: airspace.Solid, Width: width,
-				Color:       color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: 1.0},
-				InsideColor: color.RGBA64{},
-			}
-		case "SB": // brush to draw (color) TODO:
-			//split := strings.Split(value, ",")
-			//r, _ := strconv.Atoi(split[0])
-			//g, _ := strconv.Atoi(split[1])
-			//b, _ := strconv.Atoi(split[2])
-			//airspacePens[airspace.Class].InsideColor = color.RGBA64{}
-		default:
-			return airspace.Airspace{}, false, fmt.Errorf("Unrecognized key '%v' in '%v'", key, line)
-		}
-	}
-
-	return aspace, found, nil
+		r := record{line: i + 1}
+		if n := strings.IndexAny(line, " \t"); n != -1 {
+			r.key, r.value = line[:n], strings.TrimSpace(line[n:])
+		} else {
+			r.key = line
+		}
+		r.key = strings.ToUpper(r.key)
+		// names can contain '*', for other records it starts a comment
+		if n := strings.Index(r.value, "*"); n != -1 && r.key != "AN" {
+			r.value = strings.TrimSpace(r.value[:n])
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// parser keeps the state while parsing an OpenAir file.
+//
+// The center (X), direction and width are reset on each new airspace,
+// with clockwise being the default direction.
+type parser struct {
+	result    []airspace.Airspace
+	current   *airspace.Airspace
+	found     bool
+	terrain   bool
+	x         string
+	clockwise bool
+	width     int
+}
+
+// flush adds the current airspace to the result, if it has a name.
+func (p *parser) flush() {
+	if p.current != nil && p.found {
+		p.result = append(p.result, *p.current)
+	}
+	p.current, p.found, p.terrain = nil, false, false
+	p.x, p.clockwise, p.width = "", true, 0
+}
+
+// parseRecord updates the parser state with the given record.
+func (p *parser) parseRecord(r record) error {
+	switch r.key {
+	case "AC", "TO", "TC", "V", "SP", "SB":
+	default:
+		if p.terrain {
+			return nil
+		}
+		if p.current == nil {
+			return fmt.Errorf("record %v outside an airspace (missing AC)", r.key)
+		}
+	}
+	if r.value == "" {
+		return fmt.Errorf("record %v with no value", r.key)
+	}
+
+	var err error
+	aspace := p.current
+	switch r.key {
+	case "AC":
+		p.flush()
+		p.current = &airspace.Airspace{Class: r.value[0]}
+	case "TO", "TC":
+		p.flush()
+		p.terrain = true
+	case "AN":
+		p.found = true
+		aspace.Name = r.value
+	case "AY":
+		aspace.Type = r.value
+	case "AF":
+		if aspace.Frequency, err = strconv.ParseFloat(strings.Fields(r.value)[0], 64); err != nil {
+			return fmt.Errorf("invalid frequency :: %v", r.value)
+		}
+	case "AG":
+		aspace.Station = r.value
+	case "AA":
+		aspace.Activations = append(aspace.Activations, r.value)
+	case "AT":
+		if err = checkPosition(r.value); err != nil {
+			return err
+		}
+		aspace.Label = append(aspace.Label, r.value)
+	case "AL":
+		aspace.Floor = r.value
+		aspace.FloorAltitude = limit(r)
+	case "AH":
+		aspace.Ceiling = r.value
+		aspace.CeilingAltitude = limit(r)
+	case "DA":
+		values, err := parseFloats(r.value, 3)
+		if err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, p.segment(airspace.Segment{Type: airspace.Arc,
+			Radius: values[0], AngleStart: values[1], AngleEnd: values[2]}))
+	case "DB":
+		values := strings.Split(r.value, ",")
+		if len(values) != 2 {
+			return fmt.Errorf("expected 2 coordinates :: %v", r.value)
+		}
+		c1, c2 := strings.TrimSpace(values[0]), strings.TrimSpace(values[1])
+		if err = checkPosition(c1); err != nil {
+			return err
+		}
+		if err = checkPosition(c2); err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, p.segment(airspace.Segment{Type: airspace.Arc,
+			Coordinate1: c1, Coordinate2: c2}))
+	case "DC":
+		values, err := parseFloats(r.value, 1)
+		if err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, p.segment(airspace.Segment{Type: airspace.Circle,
+			Radius: values[0]}))
+	case "DP", "DY":
+		if err = checkPosition(r.value); err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, p.segment(airspace.Segment{Type: airspace.Polygon,
+			Coordinate1: r.value}))
+	case "V":
+		return p.parseVariable(r.value)
+	case "SP": // pen to draw (style, width and color)
+		values, err := parseInts(r.value, 5)
+		if err != nil {
+			return err
+		}
+		c, err := parseColor(values[2:])
+		if err != nil {
+			return err
+		}
+		if p.current != nil {
+			p.current.Pen.Style, p.current.Pen.Width = styleToAirspace(values[0]), values[1]
+			p.current.Pen.Color = c
+		}
+	case "SB": // brush to fill (color)
+		values, err := parseInts(r.value, 3)
+		if err != nil {
+			return err
+		}
+		c, err := parseColor(values)
+		if err != nil {
+			return err
+		}
+		if p.current != nil {
+			p.current.Pen.InsideColor = c
+		}
+	default:
+		return fmt.Errorf("unrecognized key '%v'", r.key)
+	}
+	return nil
+}
+
+// limit parses the vertical limit in the given record. Limits which
+// can't be parsed (as in "FL95 (ask ATC)") are logged and left Unknown,
+// being still available as text in Floor and Ceiling.
+func limit(r record) airspace.Altitude {
+	a, err := airspace.ParseAltitude(r.value)
+	if err != nil {
+		glog.Warningf("line %d :: %v", r.line, err)
+	}
+	return a
+}
+
+// parseVariable handles the V records (X, D, W and Z variables).
+func (p *parser) parseVariable(value string) error {
+	split := strings.SplitN(value, "=", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("invalid variable :: %v", value)
+	}
+	key, v := strings.ToUpper(strings.TrimSpace(split[0])), strings.TrimSpace(split[1])
+	switch key {
+	case "X":
+		if err := checkPosition(v); err != nil {
+			return err
+		}
+		p.x = v
+	case "D":
+		if !strings.HasPrefix(v, "+") && !strings.HasPrefix(v, "-") {
+			return fmt.Errorf("invalid direction :: %v", v)
+		}
+		p.clockwise = v[0] == '+'
+	case "W":
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid width :: %v", v)
+		}
+		p.width = int(w)
+	case "Z": // zoom level, for display only
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("invalid zoom :: %v", v)
+		}
+	default:
+		return fmt.Errorf("unknown variable :: %v", key)
+	}
+	return nil
+}
+
+// segment fills the given segment with the current center, direction and
+// width.
+func (p *parser) segment(s airspace.Segment) airspace.Segment {
+	s.X, s.Clockwise, s.W = p.x, p.clockwise, p.width
+	return s
+}
+
+// parseColor converts the given red, green and blue values to an opaque
+// color. All values set to -1 mean no color (transparent), returning nil.
+func parseColor(values []int) (color.Color, error) {
+	if values[0] == -1 && values[1] == -1 && values[2] == -1 {
+		return nil, nil
+	}
+	for _, v := range values {
+		if v < 0 || v > 255 {
+			return nil, fmt.Errorf("invalid color :: %v", values)
+		}
+	}
+	return color.RGBA{R: uint8(values[0]), G: uint8(values[1]), B: uint8(values[2]), A: 255}, nil
+}
+
+// checkPosition returns an error if the given value is not a valid
+// coordinate pair.
+func checkPosition(value string) error {
+	_, _, err := spatial.ParsePosition(value)
+	return err
+}
+
+// parseFloats parses n comma separated numbers.
+func parseFloats(value string, n int) ([]float64, error) {
+	split := strings.Split(value, ",")
+	if len(split) != n {
+		return nil, fmt.Errorf("expected %d values :: %v", n, value)
+	}
+	result := make([]float64, n)
+	for i := range split {
+		v, err := strconv.ParseFloat(strings.TrimSpace(split[i]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value :: %v", split[i])
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// parseInts parses n comma separated integers.
+func parseInts(value string, n int) ([]int, error) {
+	split := strings.Split(value, ",")
+	if len(split) != n {
+		return nil, fmt.Errorf("expected %d values :: %v", n, value)
+	}
+	result := make([]int, n)
+	for i := range split {
+		v, err := strconv.Atoi(strings.TrimSpace(split[i]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value :: %v", split[i])
+		}
+		result[i] = v
+	}
+	return result, nil
 }
@@ -26,9 +26,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/util"
 )
 
 type ParseTest struct {
@@ -57,6 +59,8 @@ DA 10,270,290`,
 			airspace.Airspace{
 				Class: 'A', Name: "TMA GENEVE partie  2",
 				Floor: "5500FT AMSL", Ceiling: "FL 185",
+				FloorAltitude:   airspace.Altitude{Value: 5500},
+				CeilingAltitude: airspace.Altitude{Value: 185, Unit: airspace.FlightLevel, Reference: airspace.STD},
 				Segments: []airspace.Segment{
 					airspace.Segment{
 						Type: airspace.Arc, X: "46:03:03 N 005:47:12 E", Clockwise: true,
@@ -93,6 +97,8 @@ DP 46:10:24 N 005:39:42 E
 			airspace.Airspace{
 				Class: 'A', Name: "TMA GENEVE partie  2",
 				Floor: "5500FT AMSL", Ceiling: "FL 185",
+				FloorAltitude:   airspace.Altitude{Value: 5500},
+				CeilingAltitude: airspace.Altitude{Value: 185, Unit: airspace.FlightLevel, Reference: airspace.STD},
 				Segments: []airspace.Segment{
 					airspace.Segment{
 						Type: airspace.Arc, X: "46:03:03 N 005:47:12 E", Clockwise: true,
@@ -127,9 +133,11 @@ DP 46:10:24 N 005:39:42 E`,
 			airspace.Airspace{
 				Class: 'C', Name: "TMA GENEVE partie  1",
 				Floor: "3500FT AMSL", Ceiling: "FL 195",
+				FloorAltitude:   airspace.Altitude{Value: 3500},
+				CeilingAltitude: airspace.Altitude{Value: 195, Unit: airspace.FlightLevel, Reference: airspace.STD},
 				Segments: []airspace.Segment{
 					airspace.Segment{
-						Type: airspace.Polygon, Clockwise: false,
+						Type: airspace.Polygon, Clockwise: true,
 						Coordinate1: "46:22:03 N 006:33:04 E",
 					},
 				},
@@ -137,6 +145,8 @@ DP 46:10:24 N 005:39:42 E`,
 			airspace.Airspace{
 				Class: 'A', Name: "TMA GENEVE partie  2",
 				Floor: "5500FT AMSL", Ceiling: "FL 185",
+				FloorAltitude:   airspace.Altitude{Value: 5500},
+				CeilingAltitude: airspace.Altitude{Value: 185, Unit: airspace.FlightLevel, Reference: airspace.STD},
 				Segments: []airspace.Segment{
 					airspace.Segment{
 						Type: airspace.Arc, X: "46:03:03 N 005:47:12 E", Clockwise: false,
@@ -152,12 +162,11 @@ DP 46:10:24 N 005:39:42 E`,
 	},
 	{"airspace with colors",
 		`
-AC C
-SP 0,2,0,0,255
-SB -1,-1,-1
 *
 AC C
 AN TMA GENEVE partie  1
+SP 0,2,0,0,255
+SB -1,-1,-1
 AH FL 195
 AL 3500FT AMSL
 DP 46:22:03 N 006:33:04 E
@@ -166,16 +175,17 @@ DP 46:22:03 N 006:33:04 E
 			airspace.Airspace{
 				Class: 'C', Name: "TMA GENEVE partie  1",
 				Floor: "3500FT AMSL", Ceiling: "FL 195",
+				FloorAltitude:   airspace.Altitude{Value: 3500},
+				CeilingAltitude: airspace.Altitude{Value: 195, Unit: airspace.FlightLevel, Reference: airspace.STD},
 				Segments: []airspace.Segment{
 					airspace.Segment{
-						Type: airspace.Polygon, Clockwise: false,
+						Type: airspace.Polygon, Clockwise: true,
 						Coordinate1: "46:22:03 N 006:33:04 E",
 					},
 				},
 				Pen: airspace.Pen{
 					Style: airspace.Solid, Width: 2,
-					Color:       color.RGBA64{R: 0, G: 0, B: 255, A: 1.0},
-					InsideColor: color.RGBA64{},
+					Color: color.RGBA{R: 0, G: 0, B: 255, A: 255},
 				},
 			},
 		},
@@ -270,3 +280,200 @@ func BenchmarkParse(b *testing.B) {
 		}
 	}
 }
+
+func TestParseExtended(t *testing.T) {
+	content := "* extended format\r\n" +
+		"AC D\r\n" +
+		"AY CTR\r\n" +
+		"AN CTR Test *\r\n" +
+		"AF 118.750\r\n" +
+		"AG Test Tower\r\n" +
+		"AA 2015-07-01T08:00Z/2015-07-01T16:00Z\r\n" +
+		"AA 2015-07-02T08:00Z/2015-07-02T16:00Z\r\n" +
+		"AL SFC\r\n" +
+		"AH 3500FT AMSL  * inline comment\r\n" +
+		"AT 46:00:00 N 006:00:00 E\r\n" +
+		"  * indented comment\r\n" +
+		"V X=46:00:00 N 006:00:00 E\r\n" +
+		"DC 5\r\n" +
+		"TC Lake\r\n" +
+		"SP 0,1,0,0,255\r\n" +
+		"SB 200,200,255\r\n" +
+		"V Z=100\r\n" +
+		"DP 46:10:00 N 006:00:00 E\r\n" +
+		"DP 46:10:00 N 006:10:00 E\r\n"
+	result, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	expected := []airspace.Airspace{
+		airspace.Airspace{
+			Class: 'D', Type: "CTR", Name: "CTR Test *", Frequency: 118.75, Station: "Test Tower",
+			Activations: []string{"2015-07-01T08:00Z/2015-07-01T16:00Z", "2015-07-02T08:00Z/2015-07-02T16:00Z"},
+			Floor:       "SFC", Ceiling: "3500FT AMSL",
+			FloorAltitude:   airspace.Altitude{Reference: airspace.SFC},
+			CeilingAltitude: airspace.Altitude{Value: 3500},
+			Label:           []string{"46:00:00 N 006:00:00 E"},
+			Segments: []airspace.Segment{
+				airspace.Segment{Type: airspace.Circle, X: "46:00:00 N 006:00:00 E",
+					Clockwise: true, Radius: 5},
+			},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("wrong result\nr: %+v\ne: %+v", result, expected)
+	}
+}
+
+func TestParseAirway(t *testing.T) {
+	result, err := Parse([]byte("AC A\nAN Airway\nV W=5\nDY 46:00:00 N 006:00:00 E\n"))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if len(result) != 1 || result[0].Segments[0].W != 5 {
+		t.Errorf("wrong airway result :: %+v", result)
+	}
+}
+
+type ParseErrorTest struct {
+	t    string
+	c    string
+	line int
+}
+
+var parseErrorTests = []ParseErrorTest{
+	{"key with no value", "AC A\nAN", 2},
+	{"record before AC", "* comment\nAN Test", 2},
+	{"short DA", "AC A\nV X=46:00:00 N 006:00:00 E\nDA 10,270", 3},
+	{"bad DA value", "AC A\nDA 10,a,290", 2},
+	{"short DB", "AC A\nDB 46:00:00 N 006:00:00 E", 2},
+	{"bad DB coordinate", "AC A\nDB 46:00:00 N 006:00:00 E,46:00 X", 2},
+	{"bad DC", "AC A\nDC ten", 2},
+	{"bad DP", "AC A\n\r\nDP 46:00:00 N", 3},
+	{"short SP", "AC A\nSP 0,1", 2},
+	{"bad SB", "AC A\nSB 1,2,a", 2},
+	{"SP color out of range", "AC A\nSP 0,1,0,256,0", 2},
+	{"SB color out of range", "AC A\nSB 0,-1,0", 2},
+	{"bad variable", "AC A\nV X", 2},
+	{"unknown variable", "AC A\nV Q=1", 2},
+	{"bad direction", "AC A\nV D=x", 2},
+	{"bad center", "AC A\nV X=abc", 2},
+	{"bad width", "AC A\nV W=a", 2},
+	{"bad zoom", "AC A\nV Z=a", 2},
+	{"bad frequency", "AC A\nAF abc", 2},
+	{"bad label", "AC A\nAT abc", 2},
+	{"unknown key", "AC A\nAN Test\n\nNN 1.0", 4},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		_, err := Parse([]byte(test.c))
+		perr, ok := err.(util.ParseError)
+		if !ok {
+			t.Errorf("%v failed :: expected parse error got %v", test.t, err)
+			continue
+		}
+		if perr.Line != test.line {
+			t.Errorf("%v failed :: expected error in line %v got %v", test.t, test.line, perr)
+		}
+	}
+}
+
+func TestParseUnknownAltitude(t *testing.T) {
+	result, err := Parse([]byte("AC A\nAN Test\nAL FL 95 (ask ATC)\nAH 1000 2000\nDP 45:00:00 N 006:00:00 E\n"))
+	if err != nil {
+		t.Fatalf("failed to parse airspace with unknown limits :: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected 1 airspace got %v", len(result))
+	}
+	a := result[0]
+	if a.Floor != "FL 95 (ask ATC)" || a.Ceiling != "1000 2000" {
+		t.Errorf("expected raw limits to be kept got %v and %v", a.Floor, a.Ceiling)
+	}
+	if a.FloorAltitude.Reference != airspace.Unknown || a.CeilingAltitude.Reference != airspace.Unknown {
+		t.Errorf("expected unknown altitudes got %v and %v", a.FloorAltitude, a.CeilingAltitude)
+	}
+}
+
+func TestParseFull(t *testing.T) {
+	content, _ := ioutil.ReadFile("./test-airspace.txt")
+	result, err := Parse(content)
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if len(result) != 1263 {
+		t.Errorf("expected 1263 airspaces got %v", len(result))
+	}
+}
+
+func TestParsePens(t *testing.T) {
+	content := `
+AC C
+SP 1,2,0,0,255
+SB -1,-1,-1
+AC C
+AN TMA 1
+DP 46:22:03 N 006:33:04 E
+AC C
+AN TMA 2
+SP 0,3,255,0,0
+SB 0,255,0
+DP 46:22:03 N 006:33:04 E
+AC C
+AN TMA 3
+DP 46:22:03 N 006:33:04 E
+AC D
+AN CTR
+DP 46:22:03 N 006:33:04 E
+`
+	// pens apply only to the airspace declaring them
+	expected := []airspace.Pen{
+		airspace.Pen{},
+		airspace.Pen{Style: airspace.Solid, Width: 3, Color: color.RGBA{R: 255, G: 0, B: 0, A: 255},
+			InsideColor: color.RGBA{R: 0, G: 255, B: 0, A: 255}},
+		airspace.Pen{},
+		airspace.Pen{},
+	}
+	result, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("expected %v airspaces got %v", len(expected), len(result))
+	}
+	for i := range result {
+		if !reflect.DeepEqual(result[i].Pen, expected[i]) {
+			t.Errorf("wrong pen for %v :: expected %+v got %+v", result[i].Name, expected[i], result[i].Pen)
+		}
+	}
+
+	// pens should not leak to other parse calls
+	result, err = Parse([]byte("AC C\nAN TMA\nDP 46:22:03 N 006:33:04 E"))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if !reflect.DeepEqual(result[0].Pen, airspace.Pen{}) {
+		t.Errorf("expected no pen got %+v", result[0].Pen)
+	}
+}
+
+func TestParseConcurrent(t *testing.T) {
+	content, _ := ioutil.ReadFile("./test-airspace.txt")
+	expected, err := Parse(content)
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := Parse(content)
+			if err != nil || !reflect.DeepEqual(result, expected) {
+				t.Errorf("concurrent parse gave a different result :: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
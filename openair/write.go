@@ -0,0 +1,155 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package openair
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+
+	"github.com/rochaporto/ezgliding/airspace"
+)
+
+// Write writes the given airspaces in the OpenAir format, in a way that
+// parsing the result gives back the same airspaces.
+//
+// Records end in CRLF, as expected by most flight computers.
+func Write(w io.Writer, airspaces []airspace.Airspace) error {
+	bw := bufio.NewWriter(w)
+	for i, a := range airspaces {
+		if i > 0 {
+			fmt.Fprintf(bw, "\r\n")
+		}
+		if err := writeAirspace(bw, a); err != nil {
+			return fmt.Errorf("airspace %v :: %v", a.Name, err)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeAirspace writes a single airspace definition.
+func writeAirspace(w io.Writer, a airspace.Airspace) error {
+	record := func(key string, value interface{}) {
+		fmt.Fprintf(w, "%v %v\r\n", key, value)
+	}
+	if a.Class == 0 {
+		return fmt.Errorf("missing class")
+	}
+	record("AC", string(a.Class))
+	if a.Type != "" {
+		record("AY", a.Type)
+	}
+	record("AN", a.Name)
+	if a.Frequency != 0 {
+		record("AF", formatFloat(a.Frequency))
+	}
+	if a.Station != "" {
+		record("AG", a.Station)
+	}
+	for _, v := range a.Activations {
+		record("AA", v)
+	}
+	record("AL", altitude(a.Floor, a.FloorAltitude))
+	record("AH", altitude(a.Ceiling, a.CeilingAltitude))
+	for _, l := range a.Label {
+		record("AT", l)
+	}
+	if a.Pen.Color != nil || a.Pen.Style != airspace.Solid || a.Pen.Width != 0 {
+		r, g, b := rgb(a.Pen.Color)
+		record("SP", fmt.Sprintf("%d,%d,%d,%d,%d", styleToOpenAir(a.Pen.Style), a.Pen.Width, r, g, b))
+	}
+	if a.Pen.InsideColor != nil {
+		r, g, b := rgb(a.Pen.InsideColor)
+		record("SB", fmt.Sprintf("%d,%d,%d", r, g, b))
+	}
+
+	// the parser starts each airspace with no center, clockwise and no width
+	x, clockwise, width := "", true, 0
+	for _, s := range a.Segments {
+		if s.X != x && s.X != "" {
+			x = s.X
+			record("V", "X="+x)
+		}
+		if s.Clockwise != clockwise {
+			clockwise = s.Clockwise
+			if clockwise {
+				record("V", "D=+")
+			} else {
+				record("V", "D=-")
+			}
+		}
+		if s.W != width {
+			width = s.W
+			record("V", "W="+strconv.Itoa(width))
+		}
+		switch s.Type {
+		case airspace.Polygon:
+			record("DP", s.Coordinate1)
+		case airspace.Arc:
+			if s.Coordinate1 != "" {
+				record("DB", s.Coordinate1+","+s.Coordinate2)
+			} else {
+				record("DA", formatFloat(s.Radius)+","+formatFloat(s.AngleStart)+","+formatFloat(s.AngleEnd))
+			}
+		case airspace.Circle:
+			record("DC", formatFloat(s.Radius))
+		default:
+			return fmt.Errorf("unknown segment type :: %v", s.Type)
+		}
+	}
+	return nil
+}
+
+// altitude returns the raw altitude if available, or the parsed one.
+func altitude(raw string, a airspace.Altitude) string {
+	if raw != "" {
+		return raw
+	}
+	return a.String()
+}
+
+// styleToOpenAir converts the given pen style to the OpenAir value, the
+// reverse of styleToAirspace.
+func styleToOpenAir(style airspace.PenStyle) int {
+	switch style {
+	case airspace.Solid:
+		return 0
+	case airspace.Dash:
+		return 1
+	default:
+		return 5
+	}
+}
+
+// rgb returns the 8 bit red, green and blue components of the color, or
+// -1 for all if there is no color (transparent).
+func rgb(c color.Color) (int, int, int) {
+	if c == nil {
+		return -1, -1, -1
+	}
+	rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return int(rgba.R), int(rgba.G), int(rgba.B)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package openair
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rochaporto/ezgliding/airspace"
+)
+
+func TestWrite(t *testing.T) {
+	airspaces := []airspace.Airspace{
+		airspace.Airspace{
+			Class: 'D', Type: "CTR", Name: "CTR Test", Frequency: 118.75, Station: "Test Tower",
+			Activations: []string{"2015-07-01T08:00Z/2015-07-01T16:00Z"},
+			Floor:       "SFC", CeilingAltitude: airspace.Altitude{Value: 3500},
+			Label: []string{"46:00:00 N 006:00:00 E"},
+			Pen: airspace.Pen{Style: airspace.Dash, Width: 2,
+				Color:       color.RGBA{R: 255, G: 0, B: 0, A: 255},
+				InsideColor: color.RGBA{R: 0, G: 128, B: 255, A: 255}},
+			Segments: []airspace.Segment{
+				airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:10:00 N 006:00:00 E"},
+				airspace.Segment{Type: airspace.Arc, X: "46:00:00 N 006:00:00 E", Clockwise: false,
+					Coordinate1: "46:10:00 N 006:00:00 E", Coordinate2: "46:00:00 N 006:10:00 E"},
+				airspace.Segment{Type: airspace.Arc, X: "46:00:00 N 006:00:00 E", Clockwise: false,
+					Radius: 10, AngleStart: 90, AngleEnd: 0.5},
+			},
+		},
+		airspace.Airspace{
+			Class: 'R', Name: "R1", Floor: "FL65", Ceiling: "UNL",
+			Segments: []airspace.Segment{
+				airspace.Segment{Type: airspace.Circle, X: "45:00:00 N 006:00:00 E", Clockwise: true, Radius: 1.5},
+			},
+		},
+	}
+	expected := "AC D\r\nAY CTR\r\nAN CTR Test\r\nAF 118.75\r\nAG Test Tower\r\n" +
+		"AA 2015-07-01T08:00Z/2015-07-01T16:00Z\r\nAL SFC\r\nAH 3500FT AMSL\r\n" +
+		"AT 46:00:00 N 006:00:00 E\r\nSP 1,2,255,0,0\r\nSB 0,128,255\r\n" +
+		"DP 46:10:00 N 006:00:00 E\r\nV X=46:00:00 N 006:00:00 E\r\nV D=-\r\n" +
+		"DB 46:10:00 N 006:00:00 E,46:00:00 N 006:10:00 E\r\nDA 10,90,0.5\r\n" +
+		"\r\n" +
+		"AC R\r\nAN R1\r\nAL FL65\r\nAH UNL\r\nV X=45:00:00 N 006:00:00 E\r\nDC 1.5\r\n"
+	var buf bytes.Buffer
+	if err := Write(&buf, airspaces); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("wrong output, expected\n%v\ngot\n%v", expected, buf.String())
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, []airspace.Airspace{airspace.Airspace{Name: "no class"}}); err == nil {
+		t.Errorf("expected error for airspace with no class")
+	}
+	bad := airspace.Airspace{Class: 'A', Name: "bad segment",
+		Segments: []airspace.Segment{airspace.Segment{Type: airspace.SegmentType(10)}}}
+	if err := Write(&buf, []airspace.Airspace{bad}); err == nil {
+		t.Errorf("expected error for unknown segment type")
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	content, _ := ioutil.ReadFile("./test-airspace.txt")
+	original, err := Parse(content)
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, original); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written airspace :: %v", err)
+	}
+	if len(result) != len(original) {
+		t.Fatalf("expected %v airspaces got %v", len(original), len(result))
+	}
+	for i := range original {
+		if !reflect.DeepEqual(result[i], original[i]) {
+			t.Errorf("airspace %v differs\nr: %+v\ne: %+v", i, result[i], original[i])
+		}
+	}
+	if strings.Count(buf.String(), "\r\n") < 10000 {
+		t.Errorf("expected CRLF line endings")
+	}
+}
+
+func TestWriteRoundTripPens(t *testing.T) {
+	pen := airspace.Pen{Style: airspace.Dash, Width: 2, Color: color.RGBA{R: 255, G: 0, B: 0, A: 255}}
+	original := []airspace.Airspace{}
+	noColor := airspace.Pen{Style: airspace.None, Width: 1}
+	for i, p := range []airspace.Pen{airspace.Pen{}, pen, airspace.Pen{}, pen, airspace.Pen{}, noColor, airspace.Pen{Width: 3}} {
+		original = append(original, airspace.Airspace{Class: 'C', Name: fmt.Sprintf("TMA %d", i), Pen: p,
+			Segments: []airspace.Segment{
+				airspace.Segment{Type: airspace.Circle, X: "45:00:00 N 006:00:00 E", Clockwise: true, Radius: 1.5},
+			}})
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, original); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written airspace :: %v", err)
+	}
+	if len(result) != len(original) {
+		t.Fatalf("expected %v airspaces got %v", len(original), len(result))
+	}
+	for i := range original {
+		if !reflect.DeepEqual(result[i].Pen, original[i].Pen) {
+			t.Errorf("wrong pen for %v :: expected %+v got %+v", original[i].Name, original[i].Pen, result[i].Pen)
+		}
+	}
+	if !strings.Contains(buf.String(), "SP 5,1,-1,-1,-1\r\n") || !strings.Contains(buf.String(), "SP 0,3,-1,-1,-1\r\n") {
+		t.Errorf("expected pens with no color to be written got\n%v", buf.String())
+	}
+}
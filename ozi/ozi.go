@@ -0,0 +1,160 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package ozi provides functionality to read and write waypoints in the
+// OziExplorer waypoint format (.wpt).
+//
+// Only the WGS 84 datum is supported. The format has no notion of landable
+// points, so airfields are written as plain waypoints. Files are written in
+// ISO-8859-1, as expected by OziExplorer.
+package ozi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const (
+	header = "OziExplorer Waypoint File Version 1.1"
+	datum  = "WGS 84"
+	// noAltitude is the altitude value for points with no altitude.
+	noAltitude = -777
+	// comma replaces commas in descriptions, as done by OziExplorer.
+	comma = "Ñ"
+)
+
+// epoch is the start of the Delphi TDateTime used for dates, in days.
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Parse parses the given OziExplorer waypoint content.
+//
+// The four header lines are required, with the datum in the second one.
+// Each record holds at least the number, name, latitude and longitude, and
+// optionally the date, description and altitude (in feet).
+func Parse(content []byte) ([]waypoint.Waypoint, error) {
+	lines := strings.Split(util.DecodeText(content), "\n")
+	if len(lines) < 4 || !Detect(content) {
+		return nil, util.ParseError{Line: 1, Err: fmt.Errorf("missing header")}
+	}
+	if d := strings.TrimSpace(lines[1]); !strings.EqualFold(d, datum) {
+		return nil, util.ParseError{Line: 2, Err: fmt.Errorf("unsupported datum :: %v", d)}
+	}
+	waypoints := []waypoint.Waypoint{}
+	for i := 4; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		wp, err := parseRecord(line)
+		if err != nil {
+			return nil, util.ParseError{Line: i + 1, Err: err}
+		}
+		waypoints = append(waypoints, wp)
+	}
+	return waypoints, nil
+}
+
+// parseRecord parses a single waypoint record.
+func parseRecord(line string) (waypoint.Waypoint, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 4 {
+		return waypoint.Waypoint{}, fmt.Errorf("expected at least 4 fields :: %v", line)
+	}
+	lat, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil || math.Abs(lat) > 90 {
+		return waypoint.Waypoint{}, fmt.Errorf("invalid latitude :: %v", fields[2])
+	}
+	lon, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil || math.Abs(lon) > 180 {
+		return waypoint.Waypoint{}, fmt.Errorf("invalid longitude :: %v", fields[3])
+	}
+	wp := waypoint.Waypoint{ID: fields[1], Name: fields[1], Latitude: lat, Longitude: lon}
+	if len(fields) > 4 && fields[4] != "" {
+		days, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return waypoint.Waypoint{}, fmt.Errorf("invalid date :: %v", fields[4])
+		}
+		if days != 0 {
+			wp.Update = epoch.Add(time.Duration(days * 24 * float64(time.Hour))).Round(time.Second)
+		}
+	}
+	if len(fields) > 10 {
+		wp.Description = strings.Replace(fields[10], comma, ",", -1)
+	}
+	if len(fields) > 14 && fields[14] != "" {
+		alt, err := strconv.ParseFloat(fields[14], 64)
+		if err != nil {
+			return waypoint.Waypoint{}, fmt.Errorf("invalid altitude :: %v", fields[14])
+		}
+		if alt != noAltitude {
+			wp.Elevation = int(math.Floor(alt*0.3048 + 0.5))
+		}
+	}
+	return wp, nil
+}
+
+// Detect returns true if the given content has the OziExplorer waypoint
+// file header.
+func Detect(content []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(util.DecodeText(content)), "OziExplorer Waypoint File")
+}
+
+// Write writes the given airfields and waypoints in the OziExplorer
+// waypoint format, numbered from 1 in the given order. Records end in
+// CRLF.
+func Write(w io.Writer, airfields []airfield.Airfield, waypoints []waypoint.Waypoint) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v\r\n%v\r\nReserved 2\r\nReserved 3\r\n", header, datum)
+	n := 1
+	for _, a := range airfields {
+		writeRecord(&buf, n, waypoint.Waypoint{Name: a.Name, Description: a.ShortName,
+			Elevation: a.Elevation, Latitude: a.Latitude, Longitude: a.Longitude, Update: a.Update})
+		n++
+	}
+	for _, wp := range waypoints {
+		writeRecord(&buf, n, wp)
+		n++
+	}
+	_, err := w.Write(util.EncodeLatin1(buf.String()))
+	return err
+}
+
+// writeRecord writes a single waypoint record, with the default symbol,
+// colors and font.
+func writeRecord(w io.Writer, n int, wp waypoint.Waypoint) {
+	date := ""
+	if !wp.Update.IsZero() {
+		date = strconv.FormatFloat(wp.Update.Sub(epoch).Hours()/24, 'f', 7, 64)
+	}
+	fmt.Fprintf(w, "%d,%v,%.6f,%.6f,%v,0,1,3,0,65535,%v,0,0,0,%d,6,0,17\r\n", n,
+		strings.Replace(wp.Name, ",", " ", -1), wp.Latitude, wp.Longitude, date,
+		strings.Replace(wp.Description, ",", comma, -1), int(math.Floor(float64(wp.Elevation)/0.3048+0.5)))
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package ozi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const testWpt = `OziExplorer Waypoint File Version 1.1
+WGS 84
+Reserved 2
+garmin
+1,Challes,  45.560833,   5.976950,42005.5000000,0,1,3,0,65535,LFLEÑ glider site,0,0,0,971,6,0,17
+2,Galibier,  45.063883,   6.408050,,0,1,3,0,65535,,0,0,0,-777,6,0,17
+3,Minimal,-45.5,-6.25
+`
+
+func TestParse(t *testing.T) {
+	waypoints, err := Parse([]byte(strings.Replace(testWpt, "\n", "\r\n", -1)))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	expected := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "Challes", Name: "Challes", Description: "LFLE, glider site", Elevation: 296,
+			Latitude: 45.560833, Longitude: 5.97695, Update: time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC)},
+		waypoint.Waypoint{ID: "Galibier", Name: "Galibier", Latitude: 45.063883, Longitude: 6.40805},
+		waypoint.Waypoint{ID: "Minimal", Name: "Minimal", Latitude: -45.5, Longitude: -6.25},
+	}
+	if !reflect.DeepEqual(waypoints, expected) {
+		t.Errorf("expected %+v got %+v", expected, waypoints)
+	}
+}
+
+var parseErrorTests = []struct {
+	t       string
+	content string
+	line    int
+}{
+	{"missing header", "1,Challes,45.5,6.5", 1},
+	{"bad datum", "OziExplorer Waypoint File Version 1.1\nEuropean 1950\nReserved 2\nReserved 3\n", 2},
+	{"missing fields", "OziExplorer Waypoint File Version 1.1\nWGS 84\nReserved 2\nReserved 3\n1,Challes,45.5", 5},
+	{"bad latitude", "OziExplorer Waypoint File Version 1.1\nWGS 84\nReserved 2\nReserved 3\n1,Challes,95.5,6.5", 5},
+	{"bad longitude", "OziExplorer Waypoint File Version 1.1\nWGS 84\nReserved 2\nReserved 3\n1,Challes,45.5,X", 5},
+	{"bad date", "OziExplorer Waypoint File Version 1.1\nWGS 84\nReserved 2\nReserved 3\n1,Challes,45.5,6.5,X", 5},
+	{"bad altitude", "OziExplorer Waypoint File Version 1.1\nWGS 84\nReserved 2\nReserved 3\n" +
+		"1,Challes,45.5,6.5,,0,1,3,0,65535,,0,0,0,X,6,0,17", 5},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		_, err := Parse([]byte(test.content))
+		perr, ok := err.(util.ParseError)
+		if !ok {
+			t.Errorf("%v :: expected parse error got %v", test.t, err)
+			continue
+		}
+		if perr.Line != test.line {
+			t.Errorf("%v :: expected error in line %v got %v", test.t, test.line, perr)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	airfields := []airfield.Airfield{
+		airfield.Airfield{ID: "LFLE", ShortName: "LFLE", Name: "Challes", Elevation: 296,
+			Latitude: 45.560833, Longitude: 5.97695},
+	}
+	waypoints := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "GAL", Name: "Col du Galibier, north", Description: "Pass, 2642m", Elevation: 2642,
+			Latitude: 45.063883, Longitude: 6.40805, Update: time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, airfields, waypoints); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	expected := strings.Join([]string{
+		"OziExplorer Waypoint File Version 1.1",
+		"WGS 84",
+		"Reserved 2",
+		"Reserved 3",
+		"1,Challes,45.560833,5.976950,,0,1,3,0,65535,LFLE,0,0,0,971,6,0,17",
+		"2,Col du Galibier  north,45.063883,6.408050,42005.5000000,0,1,3,0,65535,Pass\xd1 2642m,0,0,0,8668,6,0,17",
+		"",
+	}, "\r\n")
+	if buf.String() != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, buf.String())
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written content :: %v", err)
+	}
+	if len(result) != 2 || !reflect.DeepEqual(result[1].Update, waypoints[0].Update) ||
+		result[1].Description != waypoints[0].Description || result[1].Elevation != waypoints[0].Elevation {
+		t.Errorf("round trip failed :: expected %+v got %+v", waypoints, result)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if !Detect([]byte(testWpt)) {
+		t.Errorf("expected ozi content to be detected")
+	}
+	if Detect([]byte("1,45:33.650N,005:58.617E,296M,AT,Challes,LFLE")) {
+		t.Errorf("expected winpilot content not to be detected")
+	}
+}
@@ -43,6 +43,7 @@ import (
 	"github.com/rochaporto/ezgliding/airfield"
 	"github.com/rochaporto/ezgliding/airspace"
 	"github.com/rochaporto/ezgliding/config"
+	"github.com/rochaporto/ezgliding/cup"
 	"github.com/rochaporto/ezgliding/flight"
 	"github.com/rochaporto/ezgliding/fusiontables"
 	"github.com/rochaporto/ezgliding/netcoupe"
@@ -125,6 +126,9 @@ func Register(id string, plugin interface{}) {
 // GetInstance returns a new instance of the requested plugin.
 func GetInstance(id string, cfg config.Config) (interface{}, error) {
 	switch id {
+	case "cup":
+		c, _ := cup.New(cfg.Cup)
+		return c, nil
 	case "fusiontables":
 		ft, _ := fusiontables.New(cfg.FusionTables)
 		return ft, nil
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/rochaporto/ezgliding/config"
+	"github.com/rochaporto/ezgliding/cup"
 	"github.com/rochaporto/ezgliding/fusiontables"
 	"github.com/rochaporto/ezgliding/mock"
 	"github.com/rochaporto/ezgliding/netcoupe"
@@ -155,6 +156,18 @@ func TestGetWaypointerMissing(t *testing.T) {
 	}
 }
 
+func TestGetInstanceCup(t *testing.T) {
+	e, _ := cup.New(cup.Config{})
+	r, err := GetInstance("cup", config.Config{})
+	if err != nil {
+		t.Errorf("failed to get instance :: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(r, e) {
+		t.Errorf("expected %v but got %v", e, r)
+	}
+}
+
 func TestGetInstanceFusionTables(t *testing.T) {
 	e, _ := fusiontables.New(fusiontables.Config{})
 	r, err := GetInstance("fusiontables", config.Config{})
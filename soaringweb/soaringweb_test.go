@@ -237,22 +237,24 @@ var getAirspaceTests = []GetAirspaceTest{
 			airspace.Airspace{
 				Class: 'C', Name: "CTR Annecy 118.2",
 				Floor: "SFC", Ceiling: "3500FT AMSL",
+				FloorAltitude:   airspace.Altitude{Reference: airspace.SFC},
+				CeilingAltitude: airspace.Altitude{Value: 3500},
 				Segments: []airspace.Segment{
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "46:02:56 N 006:09:33 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:02:56 N 006:09:33 E",
 					},
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "45:59:06 N 006:14:32 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "45:59:06 N 006:14:32 E",
 					},
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "45:48:36 N 006:02:30 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "45:48:36 N 006:02:30 E",
 					},
 					airspace.Segment{
-						Type: airspace.Arc, X: "45:55:40 N 006:05:41 E", Clockwise: false,
+						Type: airspace.Arc, X: "45:55:40 N 006:05:41 E", Clockwise: true,
 						Coordinate1: "45:48:36 N 006:02:30 E", Coordinate2: "45:55:57 N 005:55:05 E",
 					},
 					airspace.Segment{
-						Type: airspace.Polygon, X: "45:55:40 N 006:05:41 E",
+						Type: airspace.Polygon, Clockwise: true, X: "45:55:40 N 006:05:41 E",
 						Coordinate1: "45:55:57 N 005:55:05 E",
 					},
 				},
@@ -260,13 +262,15 @@ var getAirspaceTests = []GetAirspaceTest{
 			airspace.Airspace{
 				Class: 'C', Name: "Geneve9 C 126.35",
 				Floor: "FL115", Ceiling: "FL195",
+				FloorAltitude:   airspace.Altitude{Value: 115, Unit: airspace.FlightLevel, Reference: airspace.STD},
+				CeilingAltitude: airspace.Altitude{Value: 195, Unit: airspace.FlightLevel, Reference: airspace.STD},
 				Segments: []airspace.Segment{
 					airspace.Segment{
-						Type: airspace.Polygon, Clockwise: false,
+						Type: airspace.Polygon, Clockwise: true,
 						Coordinate1: "45:52:25 N 006:07:45 E",
 					},
 					airspace.Segment{
-						Type: airspace.Polygon, Clockwise: false,
+						Type: airspace.Polygon, Clockwise: true,
 						Coordinate1: "45:50:38 N 006:06:05 E",
 					},
 				},
@@ -281,12 +285,14 @@ var getAirspaceTests = []GetAirspaceTest{
 			airspace.Airspace{
 				Class: 'C', Name: "CTR Chambery2 118.3",
 				Floor: "1160FT AMSL", Ceiling: "3500FT AMSL",
+				FloorAltitude:   airspace.Altitude{Value: 1160},
+				CeilingAltitude: airspace.Altitude{Value: 3500},
 				Segments: []airspace.Segment{
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "45:39:35 N 005:55:48 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "45:39:35 N 005:55:48 E",
 					},
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "45:36:28 N 005:56:03 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "45:36:28 N 005:56:03 E",
 					},
 				},
 			},
@@ -300,12 +306,14 @@ var getAirspaceTests = []GetAirspaceTest{
 			airspace.Airspace{
 				Class: 'C', Name: "CTR Chambery2 118.3",
 				Floor: "1160FT AMSL", Ceiling: "3500FT AMSL",
+				FloorAltitude:   airspace.Altitude{Value: 1160},
+				CeilingAltitude: airspace.Altitude{Value: 3500},
 				Segments: []airspace.Segment{
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "45:39:35 N 005:55:48 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "45:39:35 N 005:55:48 E",
 					},
 					airspace.Segment{
-						Type: airspace.Polygon, Coordinate1: "45:36:28 N 005:56:03 E",
+						Type: airspace.Polygon, Clockwise: true, Coordinate1: "45:36:28 N 005:56:03 E",
 					},
 				},
 			},
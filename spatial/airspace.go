@@ -0,0 +1,228 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package spatial
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/rochaporto/ezgliding/airspace"
+)
+
+const (
+	// NauticalMile is the length of a nautical mile in meters, the unit
+	// used for airspace radius.
+	NauticalMile = 1852.0
+
+	// DefaultArcResolution is the default angle (degrees) between two
+	// consecutive vertices when resolving arcs and circles.
+	DefaultArcResolution = 5.0
+)
+
+// AirspacePolygon returns the closed polygon (first and last points are
+// the same) resolved from the segments of the given airspace.
+//
+// Arcs and circles are approximated with a vertex every resolution
+// degrees (DefaultArcResolution if zero or negative).
+func AirspacePolygon(a airspace.Airspace, resolution float64) ([]airspace.Point, error) {
+	if resolution <= 0 {
+		resolution = DefaultArcResolution
+	}
+	result := []airspace.Point{}
+	for i, s := range a.Segments {
+		var pts []airspace.Point
+		var err error
+		switch s.Type {
+		case airspace.Polygon:
+			var p airspace.Point
+			p.Latitude, p.Longitude, err = ParsePosition(s.Coordinate1)
+			pts = []airspace.Point{p}
+		case airspace.Arc:
+			pts, err = resolveArc(s, resolution)
+		case airspace.Circle:
+			pts, err = resolveCircle(s, resolution)
+		default:
+			err = fmt.Errorf("unknown segment type :: %v", s.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("airspace %v :: segment %v :: %v", a.Name, i, err)
+		}
+		for _, p := range pts {
+			if len(result) == 0 || result[len(result)-1] != p {
+				result = append(result, p)
+			}
+		}
+	}
+	if len(result) > 1 && result[0] == result[len(result)-1] {
+		result = result[:len(result)-1]
+	}
+	if len(result) < 3 {
+		return nil, fmt.Errorf("airspace %v :: polygon needs at least 3 points", a.Name)
+	}
+	return append(result, result[0]), nil
+}
+
+// AirspaceBounds returns the bounding box of the given airspace, with arcs
+// and circles resolved as in AirspacePolygon.
+func AirspaceBounds(a airspace.Airspace, resolution float64) (airspace.BoundingBox, error) {
+	polygon, err := AirspacePolygon(a, resolution)
+	if err != nil {
+		return airspace.BoundingBox{}, err
+	}
+	return PolygonBounds(polygon), nil
+}
+
+// PolygonBounds returns the bounding box of the given points.
+func PolygonBounds(polygon []airspace.Point) airspace.BoundingBox {
+	if len(polygon) == 0 {
+		return airspace.BoundingBox{}
+	}
+	b := airspace.BoundingBox{
+		North: polygon[0].Latitude, South: polygon[0].Latitude,
+		East: polygon[0].Longitude, West: polygon[0].Longitude,
+	}
+	for _, p := range polygon[1:] {
+		b.North = math.Max(b.North, p.Latitude)
+		b.South = math.Min(b.South, p.Latitude)
+		b.East = math.Max(b.East, p.Longitude)
+		b.West = math.Min(b.West, p.Longitude)
+	}
+	return b
+}
+
+// resolveCircle returns the vertices of the circle segment, clockwise
+// starting north of the center.
+func resolveCircle(s airspace.Segment, resolution float64) ([]airspace.Point, error) {
+	if s.X == "" {
+		return nil, errors.New("circle with no center")
+	}
+	lat, lon, err := ParsePosition(s.X)
+	if err != nil {
+		return nil, err
+	}
+	if s.Radius <= 0 {
+		return nil, fmt.Errorf("invalid circle radius :: %v", s.Radius)
+	}
+	n := int(math.Ceil(360 / resolution))
+	pts := make([]airspace.Point, n)
+	for i := range pts {
+		pts[i].Latitude, pts[i].Longitude = Destination(lat, lon,
+			360*float64(i)/float64(n), s.Radius*NauticalMile)
+	}
+	return pts, nil
+}
+
+// resolveArc returns the vertices of the arc segment, given either by
+// radius and angles (DA) or by its start and end points (DB).
+func resolveArc(s airspace.Segment, resolution float64) ([]airspace.Point, error) {
+	if s.X == "" {
+		return nil, errors.New("arc with no center")
+	}
+	lat, lon, err := ParsePosition(s.X)
+	if err != nil {
+		return nil, err
+	}
+	var start, end airspace.Point
+	r1, r2 := s.Radius*NauticalMile, s.Radius*NauticalMile
+	a1, a2 := s.AngleStart, s.AngleEnd
+	byPoints := s.Coordinate1 != "" || s.Coordinate2 != ""
+	if byPoints {
+		if start.Latitude, start.Longitude, err = ParsePosition(s.Coordinate1); err != nil {
+			return nil, err
+		}
+		if end.Latitude, end.Longitude, err = ParsePosition(s.Coordinate2); err != nil {
+			return nil, err
+		}
+		r1 = Distance(lat, lon, start.Latitude, start.Longitude)
+		r2 = Distance(lat, lon, end.Latitude, end.Longitude)
+		a1 = InitialBearing(lat, lon, start.Latitude, start.Longitude)
+		a2 = InitialBearing(lat, lon, end.Latitude, end.Longitude)
+	} else if s.Radius <= 0 {
+		return nil, fmt.Errorf("invalid arc radius :: %v", s.Radius)
+	}
+
+	// sweep is the angle covered by the arc in the segment direction
+	var sweep float64
+	if s.Clockwise {
+		sweep = math.Mod(a2-a1+720, 360)
+	} else {
+		sweep = math.Mod(a1-a2+720, 360)
+	}
+	if sweep == 0 && !byPoints && a1 != a2 {
+		sweep = 360
+	}
+	dir := 1.0
+	if !s.Clockwise {
+		dir = -1
+	}
+	n := int(math.Ceil(sweep / resolution))
+	if n == 0 {
+		n = 1
+	}
+	pts := make([]airspace.Point, n+1)
+	for i := range pts {
+		f := float64(i) / float64(n)
+		pts[i].Latitude, pts[i].Longitude = Destination(lat, lon,
+			a1+dir*sweep*f, r1+(r2-r1)*f)
+	}
+	if byPoints {
+		pts[0], pts[n] = start, end
+	}
+	return pts, nil
+}
+
+// PointInPolygon returns true if the given point is inside the polygon,
+// using the ray casting algorithm on the lat/lon plane.
+func PointInPolygon(lat float64, lon float64, polygon []airspace.Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		pi, pj := polygon[i], polygon[j]
+		if (pi.Latitude > lat) != (pj.Latitude > lat) &&
+			lon < (pj.Longitude-pi.Longitude)*(lat-pi.Latitude)/(pj.Latitude-pi.Latitude)+pi.Longitude {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// DistanceToPolygon returns the distance (meters) from the given point to
+// the closest edge of the polygon, using a local flat earth approximation
+// which is good enough for airspace sized polygons.
+func DistanceToPolygon(lat float64, lon float64, polygon []airspace.Point) float64 {
+	// x and y (meters) of the polygon points relative to the given point
+	kx := EarthRadius * math.Pi / 180 * math.Cos(toRad(lat))
+	ky := EarthRadius * math.Pi / 180
+	xy := func(p airspace.Point) (float64, float64) {
+		return (normalizeLongitude(p.Longitude-lon) * kx), (p.Latitude - lat) * ky
+	}
+	d := math.Inf(1)
+	for i := 1; i < len(polygon); i++ {
+		x1, y1 := xy(polygon[i-1])
+		x2, y2 := xy(polygon[i])
+		dx, dy := x2-x1, y2-y1
+		t := 0.0
+		if l := dx*dx + dy*dy; l > 0 {
+			t = math.Max(0, math.Min(1, -(x1*dx+y1*dy)/l))
+		}
+		d = math.Min(d, math.Hypot(x1+t*dx, y1+t*dy))
+	}
+	return d
+}
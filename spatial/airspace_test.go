@@ -0,0 +1,224 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package spatial
+
+import (
+	"testing"
+
+	"github.com/rochaporto/ezgliding/airspace"
+)
+
+const agenCenter = "44:10:29 N 000:35:26 E"
+
+// agen is the CTR Agen from the openair test files, with two arcs.
+var agen = airspace.Airspace{
+	Name: "CTR Agen 121.3",
+	Segments: []airspace.Segment{
+		{Type: airspace.Polygon, Coordinate1: "44:16:44 N 000:28:29 E"},
+		{Type: airspace.Polygon, Coordinate1: "44:13:48 N 000:45:33 E"},
+		{Type: airspace.Arc, X: agenCenter, Clockwise: true,
+			Coordinate1: "44:13:48 N 000:45:33 E", Coordinate2: "44:02:56 N 000:39:07 E"},
+		{Type: airspace.Polygon, Coordinate1: "44:02:56 N 000:39:07 E"},
+		{Type: airspace.Polygon, Coordinate1: "44:05:39 N 000:31:05 E"},
+		{Type: airspace.Polygon, Coordinate1: "44:08:31 N 000:24:40 E"},
+		{Type: airspace.Arc, X: agenCenter, Clockwise: true,
+			Coordinate1: "44:08:31 N 000:24:40 E", Coordinate2: "44:16:44 N 000:28:29 E"},
+		{Type: airspace.Polygon, Coordinate1: "44:16:44 N 000:28:29 E"},
+	},
+}
+
+func TestAirspacePolygon(t *testing.T) {
+	polygon, err := AirspacePolygon(agen, 5)
+	if err != nil {
+		t.Fatalf("failed to resolve polygon :: %v", err)
+	}
+	if polygon[0] != polygon[len(polygon)-1] {
+		t.Errorf("polygon not closed :: %v %v", polygon[0], polygon[len(polygon)-1])
+	}
+	for i := 1; i < len(polygon); i++ {
+		if polygon[i] == polygon[i-1] {
+			t.Errorf("duplicate consecutive vertex %v :: %v", i, polygon[i])
+		}
+	}
+	// 6 polygon points plus the intermediate points of the two arcs
+	if len(polygon) <= 7 {
+		t.Errorf("expected arcs to add vertices, got %v points", len(polygon))
+	}
+	clat, clon, _ := ParsePosition(agenCenter)
+	r := Distance(clat, clon, polygon[1].Latitude, polygon[1].Longitude)
+	for _, p := range polygon[2:5] {
+		if d := Distance(clat, clon, p.Latitude, p.Longitude); !near(d, r, 20) {
+			t.Errorf("expected arc vertex at %v from the center got %v", r, d)
+		}
+	}
+}
+
+func TestAirspacePolygonCircle(t *testing.T) {
+	a := airspace.Airspace{Segments: []airspace.Segment{
+		{Type: airspace.Circle, X: "51:30:00 N 3:00:00 E", Radius: 2},
+	}}
+	polygon, err := AirspacePolygon(a, 10)
+	if err != nil {
+		t.Fatalf("failed to resolve circle :: %v", err)
+	}
+	if len(polygon) != 37 {
+		t.Errorf("expected 37 points got %v", len(polygon))
+	}
+	for _, p := range polygon {
+		if d := Distance(51.5, 3, p.Latitude, p.Longitude); !near(d, 2*NauticalMile, 0.01) {
+			t.Errorf("expected point at %v from the center got %v", 2*NauticalMile, d)
+		}
+	}
+	b := PolygonBounds(polygon)
+	if !near(b.North-51.5, 2*NauticalMile/111195, 1e-4) || !near(51.5-b.South, 2*NauticalMile/111195, 1e-4) {
+		t.Errorf("unexpected bounds :: %+v", b)
+	}
+	if !b.Contains(51.5, 3) || b.Contains(51.6, 3) {
+		t.Errorf("unexpected contains for bounds :: %+v", b)
+	}
+}
+
+type ArcTest struct {
+	t         string
+	clockwise bool
+	start     float64
+	end       float64
+	points    int
+}
+
+var arcTests = []ArcTest{
+	{"clockwise", true, 270, 290, 5},
+	{"counter clockwise", false, 290, 270, 5},
+	{"clockwise across north", true, 350, 10, 5},
+	{"counter clockwise the long way", false, 270, 290, 69},
+	{"full circle", true, 0, 360, 73},
+}
+
+func TestAirspacePolygonArc(t *testing.T) {
+	for _, test := range arcTests {
+		a := airspace.Airspace{Segments: []airspace.Segment{
+			{Type: airspace.Polygon, Coordinate1: "46:03:03 N 005:47:12 E"},
+			{Type: airspace.Arc, X: "46:03:03 N 005:47:12 E", Clockwise: test.clockwise,
+				Radius: 10, AngleStart: test.start, AngleEnd: test.end},
+		}}
+		polygon, err := AirspacePolygon(a, 5)
+		if err != nil {
+			t.Errorf("test %v failed :: %v", test.t, err)
+			continue
+		}
+		// center, arc points and the closing point
+		if len(polygon) != test.points+2 {
+			t.Errorf("test %v failed, expected %v points got %v", test.t, test.points+2, len(polygon))
+			continue
+		}
+		clat, clon := polygon[0].Latitude, polygon[0].Longitude
+		b1 := InitialBearing(clat, clon, polygon[1].Latitude, polygon[1].Longitude)
+		b2 := InitialBearing(clat, clon, polygon[2].Latitude, polygon[2].Longitude)
+		if !near(normalizeBearing(b1-test.start+180), 180, 1e-6) {
+			t.Errorf("test %v failed, expected arc start at %v got %v", test.t, test.start, b1)
+		}
+		if test.clockwise != (normalizeBearing(b2-b1) < 180) {
+			t.Errorf("test %v failed, wrong direction from %v to %v", test.t, b1, b2)
+		}
+	}
+}
+
+var airspacePolygonErrorTests = []airspace.Airspace{
+	{Name: "too few points", Segments: []airspace.Segment{
+		{Type: airspace.Polygon, Coordinate1: "46:03:03 N 005:47:12 E"},
+		{Type: airspace.Polygon, Coordinate1: "46:03:03 N 005:47:12 E"},
+		{Type: airspace.Polygon, Coordinate1: "46:04:03 N 005:47:12 E"},
+	}},
+	{Name: "bad coordinate", Segments: []airspace.Segment{
+		{Type: airspace.Polygon, Coordinate1: "46:03:03 X 005:47:12 E"},
+	}},
+	{Name: "arc with no center", Segments: []airspace.Segment{
+		{Type: airspace.Arc, Radius: 10, AngleStart: 0, AngleEnd: 90},
+	}},
+	{Name: "circle with no radius", Segments: []airspace.Segment{
+		{Type: airspace.Circle, X: "46:03:03 N 005:47:12 E"},
+	}},
+	{Name: "unknown segment", Segments: []airspace.Segment{
+		{Type: airspace.SegmentType(10)},
+	}},
+	{Name: "empty"},
+}
+
+func TestAirspacePolygonError(t *testing.T) {
+	for _, a := range airspacePolygonErrorTests {
+		if _, err := AirspacePolygon(a, 0); err == nil {
+			t.Errorf("test %v failed, expected error", a.Name)
+		}
+		if _, err := AirspaceBounds(a, 0); err == nil {
+			t.Errorf("test %v failed, expected bounds error", a.Name)
+		}
+	}
+}
+
+func TestAirspaceBounds(t *testing.T) {
+	b, err := AirspaceBounds(agen, 0)
+	if err != nil {
+		t.Fatalf("failed to get bounds :: %v", err)
+	}
+	if b.North < dms(44, 16, 44) || b.South > dms(44, 2, 56) ||
+		b.East < dms(0, 45, 33) || b.West > dms(0, 24, 40) {
+		t.Errorf("bounds do not include all points :: %+v", b)
+	}
+	other := airspace.BoundingBox{North: 45, South: 44.2, East: 1, West: 0.5}
+	if !b.Intersects(other) || b.Intersects(airspace.BoundingBox{North: 46, South: 45, East: 1, West: 0}) {
+		t.Errorf("unexpected intersection result :: %+v", b)
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	polygon, _ := AirspacePolygon(agen, 0)
+	clat, clon, _ := ParsePosition(agenCenter)
+	if !PointInPolygon(clat, clon, polygon) {
+		t.Errorf("expected center to be inside polygon")
+	}
+	if PointInPolygon(44.5, 0.5, polygon) || PointInPolygon(44.2, 1.0, polygon) {
+		t.Errorf("expected point to be outside polygon")
+	}
+}
+
+func TestDistanceToPolygon(t *testing.T) {
+	// 0.1 degrees square
+	square := []airspace.Point{
+		{Latitude: 46, Longitude: 6}, {Latitude: 46.1, Longitude: 6},
+		{Latitude: 46.1, Longitude: 6.1}, {Latitude: 46, Longitude: 6.1},
+		{Latitude: 46, Longitude: 6},
+	}
+	tests := []struct {
+		lat float64
+		lon float64
+		r   float64
+	}{
+		{46.05, 6.05, Distance(46.05, 6.05, 46.05, 6)},
+		{46.05, 5.9, Distance(46.05, 5.9, 46.05, 6)},
+		{46.2, 6.05, Distance(46.2, 6.05, 46.1, 6.05)},
+		{45.9, 5.9, Distance(45.9, 5.9, 46, 6)},
+		{46, 6.05, 0},
+	}
+	for _, test := range tests {
+		if d := DistanceToPolygon(test.lat, test.lon, square); !near(d, test.r, test.r*0.005+0.01) {
+			t.Errorf("expected distance %v for %v %v got %v", test.r, test.lat, test.lon, d)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package spatial
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Notation is a textual representation of a coordinate.
+type Notation int
+
+// Possible values for Notation. The examples are for 45°30'12"N.
+const (
+	// Decimal degrees (45.503333).
+	Decimal Notation = iota
+	// DMS is degrees, minutes and seconds (45°30'12"N).
+	DMS
+	// DMM is degrees and decimal minutes (45°30.200'N).
+	DMM
+	// OpenAir is the notation used in OpenAir airspace files (45:30:12 N).
+	OpenAir
+	// CUP is the notation used in SeeYou CUP files (4530.200N).
+	CUP
+	// IGC is the notation used in IGC flight files (4530200N).
+	IGC
+	// Welt2000 is the notation used in the Welt2000 database (N453012).
+	Welt2000
+	// Winpilot is the notation used in Winpilot and Cambridge waypoint
+	// files (45:30.200N).
+	Winpilot
+	// OpenAirDecimal is the OpenAir notation with thousands of seconds
+	// (45:30:12.345 N), given only for coordinates which are not whole
+	// seconds.
+	OpenAirDecimal
+)
+
+// kind of coordinate being parsed, used to validate the hemisphere.
+const (
+	anyKind = iota
+	latitudeKind
+	longitudeKind
+)
+
+// ParseCoordinate parses a latitude or longitude in any of the supported
+// notations, returning it in decimal degrees.
+//
+// The hemisphere (N, S, E, W) can be given before or after the value, and
+// is required for the compact notations (IGC, Welt2000, CUP). Values with
+// no hemisphere can have a sign instead. Parsing is case insensitive.
+func ParseCoordinate(s string) (float64, error) {
+	return parseCoordinate(s, anyKind)
+}
+
+// ParseLatitude is like ParseCoordinate but fails if the value is not a
+// valid latitude.
+func ParseLatitude(s string) (float64, error) {
+	return parseCoordinate(s, latitudeKind)
+}
+
+// ParseLongitude is like ParseCoordinate but fails if the value is not a
+// valid longitude.
+func ParseLongitude(s string) (float64, error) {
+	return parseCoordinate(s, longitudeKind)
+}
+
+// ParsePosition parses a latitude and longitude pair, as in
+// "45:30:12 N 006:30:12 E", "N453012 E0063012" or "45.5, 6.5".
+func ParsePosition(s string) (float64, float64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	var lat, lon string
+	if i := strings.IndexAny(s, ","); i != -1 {
+		lat, lon = s[:i], s[i+1:]
+	} else if len(s) > 0 && (s[0] == 'N' || s[0] == 'S') {
+		i := strings.IndexAny(s, "EW")
+		if i == -1 {
+			return 0, 0, fmt.Errorf("invalid position :: %v", s)
+		}
+		lat, lon = s[:i], s[i:]
+	} else {
+		i := strings.IndexAny(s, "NS")
+		if i == -1 {
+			return 0, 0, fmt.Errorf("invalid position :: %v", s)
+		}
+		lat, lon = s[:i+1], s[i+1:]
+	}
+	la, err := ParseLatitude(lat)
+	if err != nil {
+		return 0, 0, err
+	}
+	lo, err := ParseLongitude(lon)
+	if err != nil {
+		return 0, 0, err
+	}
+	return la, lo, nil
+}
+
+func parseCoordinate(s string, kind int) (float64, error) {
+	orig := s
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, fmt.Errorf("invalid coordinate :: %v", orig)
+	}
+
+	// hemisphere, either as prefix or suffix
+	var h byte
+	if strings.IndexByte("NSEW", s[0]) != -1 {
+		h, s = s[0], s[1:]
+	} else if strings.IndexByte("NSEW", s[len(s)-1]) != -1 {
+		h, s = s[len(s)-1], s[:len(s)-1]
+	}
+	s = strings.TrimSpace(s)
+	switch h {
+	case 'N', 'S':
+		if kind == longitudeKind {
+			return 0, fmt.Errorf("expected longitude :: %v", orig)
+		}
+		kind = latitudeKind
+	case 'E', 'W':
+		if kind == latitudeKind {
+			return 0, fmt.Errorf("expected latitude :: %v", orig)
+		}
+		kind = longitudeKind
+	}
+	sign := 1.0
+	if h == 0 && len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+	if h == 'S' || h == 'W' {
+		sign = -1
+	}
+	dw := 2 // width of the degrees in the compact notations
+	if kind == longitudeKind {
+		dw = 3
+	}
+
+	var r float64
+	var err error
+	fields := strings.FieldsFunc(s, func(c rune) bool {
+		return strings.ContainsRune(" :°'\"′″", c)
+	})
+	switch {
+	case len(fields) == 0:
+		err = fmt.Errorf("missing value")
+	case len(fields) > 1 || strings.ContainsAny(s, ":°'\"′″"):
+		r, err = parseFields(fields)
+	case h != 0 && !strings.Contains(s, ".") && len(s) == dw+4:
+		// compact degrees, minutes and seconds (Welt2000)
+		r, err = parseFields([]string{s[:dw], s[dw : dw+2], s[dw+2:]})
+	case h != 0 && !strings.Contains(s, ".") && len(s) == dw+5:
+		// compact degrees, minutes and thousands of minutes (IGC)
+		var d, m, dm float64
+		d, m, dm, err = parseInts(s[:dw], s[dw:dw+2], s[dw+2:])
+		if err == nil && m >= 60 {
+			err = fmt.Errorf("minutes out of range")
+		}
+		r = d + ((m + (dm / 1000.0)) / 60.0)
+	case h != 0 && strings.Index(s, ".") == dw+2:
+		// compact degrees and decimal minutes (CUP)
+		r, err = parseFields([]string{s[:dw], s[dw:]})
+	case h != 0 && strings.Index(s, ".") > dw:
+		err = fmt.Errorf("unknown notation")
+	default:
+		r, err = parseNumber(s)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate :: %v :: %v", orig, err)
+	}
+
+	max := 180.0
+	if kind == latitudeKind {
+		max = 90
+	}
+	if r > max {
+		return 0, fmt.Errorf("coordinate out of range :: %v", orig)
+	}
+	return sign * r, nil
+}
+
+// parseFields returns the decimal value of the given degrees, minutes and
+// seconds, where the minutes and seconds are optional.
+func parseFields(fields []string) (float64, error) {
+	if len(fields) > 3 {
+		return 0, fmt.Errorf("too many fields :: %v", fields)
+	}
+	var v [3]float64
+	for i, f := range fields {
+		n, err := parseNumber(f)
+		if err != nil {
+			return 0, err
+		}
+		// 60 is accepted as some published data has it (as in 15:60)
+		if i > 0 && n > 60 {
+			return 0, fmt.Errorf("value out of range :: %v", f)
+		}
+		v[i] = n
+	}
+	return v[0] + (v[1] / 60.0) + (v[2] / 3600.0), nil
+}
+
+// parseInts parses the given strings as unsigned integers.
+func parseInts(s ...string) (float64, float64, float64, error) {
+	var v [3]float64
+	for i := range s {
+		n, err := strconv.ParseUint(s[i], 10, 64)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		v[i] = float64(n)
+	}
+	return v[0], v[1], v[2], nil
+}
+
+// parseNumber parses an unsigned decimal number, rejecting the special
+// values (NaN, Inf) and exponents accepted by strconv.ParseFloat.
+func parseNumber(s string) (float64, error) {
+	if s == "" || strings.Trim(s, "0123456789.") != "" {
+		return 0, fmt.Errorf("invalid number :: %v", s)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// FormatLatitude returns the given latitude in the given notation.
+func FormatLatitude(lat float64, n Notation) string {
+	return formatCoordinate(lat, n, 2, 'N', 'S')
+}
+
+// FormatLongitude returns the given longitude in the given notation.
+func FormatLongitude(lon float64, n Notation) string {
+	return formatCoordinate(lon, n, 3, 'E', 'W')
+}
+
+func formatCoordinate(v float64, n Notation, dw int, pos byte, neg byte) string {
+	d := strconv.FormatFloat(v, 'f', -1, 64)
+	h := pos
+	if v < 0 {
+		h, v = neg, -v
+	}
+	// seconds and thousands of minutes are rounded as a whole so that
+	// they never overflow to 60
+	s := int64(math.Floor(v*3600 + 0.5))
+	m := int64(math.Floor(v*60000 + 0.5))
+	ms := int64(math.Floor(v*3600000 + 0.5))
+	switch n {
+	case DMS:
+		return fmt.Sprintf("%d°%02d'%02d\"%c", s/3600, s%3600/60, s%60, h)
+	case DMM:
+		return fmt.Sprintf("%d°%02d.%03d'%c", m/60000, m%60000/1000, m%1000, h)
+	case OpenAir:
+		return fmt.Sprintf("%0*d:%02d:%02d %c", dw, s/3600, s%3600/60, s%60, h)
+	case OpenAirDecimal:
+		if ms%1000 == 0 {
+			return fmt.Sprintf("%0*d:%02d:%02d %c", dw, ms/3600000, ms%3600000/60000, ms%60000/1000, h)
+		}
+		return fmt.Sprintf("%0*d:%02d:%02d.%03d %c", dw, ms/3600000, ms%3600000/60000, ms%60000/1000, ms%1000, h)
+	case CUP:
+		return fmt.Sprintf("%0*d%02d.%03d%c", dw, m/60000, m%60000/1000, m%1000, h)
+	case IGC:
+		return fmt.Sprintf("%0*d%05d%c", dw, m/60000, m%60000, h)
+	case Welt2000:
+		return fmt.Sprintf("%c%0*d%02d%02d", h, dw, s/3600, s%3600/60, s%60)
+	case Winpilot:
+		return fmt.Sprintf("%0*d:%02d.%03d%c", dw, m/60000, m%60000/1000, m%1000, h)
+	}
+	return d
+}
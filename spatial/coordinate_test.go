@@ -0,0 +1,191 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package spatial
+
+import (
+	"testing"
+)
+
+type ParseCoordinateTest struct {
+	t   string
+	in  string
+	r   float64
+	err bool
+}
+
+var parseCoordinateTests = []ParseCoordinateTest{
+	{"decimal", "45.503333", 45.503333, false},
+	{"decimal negative", "-6.5", -6.5, false},
+	{"decimal with hemisphere", "6.5W", -6.5, false},
+	{"decimal with hemisphere prefix", "S 45.5", -45.5, false},
+	{"decimal integer", "45", 45, false},
+	{"dms", "45°30'12\"N", dms(45, 30, 12), false},
+	{"dms with spaces", "45 30 12 S", -dms(45, 30, 12), false},
+	{"dms with prime symbols", "6°30′12″E", dms(6, 30, 12), false},
+	{"dmm", "45°30.200'N", dms(45, 30.2, 0), false},
+	{"dmm hemisphere prefix", "W 6° 30.5'", -dms(6, 30.5, 0), false},
+	{"openair latitude", "45:30:12 N", dms(45, 30, 12), false},
+	{"openair longitude", "006:30:12 E", dms(6, 30, 12), false},
+	{"openair lower case", "000:53:00 w", -dms(0, 53, 0), false},
+	{"openair decimal minutes", "45:30.5N", dms(45, 30.5, 0), false},
+	{"cup latitude", "4530.123N", dms(45, 30.123, 0), false},
+	{"cup longitude", "00630.123W", -dms(6, 30.123, 0), false},
+	{"igc latitude", "4616018N", 46.26696666666667, false},
+	{"igc longitude", "00627679E", 6.461316666666667, false},
+	{"welt2000 latitude", "N323200", 32.53333333333333, false},
+	{"welt2000 longitude", "W1002233", -100.37583333333333, false},
+	{"empty", "", 0, true},
+	{"only hemisphere", "N", 0, true},
+	{"garbage", "abc", 0, true},
+	{"short compact", "N32", 32, false},
+	{"bad compact length", "N32320", 0, true},
+	{"bad digits", "N32AB00", 0, true},
+	{"minutes out of range", "45:61:00 N", 0, true},
+	{"seconds out of range", "45:30:61 N", 0, true},
+	{"sixty seconds", "45:30:60 N", dms(45, 31, 0), false},
+	{"latitude out of range", "91.5N", 0, true},
+	{"longitude out of range", "181E", 0, true},
+	{"decimal out of range", "-200", 0, true},
+	{"not a number", "NaN", 0, true},
+	{"exponent", "1e2", 0, true},
+	{"too many fields", "45:30:12:01 N", 0, true},
+	{"cup bad dot position", "453.0123N", 0, true},
+}
+
+func TestParseCoordinate(t *testing.T) {
+	for _, test := range parseCoordinateTests {
+		result, err := ParseCoordinate(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %v failed, expected error got %v", test.t, result)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("test %v failed :: %v", test.t, err)
+			continue
+		}
+		if !near(result, test.r, 1e-12) {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, result)
+		}
+	}
+}
+
+func TestParseLatitudeLongitude(t *testing.T) {
+	if _, err := ParseLatitude("006:30:12 E"); err == nil {
+		t.Errorf("expected error parsing longitude as latitude")
+	}
+	if _, err := ParseLongitude("45:30:12 N"); err == nil {
+		t.Errorf("expected error parsing latitude as longitude")
+	}
+	if _, err := ParseLatitude("95.5"); err == nil {
+		t.Errorf("expected error for latitude out of range")
+	}
+	if r, err := ParseLongitude("-120.5"); err != nil || r != -120.5 {
+		t.Errorf("expected -120.5 got %v %v", r, err)
+	}
+}
+
+type ParsePositionTest struct {
+	t   string
+	in  string
+	lat float64
+	lon float64
+	err bool
+}
+
+var parsePositionTests = []ParsePositionTest{
+	{"openair", "45:30:12 N 006:30:12 E", dms(45, 30, 12), dms(6, 30, 12), false},
+	{"openair no spaces", "45:30:12N 6:30:12W", dms(45, 30, 12), -dms(6, 30, 12), false},
+	{"welt2000", "N453012 E0063012", dms(45, 30, 12), dms(6, 30, 12), false},
+	{"igc", "4616018N00627679E", 46.26696666666667, 6.461316666666667, false},
+	{"decimal", "45.5, -6.5", 45.5, -6.5, false},
+	{"missing longitude", "45:30:12 N", 0, 0, true},
+	{"missing hemisphere", "45:30:12 006:30:12", 0, 0, true},
+	{"swapped", "006:30:12 E 45:30:12 N", 0, 0, true},
+}
+
+func TestParsePosition(t *testing.T) {
+	for _, test := range parsePositionTests {
+		lat, lon, err := ParsePosition(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %v failed, expected error got %v %v", test.t, lat, lon)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("test %v failed :: %v", test.t, err)
+			continue
+		}
+		if !near(lat, test.lat, 1e-12) || !near(lon, test.lon, 1e-12) {
+			t.Errorf("test %v failed, expected %v %v got %v %v", test.t, test.lat, test.lon, lat, lon)
+		}
+	}
+}
+
+type FormatCoordinateTest struct {
+	t   string
+	lat float64
+	lon float64
+	n   Notation
+	r   string
+}
+
+var formatCoordinateTests = []FormatCoordinateTest{
+	{"decimal", 45.5, -6.25, Decimal, "45.5 -6.25"},
+	{"dms", dms(45, 30, 12), -dms(6, 30, 12), DMS, "45°30'12\"N 6°30'12\"W"},
+	{"dmm", dms(45, 30.2, 0), dms(6, 30.123, 0), DMM, "45°30.200'N 6°30.123'E"},
+	{"openair", -dms(45, 30, 12), dms(6, 30, 12), OpenAir, "45:30:12 S 006:30:12 E"},
+	{"cup", dms(45, 30.123, 0), -dms(6, 30.123, 0), CUP, "4530.123N 00630.123W"},
+	{"igc", 46.26696666666667, 6.461316666666667, IGC, "4616018N 00627679E"},
+	{"welt2000", 32.53333333333333, -100.37583333333333, Welt2000, "N323200 W1002233"},
+	{"winpilot", -dms(45, 30.2, 0), dms(6, 30.123, 0), Winpilot, "45:30.200S 006:30.123E"},
+	{"openair decimal", dms(45, 30, 12.3456), -dms(6, 30, 59.9999), OpenAirDecimal, "45:30:12.346 N 006:31:00 W"},
+	{"rounding up to next minute", dms(45, 30, 59.9), 0, DMS, "45°31'00\"N 0°00'00\"E"},
+}
+
+func TestFormatCoordinate(t *testing.T) {
+	for _, test := range formatCoordinateTests {
+		result := FormatLatitude(test.lat, test.n) + " " + FormatLongitude(test.lon, test.n)
+		if result != test.r {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, result)
+			continue
+		}
+		// all notations must parse back to the same value
+		lat, lon, err := ParsePosition(FormatLatitude(test.lat, test.n) + "," + FormatLongitude(test.lon, test.n))
+		if err != nil {
+			t.Errorf("test %v failed to parse back :: %v", test.t, err)
+			continue
+		}
+		if !near(lat, test.lat, 1.0/3600) || !near(lon, test.lon, 1.0/3600) {
+			t.Errorf("test %v failed, parsed back %v %v", test.t, lat, lon)
+		}
+	}
+}
+
+func TestDMS2DecimalInvalid(t *testing.T) {
+	for _, in := range []string{"", "N", "S", "X12"} {
+		if r := DMS2Decimal(in); r != 0 {
+			t.Errorf("expected 0 for invalid input %q got %v", in, r)
+		}
+		if r := DMD2Decimal(in); r != 0 {
+			t.Errorf("expected 0 for invalid input %q got %v", in, r)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package spatial
+
+import (
+	"errors"
+	"math"
+)
+
+// All functions in this file take and return coordinates and bearings in
+// decimal degrees, and distances in meters.
+//
+// The spherical functions (Distance, InitialBearing, ...) are fast and
+// accurate to about 0.5%. The Vincenty functions use the WGS84 ellipsoid
+// and are accurate to less than a millimeter.
+
+const (
+	// EarthRadius is the mean earth radius used in spherical calculations.
+	EarthRadius = 6371000.0
+
+	// WGS84 ellipsoid parameters
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+func toRad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func toDeg(r float64) float64 {
+	return r * 180 / math.Pi
+}
+
+// normalizeBearing returns the given bearing in the range [0,360).
+func normalizeBearing(b float64) float64 {
+	return math.Mod(math.Mod(b, 360)+360, 360)
+}
+
+// Distance returns the great circle distance between the two points,
+// using the haversine formula.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad, lat2Rad := toRad(lat1), toRad(lat2)
+	dLat, dLon := lat2Rad-lat1Rad, toRad(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// InitialBearing returns the bearing at the start of the great circle path
+// from the first to the second point.
+func InitialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad, lat2Rad := toRad(lat1), toRad(lat2)
+	dLon := toRad(lon2 - lon1)
+	y := math.Sin(dLon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(dLon)
+	return normalizeBearing(toDeg(math.Atan2(y, x)))
+}
+
+// FinalBearing returns the bearing at the end of the great circle path
+// from the first to the second point.
+func FinalBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	return normalizeBearing(InitialBearing(lat2, lon2, lat1, lon1) + 180)
+}
+
+// Destination returns the point reached after travelling the given
+// distance from the start point along a great circle with the given
+// initial bearing.
+func Destination(lat, lon, bearing, distance float64) (float64, float64) {
+	lat1Rad, lon1Rad, bearingRad := toRad(lat), toRad(lon), toRad(bearing)
+	dist := distance / EarthRadius
+	lat2Rad := math.Asin(math.Sin(lat1Rad)*math.Cos(dist) + math.Cos(lat1Rad)*math.Sin(dist)*math.Cos(bearingRad))
+	lon2Rad := lon1Rad + math.Atan2(math.Sin(bearingRad)*math.Sin(dist)*math.Cos(lat1Rad),
+		math.Cos(dist)-math.Sin(lat1Rad)*math.Sin(lat2Rad))
+	return toDeg(lat2Rad), normalizeLongitude(toDeg(lon2Rad))
+}
+
+// normalizeLongitude returns the given longitude in the range [-180,180).
+func normalizeLongitude(lon float64) float64 {
+	return math.Mod(math.Mod(lon+180, 360)+360, 360) - 180
+}
+
+// Midpoint returns the point half way along the great circle path between
+// the two points.
+func Midpoint(lat1, lon1, lat2, lon2 float64) (float64, float64) {
+	lat1Rad, lon1Rad, lat2Rad := toRad(lat1), toRad(lon1), toRad(lat2)
+	dLon := toRad(lon2 - lon1)
+	bx := math.Cos(lat2Rad) * math.Cos(dLon)
+	by := math.Cos(lat2Rad) * math.Sin(dLon)
+	lat3Rad := math.Atan2(math.Sin(lat1Rad)+math.Sin(lat2Rad), math.Sqrt((math.Cos(lat1Rad)+bx)*(math.Cos(lat1Rad)+bx)+by*by))
+	lon3Rad := lon1Rad + math.Atan2(by, math.Cos(lat1Rad)+bx)
+	return toDeg(lat3Rad), normalizeLongitude(toDeg(lon3Rad))
+}
+
+// CrossTrackDistance returns the distance of the given point to the great
+// circle path going from the start to the end point. It is negative if the
+// point is left of the path.
+func CrossTrackDistance(lat, lon, startLat, startLon, endLat, endLon float64) float64 {
+	dist13 := Distance(startLat, startLon, lat, lon) / EarthRadius
+	bearing13 := toRad(InitialBearing(startLat, startLon, lat, lon))
+	bearing12 := toRad(InitialBearing(startLat, startLon, endLat, endLon))
+	return math.Asin(math.Sin(dist13)*math.Sin(bearing13-bearing12)) * EarthRadius
+}
+
+// AlongTrackDistance returns the distance from the start point to the
+// point on the great circle path (from start to end) closest to the given
+// point. It is negative if the closest point is behind the start.
+func AlongTrackDistance(lat, lon, startLat, startLon, endLat, endLon float64) float64 {
+	dist13 := Distance(startLat, startLon, lat, lon) / EarthRadius
+	bearing13 := toRad(InitialBearing(startLat, startLon, lat, lon))
+	bearing12 := toRad(InitialBearing(startLat, startLon, endLat, endLon))
+	distXT := math.Asin(math.Sin(dist13) * math.Sin(bearing13-bearing12))
+	distAT := math.Acos(math.Max(-1, math.Min(1, math.Cos(dist13)/math.Cos(distXT))))
+	return math.Copysign(distAT, math.Cos(bearing12-bearing13)) * EarthRadius
+}
+
+// VincentyDistance returns the distance between the two points on the
+// WGS84 ellipsoid, with the initial and final bearings, using Vincenty's
+// inverse formula. It fails for nearly antipodal points, where the formula
+// does not converge.
+func VincentyDistance(lat1, lon1, lat2, lon2 float64) (float64, float64, float64, error) {
+	L := toRad(lon2 - lon1)
+	tanU1 := (1 - wgs84F) * math.Tan(toRad(lat1))
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+	tanU2 := (1 - wgs84F) * math.Tan(toRad(lat2))
+	cosU2 := 1 / math.Sqrt(1+tanU2*tanU2)
+	sinU2 := tanU2 * cosU2
+
+	var sinLambda, cosLambda, sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	lambda := L
+	converged := false
+	for i := 0; i < 200; i++ {
+		sinLambda, cosLambda = math.Sin(lambda), math.Cos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			// coincident points
+			return 0, 0, 0, nil
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		C := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		lambdaP := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-lambdaP) < 1e-12 {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return 0, 0, 0, errors.New("vincenty formula failed to converge")
+	}
+	A, B := vincentyAB(cosSqAlpha)
+	deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	s := wgs84B * A * (sigma - deltaSigma)
+	alpha1 := math.Atan2(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+	alpha2 := math.Atan2(cosU1*sinLambda, -sinU1*cosU2+cosU1*sinU2*cosLambda)
+	return s, normalizeBearing(toDeg(alpha1)), normalizeBearing(toDeg(alpha2)), nil
+}
+
+// VincentyDestination returns the point reached after travelling the given
+// distance from the start point with the given initial bearing on the
+// WGS84 ellipsoid, and the final bearing, using Vincenty's direct formula.
+func VincentyDestination(lat, lon, bearing, distance float64) (float64, float64, float64) {
+	alpha1 := toRad(bearing)
+	sinAlpha1, cosAlpha1 := math.Sin(alpha1), math.Cos(alpha1)
+	tanU1 := (1 - wgs84F) * math.Tan(toRad(lat))
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+	sigma1 := math.Atan2(tanU1, cosAlpha1)
+	sinAlpha := cosU1 * sinAlpha1
+	cosSqAlpha := 1 - sinAlpha*sinAlpha
+	A, B := vincentyAB(cosSqAlpha)
+
+	var sinSigma, cosSigma, cos2SigmaM float64
+	sigma := distance / (wgs84B * A)
+	for i := 0; i < 200; i++ {
+		cos2SigmaM = math.Cos(2*sigma1 + sigma)
+		sinSigma, cosSigma = math.Sin(sigma), math.Cos(sigma)
+		deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+			B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+		sigmaP := sigma
+		sigma = distance/(wgs84B*A) + deltaSigma
+		if math.Abs(sigma-sigmaP) < 1e-12 {
+			break
+		}
+	}
+	sinSigma, cosSigma = math.Sin(sigma), math.Cos(sigma)
+	cos2SigmaM = math.Cos(2*sigma1 + sigma)
+	x := sinU1*sinSigma - cosU1*cosSigma*cosAlpha1
+	lat2Rad := math.Atan2(sinU1*cosSigma+cosU1*sinSigma*cosAlpha1, (1-wgs84F)*math.Hypot(sinAlpha, x))
+	lambda := math.Atan2(sinSigma*sinAlpha1, cosU1*cosSigma-sinU1*sinSigma*cosAlpha1)
+	C := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+	L := lambda - (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+	alpha2 := math.Atan2(sinAlpha, -x)
+	return toDeg(lat2Rad), normalizeLongitude(lon + toDeg(L)), normalizeBearing(toDeg(alpha2))
+}
+
+// vincentyAB returns the A and B coefficients used in Vincenty's formulas.
+func vincentyAB(cosSqAlpha float64) (float64, float64) {
+	u2 := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+	B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+	return A, B
+}
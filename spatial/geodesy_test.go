@@ -0,0 +1,187 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package spatial
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a float64, b float64, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+// dms returns the decimal value of the given degrees, minutes and seconds.
+func dms(d float64, m float64, s float64) float64 {
+	if d < 0 {
+		return d - m/60 - s/3600
+	}
+	return d + m/60 + s/3600
+}
+
+// Reference values for the spherical functions are taken from
+// http://www.movable-type.co.uk/scripts/latlong.html.
+var (
+	landsEndLat, landsEndLon       = dms(50, 3, 59), dms(-5, 42, 53)
+	johnOGroatsLat, johnOGroatsLon = dms(58, 38, 38), dms(-3, 4, 12)
+)
+
+type SphericalTest struct {
+	t         string
+	f         func() float64
+	r         float64
+	tolerance float64
+}
+
+var sphericalTests = []SphericalTest{
+	{
+		"distance lands end to john o'groats",
+		func() float64 { return Distance(landsEndLat, landsEndLon, johnOGroatsLat, johnOGroatsLon) },
+		968900, 100,
+	},
+	{
+		"distance same point",
+		func() float64 { return Distance(46.5, 6.5, 46.5, 6.5) },
+		0, 0,
+	},
+	{
+		"distance one degree along the equator",
+		func() float64 { return Distance(0, 0, 0, 1) },
+		111194.93, 0.01,
+	},
+	{
+		"initial bearing lands end to john o'groats",
+		func() float64 { return InitialBearing(landsEndLat, landsEndLon, johnOGroatsLat, johnOGroatsLon) },
+		dms(9, 7, 11), 0.001,
+	},
+	{
+		"final bearing lands end to john o'groats",
+		func() float64 { return FinalBearing(landsEndLat, landsEndLon, johnOGroatsLat, johnOGroatsLon) },
+		dms(11, 16, 31), 0.001,
+	},
+	{
+		"initial bearing due west",
+		func() float64 { return InitialBearing(0, 1, 0, 0) },
+		270, 1e-9,
+	},
+	{
+		"cross track distance",
+		func() float64 { return CrossTrackDistance(53.2611, -0.7972, 53.3206, -1.7297, 53.1887, 0.1334) },
+		-307.5, 0.1,
+	},
+	{
+		"along track distance",
+		func() float64 { return AlongTrackDistance(53.2611, -0.7972, 53.3206, -1.7297, 53.1887, 0.1334) },
+		62331.5, 1,
+	},
+	{
+		"along track distance behind the start",
+		func() float64 { return AlongTrackDistance(0, -1, 0, 0, 0, 1) },
+		-111194.93, 0.01,
+	},
+}
+
+func TestSpherical(t *testing.T) {
+	for _, test := range sphericalTests {
+		result := test.f()
+		if !near(result, test.r, test.tolerance) {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, result)
+		}
+	}
+}
+
+func TestDestination(t *testing.T) {
+	lat, lon := Destination(dms(53, 19, 14), dms(-1, 43, 47), dms(96, 1, 18), 124800)
+	if !near(lat, dms(53, 11, 18), 0.001) || !near(lon, dms(0, 8, 0), 0.001) {
+		t.Errorf("expected %v %v got %v %v", dms(53, 11, 18), dms(0, 8, 0), lat, lon)
+	}
+	lat, lon = Destination(0, 179.5, 90, Distance(0, 0, 0, 1))
+	if !near(lat, 0, 1e-9) || !near(lon, -179.5, 1e-9) {
+		t.Errorf("expected antimeridian wrap to 0 -179.5 got %v %v", lat, lon)
+	}
+}
+
+func TestMidpoint(t *testing.T) {
+	lat, lon := Midpoint(landsEndLat, landsEndLon, johnOGroatsLat, johnOGroatsLon)
+	if !near(lat, dms(54, 21, 44), 0.001) || !near(lon, dms(-4, 31, 50), 0.001) {
+		t.Errorf("expected %v %v got %v %v", dms(54, 21, 44), dms(-4, 31, 50), lat, lon)
+	}
+}
+
+// Reference values for the ellipsoidal functions are the ones from
+// Vincenty's original paper (Flinders Peak to Buninyong).
+var (
+	flindersLat, flindersLon   = dms(-37, 57, 3.72030), dms(144, 25, 29.52440)
+	buninyongLat, buninyongLon = dms(-37, 39, 10.15610), dms(143, 55, 35.38390)
+	flindersBearing            = dms(306, 52, 5.37)
+	buninyongBearing           = dms(307, 10, 25.07)
+	flindersDistance           = 54972.271
+)
+
+func TestVincentyDistance(t *testing.T) {
+	d, b1, b2, err := VincentyDistance(flindersLat, flindersLon, buninyongLat, buninyongLon)
+	if err != nil {
+		t.Fatalf("failed to get distance :: %v", err)
+	}
+	if !near(d, flindersDistance, 0.001) {
+		t.Errorf("expected distance %v got %v", flindersDistance, d)
+	}
+	if !near(b1, flindersBearing, 1e-5) || !near(b2, buninyongBearing, 1e-5) {
+		t.Errorf("expected bearings %v %v got %v %v", flindersBearing, buninyongBearing, b1, b2)
+	}
+
+	d, _, _, err = VincentyDistance(46.5, 6.5, 46.5, 6.5)
+	if err != nil || d != 0 {
+		t.Errorf("expected 0 distance for coincident points got %v %v", d, err)
+	}
+
+	// one degree of longitude along the equator is exact on the ellipsoid
+	d, _, _, err = VincentyDistance(0, 0, 0, 1)
+	if err != nil || !near(d, 111319.491, 0.001) {
+		t.Errorf("expected equator distance 111319.491 got %v %v", d, err)
+	}
+
+	// the formula does not converge for nearly antipodal points
+	if _, _, _, err = VincentyDistance(0, 0, 0.5, 179.7); err == nil {
+		t.Errorf("expected error for nearly antipodal points")
+	}
+}
+
+func TestVincentyDestination(t *testing.T) {
+	lat, lon, b := VincentyDestination(flindersLat, flindersLon, flindersBearing, flindersDistance)
+	if !near(lat, buninyongLat, 1e-7) || !near(lon, buninyongLon, 1e-7) {
+		t.Errorf("expected %v %v got %v %v", buninyongLat, buninyongLon, lat, lon)
+	}
+	if !near(b, buninyongBearing, 1e-5) {
+		t.Errorf("expected final bearing %v got %v", buninyongBearing, b)
+	}
+}
+
+func BenchmarkDistance(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Distance(flindersLat, flindersLon, buninyongLat, buninyongLon)
+	}
+}
+
+func BenchmarkVincentyDistance(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		VincentyDistance(flindersLat, flindersLon, buninyongLat, buninyongLon)
+	}
+}
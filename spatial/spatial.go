@@ -20,63 +20,35 @@
 // Package spatial provides functionality for handling spatial data.
 //
 // This includes conversion for lat/lon between different formats (dms,
-// decimal, ...) and other functions coming in the future.
+// decimal, ...), geodesy functions (distance, bearing, ...) and conversion
+// to and from GeoJSON.
 package spatial
 
 import (
 	"errors"
+	"fmt"
+	"image/color"
 	"strconv"
+	"strings"
 
+	"github.com/golang/glog"
 	"github.com/paulmach/go.geojson"
 	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/airspace"
 	"github.com/rochaporto/ezgliding/waypoint"
 )
 
 // DMS2Decimal converts the given coordinates from DMS to decimal format.
+// It returns 0 for invalid input, use ParseCoordinate to get an error.
 func DMS2Decimal(dms string) float64 {
-	var degrees, minutes, seconds float64
-	if len(dms) == 7 {
-		degrees, _ = strconv.ParseFloat(dms[1:3], 64)
-		minutes, _ = strconv.ParseFloat(dms[3:5], 64)
-		seconds, _ = strconv.ParseFloat(dms[5:], 64)
-	} else {
-		degrees, _ = strconv.ParseFloat(dms[1:4], 64)
-		minutes, _ = strconv.ParseFloat(dms[4:6], 64)
-		seconds, _ = strconv.ParseFloat(dms[6:], 64)
-	}
-	var r float64
-	r = degrees + (minutes / 60.0) + (seconds / 3600.0)
-	if dms[0] == 'S' || dms[0] == 'W' {
-		r = r * -1
-	}
+	r, _ := ParseCoordinate(dms)
 	return r
 }
 
 // DMD2Decimal converts the given coordinates from DMD (deg,min,decimalmin) to decimal format.
+// It returns 0 for invalid input, use ParseCoordinate to get an error.
 func DMD2Decimal(dmd string) float64 {
-	var degrees, minutes, dminutes float64
-	if dmd[0] == 'S' || dmd[0] == 'N' {
-		degrees, _ = strconv.ParseFloat(dmd[1:3], 64)
-		minutes, _ = strconv.ParseFloat(dmd[3:5], 64)
-		dminutes, _ = strconv.ParseFloat(dmd[5:], 64)
-	} else if dmd[len(dmd)-1] == 'S' || dmd[len(dmd)-1] == 'N' {
-		degrees, _ = strconv.ParseFloat(dmd[0:2], 64)
-		minutes, _ = strconv.ParseFloat(dmd[2:4], 64)
-		dminutes, _ = strconv.ParseFloat(dmd[4:7], 64)
-	} else if dmd[0] == 'W' || dmd[0] == 'E' {
-		degrees, _ = strconv.ParseFloat(dmd[1:4], 64)
-		minutes, _ = strconv.ParseFloat(dmd[4:6], 64)
-		dminutes, _ = strconv.ParseFloat(dmd[6:], 64)
-	} else if dmd[len(dmd)-1] == 'W' || dmd[len(dmd)-1] == 'E' {
-		degrees, _ = strconv.ParseFloat(dmd[0:3], 64)
-		minutes, _ = strconv.ParseFloat(dmd[3:5], 64)
-		dminutes, _ = strconv.ParseFloat(dmd[5:8], 64)
-	}
-	var r float64
-	r = degrees + ((minutes + (dminutes / 1000.0)) / 60.0)
-	if dmd[0] == 'S' || dmd[0] == 'W' || dmd[len(dmd)-1] == 'S' || dmd[len(dmd)-1] == 'W' {
-		r = r * -1
-	}
+	r, _ := ParseCoordinate(dmd)
 	return r
 }
 
@@ -84,20 +56,27 @@ func DMD2Decimal(dmd string) float64 {
 // The given array can have distinct types (Airfield, Waypoint, Airspace) and the
 // resulting GeoJSON will contain all fields as properties, and an additional one
 // specifying the Go type (ex: "Go": "Airfield"), used later to unmarshal.
-// Airfield and Waypoint result in Point geometries, Airspace in LineString.
+// Airfield and Waypoint result in Point geometries, Airspace in Polygon (with
+// arcs and circles resolved with DefaultArcResolution).
 func Struct2GeoJSON(features []interface{}) (*geojson.FeatureCollection, error) {
 	result := geojson.NewFeatureCollection()
 	for _, e := range features {
-		var f []*geojson.Feature
+		var f *geojson.Feature
 		switch e.(type) {
 		default:
 			return nil, errors.New("geojson convertion not supported")
 		case airfield.Airfield:
-			f = airfield2GeoJSON([]airfield.Airfield{e.(airfield.Airfield)})
+			f = airfield2GeoJSON([]airfield.Airfield{e.(airfield.Airfield)})[0]
 		case waypoint.Waypoint:
-			f = waypoint2GeoJSON([]waypoint.Waypoint{e.(waypoint.Waypoint)})
+			f = waypoint2GeoJSON([]waypoint.Waypoint{e.(waypoint.Waypoint)})[0]
+		case airspace.Airspace:
+			var err error
+			a := e.(airspace.Airspace)
+			if f, err = airspace2GeoJSON(a, DefaultArcResolution); err != nil {
+				return nil, fmt.Errorf("airspace %v :: %v", a.Name, err)
+			}
 		}
-		result.AddFeature(f[0])
+		result.AddFeature(f)
 	}
 	return result, nil
 }
@@ -152,17 +131,23 @@ func GeoJSON2Struct(json string) ([]interface{}, error) {
 		return nil, err
 	}
 	for _, f := range collection.Features {
-		var o interface{}
 		goType := f.PropertyMustString("Go")
 		switch goType {
 		case "Airfield":
-			o = feature2Airfield(f)
+			result = append(result, feature2Airfield(f))
 		case "Waypoint":
-			o = feature2Waypoint(f)
+			result = append(result, feature2Waypoint(f))
+		case "Airspace":
+			airspaces, err := feature2Airspace(f)
+			if err != nil {
+				return result, err
+			}
+			for _, a := range airspaces {
+				result = append(result, a)
+			}
 		default:
 			return result, errors.New("geojson feature given not supported")
 		}
-		result = append(result, o)
 	}
 	return result, nil
 }
@@ -190,3 +175,212 @@ func feature2Waypoint(f *geojson.Feature) waypoint.Waypoint {
 	w.Latitude = f.Geometry.Point[1]
 	return w
 }
+
+// Airspace2GeoJSON returns a collection with a Polygon feature for each of
+// the given airspaces, with arcs and circles resolved with the given
+// resolution (as in AirspacePolygon).
+func Airspace2GeoJSON(airspaces []airspace.Airspace, resolution float64) (*geojson.FeatureCollection, error) {
+	result := geojson.NewFeatureCollection()
+	for _, a := range airspaces {
+		f, err := airspace2GeoJSON(a, resolution)
+		if err != nil {
+			return nil, fmt.Errorf("airspace %v :: %v", a.Name, err)
+		}
+		result.AddFeature(f)
+	}
+	return result, nil
+}
+
+// airspace2GeoJSON converts the given airspace to a GeoJSON Polygon.
+func airspace2GeoJSON(a airspace.Airspace, resolution float64) (*geojson.Feature, error) {
+	polygon, err := AirspacePolygon(a, resolution)
+	if err != nil {
+		return nil, err
+	}
+	ring := make([][]float64, len(polygon))
+	for i, p := range polygon {
+		ring[i] = []float64{p.Longitude, p.Latitude}
+	}
+	floor, ceiling := a.Floor, a.Ceiling
+	if floor == "" {
+		floor = a.FloorAltitude.String()
+	}
+	if ceiling == "" {
+		ceiling = a.CeilingAltitude.String()
+	}
+	g := geojson.NewPolygonFeature([][][]float64{ring})
+	g.SetProperty("ID", a.ID)
+	g.SetProperty("Class", string(a.Class))
+	g.SetProperty("Name", a.Name)
+	g.SetProperty("Type", a.Type)
+	g.SetProperty("Frequency", a.Frequency)
+	g.SetProperty("Station", a.Station)
+	g.SetProperty("Activations", a.Activations)
+	g.SetProperty("Floor", floor)
+	g.SetProperty("Ceiling", ceiling)
+	g.SetProperty("PenStyle", a.Pen.Style)
+	g.SetProperty("PenWidth", a.Pen.Width)
+	g.SetProperty("PenColor", formatColor(a.Pen.Color))
+	g.SetProperty("InsideColor", formatColor(a.Pen.InsideColor))
+	g.SetProperty("Go", "Airspace")
+	return g, nil
+}
+
+// GeoJSON2Airspace returns the airspaces in the given GeoJSON collection,
+// one for each Polygon feature and for each polygon of a MultiPolygon.
+// Features with other geometries are skipped.
+//
+// The properties are the ones set in Airspace2GeoJSON, matched ignoring
+// case so that other sources can be read. Only the outer ring of each
+// polygon is considered.
+func GeoJSON2Airspace(content []byte) ([]airspace.Airspace, error) {
+	collection, err := geojson.UnmarshalFeatureCollection(content)
+	if err != nil {
+		return nil, err
+	}
+	result := []airspace.Airspace{}
+	for _, f := range collection.Features {
+		airspaces, err := feature2Airspace(f)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, airspaces...)
+	}
+	return result, nil
+}
+
+// feature2Airspace converts the given Polygon or MultiPolygon feature.
+func feature2Airspace(f *geojson.Feature) ([]airspace.Airspace, error) {
+	var polygons [][][][]float64
+	switch {
+	case f.Geometry == nil:
+	case f.Geometry.IsPolygon():
+		polygons = [][][][]float64{f.Geometry.Polygon}
+	case f.Geometry.IsMultiPolygon():
+		polygons = f.Geometry.MultiPolygon
+	}
+	if len(polygons) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	a := airspace.Airspace{ID: property(f, "ID"), Name: property(f, "Name"), Type: property(f, "Type"),
+		Station: property(f, "Station"), Floor: property(f, "Floor"), Ceiling: property(f, "Ceiling")}
+	if c := property(f, "Class"); c != "" {
+		a.Class = strings.ToUpper(c)[0]
+	}
+	if v := property(f, "Frequency"); v != "" {
+		if a.Frequency, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("airspace %v :: invalid frequency %v", a.Name, v)
+		}
+	}
+	if v, ok := propertyValue(f, "Activations").([]interface{}); ok {
+		for _, e := range v {
+			a.Activations = append(a.Activations, fmt.Sprint(e))
+		}
+	}
+	if v := property(f, "PenStyle"); v != "" {
+		style, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("airspace %v :: invalid pen style %v", a.Name, v)
+		}
+		a.Pen.Style = airspace.PenStyle(style)
+	}
+	if v := property(f, "PenWidth"); v != "" {
+		if a.Pen.Width, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("airspace %v :: invalid pen width %v", a.Name, v)
+		}
+	}
+	if a.Pen.Color, err = parseColor(property(f, "PenColor")); err != nil {
+		return nil, fmt.Errorf("airspace %v :: %v", a.Name, err)
+	}
+	if a.Pen.InsideColor, err = parseColor(property(f, "InsideColor")); err != nil {
+		return nil, fmt.Errorf("airspace %v :: %v", a.Name, err)
+	}
+	// limits which can't be parsed are Unknown, and kept in Floor and Ceiling
+	if a.Floor != "" {
+		if a.FloorAltitude, err = airspace.ParseAltitude(a.Floor); err != nil {
+			glog.Warningf("airspace %v :: %v", a.Name, err)
+		}
+	}
+	if a.Ceiling != "" {
+		if a.CeilingAltitude, err = airspace.ParseAltitude(a.Ceiling); err != nil {
+			glog.Warningf("airspace %v :: %v", a.Name, err)
+		}
+	}
+
+	result := []airspace.Airspace{}
+	for _, p := range polygons {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("airspace %v :: polygon with no points", a.Name)
+		}
+		r := a
+		r.Segments = nil
+		ring := p[0]
+		// rings are closed, skip the last point
+		if len(ring) > 1 && ring[0][0] == ring[len(ring)-1][0] && ring[0][1] == ring[len(ring)-1][1] {
+			ring = ring[:len(ring)-1]
+		}
+		for _, c := range ring {
+			if len(c) < 2 {
+				return nil, fmt.Errorf("airspace %v :: invalid position %v", a.Name, c)
+			}
+			r.Segments = append(r.Segments, airspace.Segment{Type: airspace.Polygon, Clockwise: true,
+				Coordinate1: FormatLatitude(c[1], OpenAirDecimal) + " " + FormatLongitude(c[0], OpenAirDecimal)})
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// formatColor returns the given color in the #rrggbb notation, or an empty
+// string if nil.
+func formatColor(c color.Color) string {
+	if c == nil {
+		return ""
+	}
+	rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)
+}
+
+// parseColor parses the given #rrggbb color, returning an opaque color or
+// nil if empty.
+func parseColor(s string) (color.Color, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if len(s) != 7 || s[0] != '#' || err != nil {
+		return nil, fmt.Errorf("invalid color :: %v", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// propertyValue returns the value of the given feature property, matching
+// the name ignoring case.
+func propertyValue(f *geojson.Feature, name string) interface{} {
+	if v, ok := f.Properties[name]; ok {
+		return v
+	}
+	for k, v := range f.Properties {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// property returns the given feature property as a string, or an empty
+// string if not set.
+func property(f *geojson.Feature, name string) string {
+	switch v := propertyValue(f, name).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -20,10 +20,12 @@
 package spatial
 
 import (
+	"image/color"
 	"reflect"
 	"testing"
 
 	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/airspace"
 	"github.com/rochaporto/ezgliding/waypoint"
 )
 
@@ -164,6 +166,24 @@ var struct2GeoJSONTests = []Struct2GeoJSONTest{
 		},
 		`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[6.463,46.27]},"properties":{"Catalog":69,"Elevation":1113,"Flags":1032,"Frequency":122.5,"Go":"Airfield","ICAO":"HHHH","ID":"HABER","Length":900,"Name":"HABERE POC69","Region":"FR","Runway":"0119","ShortName":"HABER"}},{"type":"Feature","geometry":{"type":"Point","coordinates":[8.415,46.572]},"properties":{"Description":"FURKAPASS PASSHOEHE","Elevation":2432,"Flags":0,"Go":"Waypoint","ID":"FURKAP","Name":"FURKAP","Region":"CH"}}]}`,
 	},
+	Struct2GeoJSONTest{
+		"simple airspace conversion",
+		[]interface{}{
+			airspace.Airspace{
+				ID: "TMA1", Class: 'C', Name: "TMA GENEVE", Floor: "3500FT AMSL", Ceiling: "FL195",
+				FloorAltitude:   airspace.Altitude{Value: 3500},
+				CeilingAltitude: airspace.Altitude{Value: 195, Unit: airspace.FlightLevel, Reference: airspace.STD},
+				Segments: []airspace.Segment{
+					airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:00:00 N 006:00:00 E"},
+					airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:00:00 N 006:30:00 E"},
+					airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:30:00 N 006:30:00 E"},
+				},
+				Pen: airspace.Pen{Style: airspace.Dash, Width: 2,
+					Color: color.RGBA{R: 0, G: 0, B: 255, A: 255}, InsideColor: color.RGBA{R: 255, G: 128, B: 0, A: 255}},
+			},
+		},
+		`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[6,46],[6.5,46],[6.5,46.5],[6,46]]]},"properties":{"Activations":null,"Ceiling":"FL195","Class":"C","Floor":"3500FT AMSL","Frequency":0,"Go":"Airspace","ID":"TMA1","InsideColor":"#ff8000","Name":"TMA GENEVE","PenColor":"#0000ff","PenStyle":1,"PenWidth":2,"Station":"","Type":""}}]}`,
+	},
 }
 
 func TestStruct2GeoJSON(t *testing.T) {
@@ -212,6 +232,24 @@ func TestGeoJSON2Struct(t *testing.T) {
 	}
 }
 
+func TestStruct2GeoJSONInvalidAirspace(t *testing.T) {
+	_, err := Struct2GeoJSON([]interface{}{
+		airspace.Airspace{Class: 'C', Name: "no segments"},
+	})
+	if err == nil {
+		t.Errorf("expected error got success")
+	}
+}
+
+func TestGeoJSON2StructInvalidAirspace(t *testing.T) {
+	for _, p := range []string{`"PenColor":"blue"`, `"InsideColor":"#12345"`, `"PenStyle":"a"`, `"PenWidth":"a"`} {
+		_, err := GeoJSON2Struct(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[6,46],[6.5,46],[6.5,46.5],[6,46]]]},"properties":{"Go":"Airspace",` + p + `}}]}`)
+		if err == nil {
+			t.Errorf("expected error for %v got success", p)
+		}
+	}
+}
+
 func TestGeoJSON2StructUnsupported(t *testing.T) {
 	_, err := GeoJSON2Struct(`{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[8.415,46.572]},"properties":{"Go":"UnsupportedType"}}]}`)
 	if err == nil {
@@ -225,3 +263,95 @@ func TestGeoJSON2StructInvalid(t *testing.T) {
 		t.Errorf("expected error got success")
 	}
 }
+
+func TestAirspace2GeoJSON(t *testing.T) {
+	a := airspace.Airspace{ID: "A1", Class: 'D', Name: "CTR", Type: "CTR", Frequency: 118.75,
+		Station: "Tower", Activations: []string{"H24"}, Floor: "SFC", Ceiling: "FL65",
+		FloorAltitude:   airspace.Altitude{Reference: airspace.SFC},
+		CeilingAltitude: airspace.Altitude{Value: 65, Unit: airspace.FlightLevel, Reference: airspace.STD},
+		Segments: []airspace.Segment{
+			airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:00:00 N 006:00:00 E"},
+			airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:00:00 N 006:30:00 E"},
+			airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "46:30:00 N 006:30:00 E"},
+		},
+	}
+	collection, err := Airspace2GeoJSON([]airspace.Airspace{a}, 0)
+	if err != nil {
+		t.Fatalf("failed to convert airspace :: %v", err)
+	}
+	if len(collection.Features) != 1 || !collection.Features[0].Geometry.IsPolygon() ||
+		len(collection.Features[0].Geometry.Polygon[0]) != 4 {
+		t.Fatalf("expected a closed polygon with 4 points got %+v", collection.Features)
+	}
+	b, _ := collection.MarshalJSON()
+	result, err := GeoJSON2Airspace(b)
+	if err != nil {
+		t.Fatalf("failed to convert geojson :: %v", err)
+	}
+	if len(result) != 1 || !reflect.DeepEqual(result[0], a) {
+		t.Errorf("wrong airspace, expected\n%+v\ngot\n%+v", a, result)
+	}
+
+	if _, err = Airspace2GeoJSON([]airspace.Airspace{airspace.Airspace{Name: "empty"}}, 0); err == nil {
+		t.Errorf("expected error converting airspace with no segments")
+	}
+}
+
+func TestGeoJSON2Airspace(t *testing.T) {
+	content := `{"type": "FeatureCollection", "features": [
+{"type": "Feature", "properties": {"name": "Multi", "class": "r", "floor": "1000ft", "ceiling": "unl", "frequency": 122.5},
+ "geometry": {"type": "MultiPolygon", "coordinates": [
+  [[[6.0, 46.0], [6.5, 46.0], [6.5, 46.5]]],
+  [[[7.0, 46.0], [7.5, 46.0], [7.5, 46.5], [7.0, 46.0]]]]}},
+{"type": "Feature", "properties": {"name": "Point"}, "geometry": {"type": "Point", "coordinates": [6.0, 46.0]}}
+]}`
+	result, err := GeoJSON2Airspace([]byte(content))
+	if err != nil {
+		t.Fatalf("failed to convert geojson :: %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 airspaces got %v", len(result))
+	}
+	for _, a := range result {
+		if a.Name != "Multi" || a.Class != 'R' || a.Frequency != 122.5 || len(a.Segments) != 3 ||
+			a.FloorAltitude != (airspace.Altitude{Value: 1000}) ||
+			a.CeilingAltitude != (airspace.Altitude{Reference: airspace.UNL}) {
+			t.Errorf("wrong airspace :: %+v", a)
+		}
+	}
+	if result[1].Segments[0].Coordinate1 != "46:00:00 N 007:00:00 E" {
+		t.Errorf("wrong first point :: %v", result[1].Segments[0].Coordinate1)
+	}
+
+	result, err = GeoJSON2Airspace([]byte(`{"type": "FeatureCollection", "features": [{"type": "Feature",
+ "properties": {"floor": "abc", "ceiling": "FL95"},
+ "geometry": {"type": "Polygon", "coordinates": [[[6.0, 46.0], [6.5, 46.0], [6.5, 46.5]]]}}]}`))
+	if err != nil || len(result) != 1 {
+		t.Fatalf("failed to convert airspace with unknown floor :: %v", err)
+	}
+	if result[0].Floor != "abc" || result[0].FloorAltitude.Reference != airspace.Unknown ||
+		result[0].CeilingAltitude.Value != 95 {
+		t.Errorf("expected raw floor and parsed ceiling got %+v", result[0])
+	}
+
+	// points which are not whole seconds are kept to the millisecond
+	result, err = GeoJSON2Airspace([]byte(`{"type": "FeatureCollection", "features": [{"type": "Feature",
+ "geometry": {"type": "Polygon", "coordinates": [[[6.123456, 46.654321], [6.5, 46.0], [6.5, 46.5]]]}}]}`))
+	if err != nil || len(result) != 1 {
+		t.Fatalf("failed to convert airspace with precise points :: %v", err)
+	}
+	lat, lon, err := ParsePosition(result[0].Segments[0].Coordinate1)
+	if err != nil || !near(lat, 46.654321, 1e-6) || !near(lon, 6.123456, 1e-6) {
+		t.Errorf("expected 46.654321 6.123456 got %v %v :: %v", lat, lon, err)
+	}
+
+	for _, c := range []string{
+		"not json",
+		`{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {"frequency": "abc"},
+ "geometry": {"type": "Polygon", "coordinates": [[[6.0, 46.0], [6.5, 46.0], [6.5, 46.5]]]}}]}`,
+	} {
+		if _, err := GeoJSON2Airspace([]byte(c)); err == nil {
+			t.Errorf("expected error converting %v", c)
+		}
+	}
+}
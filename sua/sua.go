@@ -0,0 +1,446 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package sua provides functionality for parsing and writing airspace
+// information in the Tim Newport-Peace (TNP) special use airspace format.
+//
+// Each airspace starts with a TITLE record. TYPE and CLASS apply to all
+// following airspaces, with a new TYPE resetting the class.
+package sua
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/util"
+)
+
+// Fetch gets and returns the airspace definitions at the given location
+// Both http URIs and local (relative or absolute) paths are supported.
+func Fetch(location string) ([]airspace.Airspace, error) {
+	var content []byte
+
+	resp, err := http.Get(location)
+	// case http
+	if err == nil {
+		defer resp.Body.Close()
+		content, err = ioutil.ReadAll(resp.Body)
+	} else { // case file
+		content, err = ioutil.ReadFile(location)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Parse(content)
+}
+
+// Parse parses the content given, retrieving the corresponding array
+// of Airspace objects.
+//
+// Coordinates are kept in the OpenAir notation, and vertical limits in
+// the notation of airspace.Altitude. When no class is given, it is taken
+// from the type (D for danger areas becomes Q, and G for gliding W).
+func Parse(content []byte) ([]airspace.Airspace, error) {
+	p := parser{}
+	for _, r := range tokenize(content) {
+		if err := p.parseRecord(r); err != nil {
+			return nil, util.ParseError{Line: r.line, Err: err}
+		}
+	}
+	p.flush()
+	if p.result == nil {
+		return []airspace.Airspace{}, nil
+	}
+	return p.result, nil
+}
+
+// record is a single line of a TNP file, split in key and value.
+type record struct {
+	line  int
+	key   string
+	value string
+}
+
+// tokenize splits the given content in records, dropping empty lines and
+// comments. Keys are followed by '=' or a space.
+func tokenize(content []byte) []record {
+	result := []record{}
+	lines := strings.Split(strings.TrimPrefix(string(content), "\ufeff"), "\n")
+	for i, line := range lines {
+		if n := strings.Index(line, "#"); n != -1 {
+			line = line[:n]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		r := record{line: i + 1}
+		if n := strings.IndexAny(line, "= \t"); n != -1 {
+			r.key, r.value = line[:n], strings.TrimSpace(line[n+1:])
+		} else {
+			r.key = line
+		}
+		r.key = strings.ToUpper(r.key)
+		result = append(result, r)
+	}
+	return result
+}
+
+// parser keeps the state while parsing a TNP file.
+type parser struct {
+	result  []airspace.Airspace
+	current *airspace.Airspace
+	typ     string
+	class   byte
+	last    string
+}
+
+// flush adds the current airspace to the result.
+func (p *parser) flush() {
+	if p.current != nil {
+		if p.current.Class == 0 && p.current.Type != "" {
+			p.current.Class = classFor(p.current.Type)
+		}
+		p.result = append(p.result, *p.current)
+	}
+	p.current, p.last = nil, ""
+}
+
+// limit parses the vertical limit in the given record, returning it as
+// text and parsed. Limits which can't be parsed are logged and kept only as
+// text, with an Unknown altitude.
+func limit(r record) (string, airspace.Altitude) {
+	a, err := airspace.ParseAltitude(r.value)
+	if err != nil {
+		glog.Warningf("line %d :: %v", r.line, err)
+		return r.value, a
+	}
+	return a.String(), a
+}
+
+// parseRecord updates the parser state with the given record.
+func (p *parser) parseRecord(r record) error {
+	switch r.key {
+	case "INCLUDE", "TYPE", "CLASS", "TITLE", "END":
+	default:
+		if p.current == nil {
+			return fmt.Errorf("record %v outside an airspace (missing TITLE)", r.key)
+		}
+	}
+
+	aspace := p.current
+	switch r.key {
+	case "INCLUDE", "NOTAM", "ICAO", "FIR", "WIDTH":
+	case "END":
+		p.flush()
+	case "TYPE":
+		p.typ, p.class = strings.ToUpper(r.value), 0
+		if aspace != nil && len(aspace.Segments) == 0 {
+			aspace.Type, aspace.Class = p.typ, 0
+		}
+	case "CLASS":
+		if len(r.value) != 1 {
+			return fmt.Errorf("invalid class :: %v", r.value)
+		}
+		p.class = strings.ToUpper(r.value)[0]
+		if aspace != nil && len(aspace.Segments) == 0 {
+			aspace.Class = p.class
+		}
+	case "TITLE":
+		p.flush()
+		p.current = &airspace.Airspace{Name: r.value, Type: p.typ, Class: p.class}
+	case "BASE":
+		aspace.Floor, aspace.FloorAltitude = limit(r)
+	case "TOPS":
+		aspace.Ceiling, aspace.CeilingAltitude = limit(r)
+	case "ACTIVE":
+		aspace.Activations = append(aspace.Activations, r.value)
+	case "RADIO":
+		fields := strings.Fields(r.value)
+		if len(fields) == 0 {
+			return fmt.Errorf("record RADIO with no value")
+		}
+		if f, err := strconv.ParseFloat(fields[len(fields)-1], 64); err == nil {
+			aspace.Frequency, fields = f, fields[:len(fields)-1]
+		}
+		aspace.Station = strings.Join(fields, " ")
+	case "POINT":
+		c, err := position(r.value)
+		if err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, airspace.Segment{Type: airspace.Polygon,
+			Clockwise: true, Coordinate1: c})
+		p.last = c
+	case "CLOCKWISE", "ANTI-CLOCKWISE", "ANTICLOCKWISE":
+		attrs, err := attributes(r.value, "RADIUS", "CENTRE", "TO")
+		if err != nil {
+			return err
+		}
+		if p.last == "" {
+			return fmt.Errorf("arc with no start point")
+		}
+		x, err := position(attrs["CENTRE"])
+		if err != nil {
+			return err
+		}
+		to, err := position(attrs["TO"])
+		if err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, airspace.Segment{Type: airspace.Arc,
+			Clockwise: r.key == "CLOCKWISE", X: x, Coordinate1: p.last, Coordinate2: to})
+		p.last = to
+	case "CIRCLE":
+		attrs, err := attributes(r.value, "RADIUS", "CENTRE")
+		if err != nil {
+			return err
+		}
+		radius, err := strconv.ParseFloat(attrs["RADIUS"], 64)
+		if err != nil {
+			return fmt.Errorf("invalid radius :: %v", attrs["RADIUS"])
+		}
+		x, err := position(attrs["CENTRE"])
+		if err != nil {
+			return err
+		}
+		aspace.Segments = append(aspace.Segments, airspace.Segment{Type: airspace.Circle,
+			Clockwise: true, X: x, Radius: radius})
+	default:
+		return fmt.Errorf("unrecognized key '%v'", r.key)
+	}
+	return nil
+}
+
+// attributes splits the given value in KEY=value pairs, returning an
+// error if any of the given keys is missing. CENTER is taken as CENTRE.
+func attributes(value string, keys ...string) (map[string]string, error) {
+	result := map[string]string{}
+	key := ""
+	for _, f := range strings.Fields(value) {
+		if n := strings.Index(f, "="); n != -1 {
+			key = strings.ToUpper(f[:n])
+			if key == "CENTER" {
+				key = "CENTRE"
+			}
+			result[key] = f[n+1:]
+		} else if key != "" {
+			result[key] = strings.TrimSpace(result[key] + " " + f)
+		} else {
+			return nil, fmt.Errorf("invalid attribute :: %v", f)
+		}
+	}
+	for _, k := range keys {
+		if _, ok := result[k]; !ok {
+			return nil, fmt.Errorf("missing %v :: %v", k, value)
+		}
+	}
+	return result, nil
+}
+
+// position parses the given coordinate pair, returning it in the OpenAir
+// notation.
+func position(value string) (string, error) {
+	lat, lon, err := spatial.ParsePosition(value)
+	if err != nil {
+		return "", err
+	}
+	return spatial.FormatLatitude(lat, spatial.OpenAir) + " " + spatial.FormatLongitude(lon, spatial.OpenAir), nil
+}
+
+// classFor returns the class for the given TNP type, as in OpenAir the
+// first letter except for danger areas and gliding sectors.
+func classFor(typ string) byte {
+	switch typ {
+	case "D", "DANGER":
+		return 'Q'
+	case "G", "GSEC":
+		return 'W'
+	}
+	return typ[0]
+}
+
+// typeFor returns the TNP type for the given class, when none is given.
+func typeFor(class byte) string {
+	switch class {
+	case 'Q':
+		return "D"
+	case 'R', 'P':
+		return string(class)
+	case 'W':
+		return "G"
+	}
+	if class >= 'A' && class <= 'G' {
+		return "CTA/CTR"
+	}
+	return "OTHER"
+}
+
+// Write writes the given airspaces in the TNP format.
+//
+// TYPE and CLASS are written for every airspace, and arcs given as angles
+// (DA) are written with their start point. Records end in CRLF.
+func Write(w io.Writer, airspaces []airspace.Airspace) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "INCLUDE=YES\r\n")
+	for _, a := range airspaces {
+		fmt.Fprintf(bw, "\r\n")
+		if err := writeAirspace(bw, a); err != nil {
+			return fmt.Errorf("airspace %v :: %v", a.Name, err)
+		}
+	}
+	fmt.Fprintf(bw, "\r\nEND\r\n")
+	return bw.Flush()
+}
+
+// writeAirspace writes a single airspace definition.
+func writeAirspace(w io.Writer, a airspace.Airspace) error {
+	record := func(key string, value string) {
+		fmt.Fprintf(w, "%v=%v\r\n", key, value)
+	}
+	if a.Class == 0 {
+		return fmt.Errorf("missing class")
+	}
+	typ := strings.ToUpper(a.Type)
+	if typ == "" {
+		typ = typeFor(a.Class)
+	}
+	record("TYPE", typ)
+	if classFor(typ) != a.Class {
+		record("CLASS", string(a.Class))
+	}
+	record("TITLE", a.Name)
+	for _, v := range a.Activations {
+		record("ACTIVE", v)
+	}
+	if a.Station != "" || a.Frequency != 0 {
+		radio := a.Station
+		if a.Frequency != 0 {
+			radio = strings.TrimSpace(radio + " " + strconv.FormatFloat(a.Frequency, 'f', 3, 64))
+		}
+		record("RADIO", radio)
+	}
+	base, err := altitude(a.Floor, a.FloorAltitude)
+	if err != nil {
+		return err
+	}
+	tops, err := altitude(a.Ceiling, a.CeilingAltitude)
+	if err != nil {
+		return err
+	}
+	record("BASE", base)
+	record("TOPS", tops)
+
+	last := ""
+	point := func(lat, lon float64) {
+		c := spatial.FormatLatitude(lat, spatial.Welt2000) + " " + spatial.FormatLongitude(lon, spatial.Welt2000)
+		if c != last {
+			record("POINT", c)
+			last = c
+		}
+	}
+	for _, s := range a.Segments {
+		switch s.Type {
+		case airspace.Polygon:
+			lat, lon, err := spatial.ParsePosition(s.Coordinate1)
+			if err != nil {
+				return err
+			}
+			point(lat, lon)
+		case airspace.Circle:
+			xlat, xlon, err := spatial.ParsePosition(s.X)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "CIRCLE RADIUS=%v CENTRE=%v %v\r\n", formatFloat(s.Radius),
+				spatial.FormatLatitude(xlat, spatial.Welt2000), spatial.FormatLongitude(xlon, spatial.Welt2000))
+		case airspace.Arc:
+			xlat, xlon, err := spatial.ParsePosition(s.X)
+			if err != nil {
+				return err
+			}
+			var lat1, lon1, lat2, lon2 float64
+			if s.Coordinate1 != "" {
+				if lat1, lon1, err = spatial.ParsePosition(s.Coordinate1); err != nil {
+					return err
+				}
+				if lat2, lon2, err = spatial.ParsePosition(s.Coordinate2); err != nil {
+					return err
+				}
+			} else {
+				lat1, lon1 = spatial.Destination(xlat, xlon, s.AngleStart, s.Radius*spatial.NauticalMile)
+				lat2, lon2 = spatial.Destination(xlat, xlon, s.AngleEnd, s.Radius*spatial.NauticalMile)
+			}
+			point(lat1, lon1)
+			direction := "CLOCKWISE"
+			if !s.Clockwise {
+				direction = "ANTI-CLOCKWISE"
+			}
+			radius := spatial.Distance(xlat, xlon, lat1, lon1) / spatial.NauticalMile
+			last = spatial.FormatLatitude(lat2, spatial.Welt2000) + " " + spatial.FormatLongitude(lon2, spatial.Welt2000)
+			fmt.Fprintf(w, "%v RADIUS=%v CENTRE=%v %v TO=%v\r\n", direction,
+				formatFloat(math.Floor(radius*100+0.5)/100),
+				spatial.FormatLatitude(xlat, spatial.Welt2000), spatial.FormatLongitude(xlon, spatial.Welt2000), last)
+		default:
+			return fmt.Errorf("unknown segment type :: %v", s.Type)
+		}
+	}
+	return nil
+}
+
+// altitude returns the given altitude in the TNP notation, with meters
+// converted to feet. Unknown altitudes are written as the raw text.
+func altitude(raw string, a airspace.Altitude) (string, error) {
+	if a.Reference == airspace.Unknown {
+		if raw == "" {
+			return "", fmt.Errorf("unknown altitude with no text")
+		}
+		return raw, nil
+	}
+	v := a.Value
+	if a.Unit == airspace.Meters {
+		v = math.Floor(a.Value/0.3048 + 0.5)
+	}
+	switch {
+	case a.Reference == airspace.SFC:
+		return "SFC", nil
+	case a.Reference == airspace.UNL:
+		return "UNLTD", nil
+	case a.Unit == airspace.FlightLevel:
+		return "FL" + formatFloat(v), nil
+	case a.Reference == airspace.STD:
+		return "FL" + formatFloat(math.Floor(v/100+0.5)), nil
+	case a.Reference == airspace.AGL:
+		return formatFloat(v) + "AGL", nil
+	}
+	return formatFloat(v) + "ALT", nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
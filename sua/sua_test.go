@@ -0,0 +1,245 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package sua
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rochaporto/ezgliding/airspace"
+	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/util"
+)
+
+const testSUA = `# sample TNP file
+INCLUDE=YES
+
+TYPE=CTA/CTR
+CLASS=D
+TITLE=BRISTOL CTR
+RADIO=BRISTOL RADAR 125.650
+BASE=SFC
+TOPS=FL65
+POINT=N512300 W0024500
+POINT=N512300 W0023000   # inline comment
+CLOCKWISE RADIUS=5 CENTRE=N511800 W0023000 TO=N511300 W0023000
+ANTI-CLOCKWISE RADIUS=5 CENTER=N511800 W0023000 TO=N511800 W0022200
+
+TITLE=BRISTOL CTA
+BASE=1500ALT
+TOPS=UNLTD
+CIRCLE RADIUS=2.5 CENTRE=N511800 W0023000
+
+TYPE=D
+TITLE=D123 LARKHILL
+ACTIVE=WEEKDAYS
+BASE=0
+TOPS=1000AGL
+CIRCLE RADIUS=1 CENTRE=N511200 W0014800
+END
+`
+
+var testAirspaces = []airspace.Airspace{
+	airspace.Airspace{
+		Class: 'D', Type: "CTA/CTR", Name: "BRISTOL CTR", Frequency: 125.65, Station: "BRISTOL RADAR",
+		Floor: "SFC", Ceiling: "FL65",
+		FloorAltitude:   airspace.Altitude{Reference: airspace.SFC},
+		CeilingAltitude: airspace.Altitude{Value: 65, Unit: airspace.FlightLevel, Reference: airspace.STD},
+		Segments: []airspace.Segment{
+			airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "51:23:00 N 002:45:00 W"},
+			airspace.Segment{Type: airspace.Polygon, Clockwise: true, Coordinate1: "51:23:00 N 002:30:00 W"},
+			airspace.Segment{Type: airspace.Arc, Clockwise: true, X: "51:18:00 N 002:30:00 W",
+				Coordinate1: "51:23:00 N 002:30:00 W", Coordinate2: "51:13:00 N 002:30:00 W"},
+			airspace.Segment{Type: airspace.Arc, Clockwise: false, X: "51:18:00 N 002:30:00 W",
+				Coordinate1: "51:13:00 N 002:30:00 W", Coordinate2: "51:18:00 N 002:22:00 W"},
+		},
+	},
+	airspace.Airspace{
+		Class: 'D', Type: "CTA/CTR", Name: "BRISTOL CTA",
+		Floor: "1500FT AMSL", Ceiling: "UNL",
+		FloorAltitude:   airspace.Altitude{Value: 1500},
+		CeilingAltitude: airspace.Altitude{Reference: airspace.UNL},
+		Segments: []airspace.Segment{
+			airspace.Segment{Type: airspace.Circle, Clockwise: true, X: "51:18:00 N 002:30:00 W", Radius: 2.5},
+		},
+	},
+	airspace.Airspace{
+		Class: 'Q', Type: "D", Name: "D123 LARKHILL", Activations: []string{"WEEKDAYS"},
+		Floor: "0FT AMSL", Ceiling: "1000FT AGL",
+		FloorAltitude:   airspace.Altitude{},
+		CeilingAltitude: airspace.Altitude{Value: 1000, Reference: airspace.AGL},
+		Segments: []airspace.Segment{
+			airspace.Segment{Type: airspace.Circle, Clockwise: true, X: "51:12:00 N 001:48:00 W", Radius: 1},
+		},
+	},
+}
+
+func TestParse(t *testing.T) {
+	result, err := Parse([]byte(testSUA))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	if len(result) != len(testAirspaces) {
+		t.Fatalf("expected %v airspaces got %v", len(testAirspaces), len(result))
+	}
+	for i := range result {
+		if !reflect.DeepEqual(result[i], testAirspaces[i]) {
+			t.Errorf("wrong airspace, expected\n%+v\ngot\n%+v", testAirspaces[i], result[i])
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	result, err := Parse([]byte("# nothing\n\nINCLUDE=YES\n"))
+	if err != nil || len(result) != 0 {
+		t.Errorf("expected no airspaces got %v :: %v", result, err)
+	}
+}
+
+type ParseErrorTest struct {
+	t    string
+	c    string
+	line int
+}
+
+var parseErrorTests = []ParseErrorTest{
+	{"record before TITLE", "TYPE=D\nBASE=SFC", 2},
+	{"bad class", "CLASS=DE", 1},
+	{"empty radio", "TITLE=A\nRADIO=", 2},
+	{"bad point", "TITLE=A\n\nPOINT=N5123 W00245", 3},
+	{"arc with no start", "TITLE=A\nCLOCKWISE RADIUS=5 CENTRE=N511800 W0023000 TO=N511300 W0023000", 2},
+	{"arc with no end", "TITLE=A\nPOINT=N512300 W0023000\nCLOCKWISE RADIUS=5 CENTRE=N511800 W0023000", 3},
+	{"arc bad center", "TITLE=A\nPOINT=N512300 W0023000\nCLOCKWISE RADIUS=5 CENTRE=abc TO=N511300 W0023000", 3},
+	{"arc bad end", "TITLE=A\nPOINT=N512300 W0023000\nCLOCKWISE RADIUS=5 CENTRE=N511800 W0023000 TO=abc", 3},
+	{"bad attribute", "TITLE=A\nCIRCLE 5 CENTRE=N511800 W0023000", 2},
+	{"bad radius", "TITLE=A\nCIRCLE RADIUS=a CENTRE=N511800 W0023000", 2},
+	{"circle bad center", "TITLE=A\nCIRCLE RADIUS=5 CENTRE=N511800", 2},
+	{"unknown key", "TITLE=A\nFOO=1", 2},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		_, err := Parse([]byte(test.c))
+		perr, ok := err.(util.ParseError)
+		if !ok {
+			t.Errorf("%v failed :: expected parse error got %v", test.t, err)
+			continue
+		}
+		if perr.Line != test.line {
+			t.Errorf("%v failed :: expected error in line %v got %v", test.t, test.line, perr)
+		}
+	}
+}
+
+func TestParseUnknownAltitude(t *testing.T) {
+	result, err := Parse([]byte("TYPE=R\nTITLE=A\nBASE=AGL 1000FT+\nTOPS=UNLTD\nPOINT=N512300 W0023000\n"))
+	if err != nil {
+		t.Fatalf("failed to parse airspace with unknown base :: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected 1 airspace got %v", len(result))
+	}
+	a := result[0]
+	if a.Floor != "AGL 1000FT+" || a.FloorAltitude.Reference != airspace.Unknown {
+		t.Errorf("expected raw base and unknown altitude got %v and %v", a.Floor, a.FloorAltitude)
+	}
+	if a.CeilingAltitude.Reference != airspace.UNL {
+		t.Errorf("expected unlimited tops got %v", a.CeilingAltitude)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, result); err != nil {
+		t.Fatalf("failed to write airspace with unknown base :: %v", err)
+	}
+	if !strings.Contains(buf.String(), "BASE=AGL 1000FT+\r\nTOPS=UNLTD\r\n") {
+		t.Errorf("expected raw base to be written got\n%v", buf.String())
+	}
+}
+
+func TestWrite(t *testing.T) {
+	airspaces := []airspace.Airspace{
+		airspace.Airspace{Class: 'R', Name: "R1", Frequency: 120.5,
+			FloorAltitude: airspace.Altitude{Value: 300, Unit: airspace.Meters}, CeilingAltitude: airspace.Altitude{Value: 6500, Reference: airspace.STD},
+			Segments: []airspace.Segment{
+				airspace.Segment{Type: airspace.Polygon, Coordinate1: "51:00:00 N 002:00:00 W"},
+				airspace.Segment{Type: airspace.Arc, X: "51:00:00 N 002:00:00 W", Clockwise: true,
+					Radius: 1, AngleStart: 0, AngleEnd: 180},
+			},
+		},
+	}
+	expected := "INCLUDE=YES\r\n\r\nTYPE=R\r\nTITLE=R1\r\nRADIO=120.500\r\nBASE=984ALT\r\nTOPS=FL65\r\n" +
+		"POINT=N510000 W0020000\r\nPOINT=N510100 W0020000\r\n" +
+		"CLOCKWISE RADIUS=1 CENTRE=N510000 W0020000 TO=N505900 W0020000\r\n\r\nEND\r\n"
+	var buf bytes.Buffer
+	if err := Write(&buf, airspaces); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("wrong output, expected\n%v\ngot\n%v", expected, buf.String())
+	}
+
+	for _, a := range []airspace.Airspace{
+		airspace.Airspace{Name: "no class"},
+		airspace.Airspace{Class: 'A', Name: "bad segment",
+			Segments: []airspace.Segment{airspace.Segment{Type: airspace.SegmentType(10)}}},
+		airspace.Airspace{Class: 'A', Name: "bad point",
+			Segments: []airspace.Segment{airspace.Segment{Type: airspace.Polygon, Coordinate1: "abc"}}},
+		airspace.Airspace{Class: 'A', Name: "unknown base", FloorAltitude: airspace.Altitude{Reference: airspace.Unknown}},
+	} {
+		if err := Write(&buf, []airspace.Airspace{a}); err == nil {
+			t.Errorf("expected error writing %v", a.Name)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testAirspaces); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	result, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written airspace :: %v", err)
+	}
+	if len(result) != len(testAirspaces) {
+		t.Fatalf("expected %v airspaces got %v", len(testAirspaces), len(result))
+	}
+	for i := range result {
+		r, e := result[i], testAirspaces[i]
+		if r.Name != e.Name || r.Class != e.Class || r.Type != e.Type || r.Floor != e.Floor ||
+			r.Ceiling != e.Ceiling || r.Frequency != e.Frequency || r.Station != e.Station {
+			t.Errorf("wrong airspace, expected\n%+v\ngot\n%+v", e, r)
+		}
+		rp, _ := spatial.AirspacePolygon(r, 0)
+		ep, _ := spatial.AirspacePolygon(e, 0)
+		if len(rp) != len(ep) {
+			t.Errorf("%v :: expected %v points got %v", e.Name, len(ep), len(rp))
+			continue
+		}
+		for j := range rp {
+			if math.Abs(rp[j].Latitude-ep[j].Latitude) > 1e-6 || math.Abs(rp[j].Longitude-ep[j].Longitude) > 1e-6 {
+				t.Errorf("%v :: point %v differs, expected %+v got %+v", e.Name, j, ep[j], rp[j])
+			}
+		}
+	}
+}
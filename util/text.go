@@ -0,0 +1,60 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DecodeText returns the given content as a UTF-8 string.
+//
+// Content which is not valid UTF-8 is taken as ISO-8859-1 (Latin-1), still
+// common in files produced by older flight software. A leading UTF-8 byte
+// order mark is removed.
+func DecodeText(content []byte) string {
+	if utf8.Valid(content) {
+		return strings.TrimPrefix(string(content), "\ufeff")
+	}
+	return DecodeLatin1(content)
+}
+
+// DecodeLatin1 returns the given ISO-8859-1 (Latin-1) content as a UTF-8
+// string.
+func DecodeLatin1(content []byte) string {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// EncodeLatin1 returns the given string encoded as ISO-8859-1 (Latin-1),
+// with characters not available in it replaced by '?'.
+func EncodeLatin1(s string) []byte {
+	result := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			r = '?'
+		}
+		result = append(result, byte(r))
+	}
+	return result
+}
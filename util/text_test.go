@@ -0,0 +1,71 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+var decodeTextTests = []struct {
+	t       string
+	content []byte
+	r       string
+}{
+	{"ascii", []byte("Challes"), "Challes"},
+	{"utf8", []byte("Zürich"), "Zürich"},
+	{"utf8 with bom", []byte("\xef\xbb\xbfZürich"), "Zürich"},
+	{"latin1", []byte("Z\xfcrich"), "Zürich"},
+	{"empty", []byte{}, ""},
+}
+
+func TestDecodeText(t *testing.T) {
+	for _, test := range decodeTextTests {
+		if r := DecodeText(test.content); r != test.r {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, r)
+		}
+	}
+}
+
+func TestDecodeLatin1(t *testing.T) {
+	// valid UTF-8 is still taken as Latin-1
+	if r := DecodeLatin1([]byte("\xc3\xa9t\xe9")); r != "\u00c3\u00a9t\u00e9" {
+		t.Errorf("expected latin-1 decoding got %q", r)
+	}
+}
+
+var encodeLatin1Tests = []struct {
+	t string
+	s string
+	r []byte
+}{
+	{"ascii", "Challes", []byte("Challes")},
+	{"latin1", "Zürich", []byte("Z\xfcrich")},
+	{"unavailable", "Łódź", []byte("?\xf3d?")},
+	{"empty", "", []byte{}},
+}
+
+func TestEncodeLatin1(t *testing.T) {
+	for _, test := range encodeLatin1Tests {
+		if r := EncodeLatin1(test.s); !bytes.Equal(r, test.r) {
+			t.Errorf("test %v failed, expected %q got %q", test.t, test.r, r)
+		}
+	}
+}
@@ -45,4 +45,21 @@ type Waypointer interface {
 }
 
 // Enum for Waypoint flags
-const ()
+const (
+	MountainPass   = 1 << iota
+	MountainTop    = 1 << iota
+	Mast           = 1 << iota
+	VOR            = 1 << iota
+	NDB            = 1 << iota
+	CoolingTower   = 1 << iota
+	Dam            = 1 << iota
+	Tunnel         = 1 << iota
+	Bridge         = 1 << iota
+	PowerPlant     = 1 << iota
+	Castle         = 1 << iota
+	Intersection   = 1 << iota
+	Hut            = 1 << iota
+	Obstacle       = 1 << iota
+	RailwayStation = 1 << iota
+	HighwayExit    = 1 << iota
+)
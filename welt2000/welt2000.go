@@ -26,16 +26,24 @@
 package welt2000
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/rochaporto/ezgliding/airfield"
 	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/util"
 	"github.com/rochaporto/ezgliding/waypoint"
 	"github.com/rochaporto/rss"
 )
@@ -45,12 +53,14 @@ const (
 	ID string = "welt2000"
 )
 
-// Release contains info about a specific release
+// Release contains info about a specific release.
+// Errors holds the records skipped when parsing, with their line numbers.
 type Release struct {
 	Date      time.Time
 	Source    string
 	Airfields []airfield.Airfield
 	Waypoints []waypoint.Waypoint
+	Errors    []util.ParseError `json:"-"`
 }
 
 const (
@@ -61,15 +71,22 @@ const (
 )
 
 // Config holds all config information for the welt2000 plugin.
+// File is the local release written by PutAirfield and PutWaypoint.
+// Cache is where the last fetched release is kept, so that it's only
+// fetched again when a new one is available (in memory only if not set).
 type Config struct {
 	RSSURL     string
 	ReleaseURL string
+	File       string
+	Cache      string
 }
 
 // Welt2000 is the plugin implementation to collect welt2000 data,
 // for airfields and waypoints.
 type Welt2000 struct {
 	Config
+	mutex sync.Mutex
+	last  *Release
 }
 
 // New returns a new instance of Welt2000.
@@ -81,90 +98,151 @@ func New(cfg Config) (*Welt2000, error) {
 		cfg.ReleaseURL = ReleaseURL
 	}
 	wt := Welt2000{Config: cfg}
-	glog.V(20).Infof("Plugin welt2000 initialized :: %+v", wt)
+	glog.V(20).Infof("Plugin welt2000 initialized :: %+v", wt.Config)
 	return &wt, nil
 }
 
 // GetAirfield follows airfield.GetAirfield().
-// FIXME: use region
+// Only airfields added or modified after updatedSince are returned, based
+// on the difference between consecutive releases.
 func (wt *Welt2000) GetAirfield(regions []string, updatedSince time.Time) ([]airfield.Airfield, error) {
 	glog.V(10).Infof("GetAirfield with regions %v and updatedSince %v", regions, updatedSince)
-	releases, err := List(wt.RSSURL)
+	release, err := wt.latest()
 	if err != nil {
 		return nil, err
 	}
-	release := releases[0]
-	if !release.Date.After(updatedSince) {
-		return release.Airfields, nil
-	}
-
-	// We 'update' the release source as the rss feed points to an update
-	// summary page, not the actually release source.
-	release.Source = wt.ReleaseURL
-	err = release.Fetch()
-	// Filter out entries not in the regions.
-	// This could be done more efficiently, but for now we go with post-filter.
-	m := make(map[string]bool) // Use a map as there's no slice.contains(str)
-	for _, v := range regions {
-		m[v] = true
-	}
-	var filtered []airfield.Airfield
+	m := regionSet(regions)
+	filtered := []airfield.Airfield{}
 	for _, a := range release.Airfields {
-		if _, ok := m[a.Region]; ok {
+		if (m == nil || m[a.Region]) && a.Update.After(updatedSince) {
 			filtered = append(filtered, a)
 		}
 	}
-	release.Airfields = filtered
 	glog.V(10).Infof("GetAirfield for regions %v and updatedsince %v retrieved %d results",
-		regions, updatedSince, len(release.Airfields))
-	glog.V(20).Infof("%v", release.Airfields)
-	return release.Airfields, err
+		regions, updatedSince, len(filtered))
+	glog.V(20).Infof("%v", filtered)
+	return filtered, nil
 }
 
 // PutAirfield follows airfield.PutAirfield().
+// The airfields in the local release (Config.File) are replaced by the
+// given ones, its waypoints are kept.
 func (wt *Welt2000) PutAirfield(airfields []airfield.Airfield) error {
-	return errors.New("not available for welt2000 plugin")
+	release, err := wt.local()
+	if err != nil {
+		return err
+	}
+	release.Airfields = airfields
+	return release.WriteFile(wt.File)
 }
 
-// GetWaypoint follows airfield.GetWaypoint().
-// FIXME: use region
+// GetWaypoint follows waypoint.GetWaypoint().
+// Only waypoints added or modified after updatedSince are returned, based
+// on the difference between consecutive releases.
 func (wt *Welt2000) GetWaypoint(regions []string, updatedSince time.Time) ([]waypoint.Waypoint, error) {
 	glog.V(10).Infof("GetWaypoint with regions %v and updatedSince %v", regions, updatedSince)
+	release, err := wt.latest()
+	if err != nil {
+		return nil, err
+	}
+	m := regionSet(regions)
+	filtered := []waypoint.Waypoint{}
+	for _, w := range release.Waypoints {
+		if (m == nil || m[w.Region]) && w.Update.After(updatedSince) {
+			filtered = append(filtered, w)
+		}
+	}
+	glog.V(10).Infof("GetWaypoint for regions %v and updatedsince %v retrieved %d results",
+		regions, updatedSince, len(filtered))
+	glog.V(20).Infof("%v", filtered)
+	return filtered, nil
+}
+
+// PutWaypoint follows waypoint.PutWaypoint().
+// The waypoints in the local release (Config.File) are replaced by the
+// given ones, its airfields are kept.
+func (wt *Welt2000) PutWaypoint(waypoints []waypoint.Waypoint) error {
+	release, err := wt.local()
+	if err != nil {
+		return err
+	}
+	release.Waypoints = waypoints
+	return release.WriteFile(wt.File)
+}
+
+// latest returns the latest release, fetching it only if it's newer than
+// the last one (in memory or in the cache).
+//
+// Records unchanged since the last release keep their update time, so that
+// only added and modified records have the new release date.
+func (wt *Welt2000) latest() (*Release, error) {
+	wt.mutex.Lock()
+	defer wt.mutex.Unlock()
 	releases, err := List(wt.RSSURL)
 	if err != nil {
 		return nil, err
 	}
-	release := releases[0]
-	if !release.Date.After(updatedSince) {
-		return release.Waypoints, nil
+	if wt.last == nil && wt.Cache != "" {
+		if wt.last, err = loadRelease(wt.Cache); err != nil {
+			return nil, err
+		}
+	}
+	if wt.last != nil && !releases[0].Date.After(wt.last.Date) {
+		glog.V(10).Infof("Release from %v already available", wt.last.Date)
+		return wt.last, nil
 	}
 
 	// We 'update' the release source as the rss feed points to an update
 	// summary page, not the actually release source.
-	release.Source = wt.ReleaseURL
-	err = release.Fetch()
-	// Filter out entries not in the regions.
-	// This could be done more efficiently, but for now we go with post-filter.
-	m := make(map[string]bool) // Use a map as there's no slice.contains(str)
-	for _, v := range regions {
-		m[v] = true
-	}
-	var filtered []waypoint.Waypoint
-	for _, a := range release.Waypoints {
-		if _, ok := m[a.Region]; ok {
-			filtered = append(filtered, a)
+	release := Release{Date: releases[0].Date, Source: wt.ReleaseURL}
+	if err = release.Fetch(); err != nil {
+		return nil, err
+	}
+	if wt.last != nil {
+		changes := Diff(wt.last, &release)
+		release.keepUpdates(wt.last)
+		glog.V(5).Infof("Release from %v :: %v", release.Date, changes)
+	}
+	if wt.Cache != "" {
+		if err = release.save(wt.Cache); err != nil {
+			return nil, err
 		}
 	}
-	release.Waypoints = filtered
-	glog.V(10).Infof("GetWaypoint for regions %v and updatedsince %v retrieved %d results",
-		regions, updatedSince, len(release.Waypoints))
-	glog.V(20).Infof("%v", release.Waypoints)
-	return release.Waypoints, err
+	wt.last = &release
+	return wt.last, nil
 }
 
-// PutWaypoint follows waypoint.PutWaypoint().
-func (wt *Welt2000) PutWaypoint(waypoints []waypoint.Waypoint) error {
-	return errors.New("not available for welt2000 plugin")
+// regionSet returns the given regions as a set, or nil if no region is
+// given (meaning all regions).
+func regionSet(regions []string) map[string]bool {
+	m := map[string]bool{}
+	for _, r := range regions {
+		if r != "" {
+			m[r] = true
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// local returns the local release, empty if the file does not exist yet.
+func (wt *Welt2000) local() (*Release, error) {
+	if wt.File == "" {
+		return nil, errors.New("no file set for welt2000 plugin")
+	}
+	r := Release{Source: wt.File}
+	content, err := ioutil.ReadFile(wt.File)
+	if os.IsNotExist(err) {
+		return &r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(content) > 0 {
+		err = r.Parse(content)
+	}
+	return &r, err
 }
 
 // List checks the welt2000 rss feed and lists the releases found
@@ -190,7 +268,10 @@ func List(location string) ([]Release, error) {
 		return nil, err
 	}
 
-	res := make([]Release, 10)
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("no releases found :: %v", location)
+	}
+	res := make([]Release, len(feed.Items))
 	for i, item := range feed.Items {
 		res[i].Date = item.Date
 		res[i].Source = item.Link
@@ -227,24 +308,185 @@ func (r *Release) Fetch() error {
 	return r.Parse(content)
 }
 
-// Parse fills in the Release object by parsing r.Data
+// loadRelease loads the release saved at the given location, returning nil
+// if there's none.
+func loadRelease(path string) (*Release, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := Release{}
+	if err = json.Unmarshal(content, &r); err != nil {
+		return nil, fmt.Errorf("invalid release cache :: %v :: %v", path, err)
+	}
+	return &r, nil
+}
+
+// save saves the release at the given location, keeping the update time of
+// each record (not available in the welt2000 format).
+func (r *Release) save(path string) error {
+	content, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// Changes holds the differences between two releases. Airfields are
+// matched by short name and region, waypoints by id and region.
+type Changes struct {
+	AddedAirfields    []airfield.Airfield
+	RemovedAirfields  []airfield.Airfield
+	ModifiedAirfields []airfield.Airfield
+	AddedWaypoints    []waypoint.Waypoint
+	RemovedWaypoints  []waypoint.Waypoint
+	ModifiedWaypoints []waypoint.Waypoint
+}
+
+func (c Changes) String() string {
+	return fmt.Sprintf("airfields %d added, %d removed, %d modified :: waypoints %d added, %d removed, %d modified",
+		len(c.AddedAirfields), len(c.RemovedAirfields), len(c.ModifiedAirfields),
+		len(c.AddedWaypoints), len(c.RemovedWaypoints), len(c.ModifiedWaypoints))
+}
+
+func airfieldKey(a airfield.Airfield) string {
+	return a.ShortName + " " + a.Region
+}
+
+func waypointKey(w waypoint.Waypoint) string {
+	return w.ID + " " + w.Region
+}
+
+// sameAirfield returns true if both airfields are equal, ignoring the
+// update time.
+func sameAirfield(a1 airfield.Airfield, a2 airfield.Airfield) bool {
+	a1.Update, a2.Update = time.Time{}, time.Time{}
+	return a1 == a2
+}
+
+// sameWaypoint returns true if both waypoints are equal, ignoring the
+// update time.
+func sameWaypoint(w1 waypoint.Waypoint, w2 waypoint.Waypoint) bool {
+	w1.Update, w2.Update = time.Time{}, time.Time{}
+	return w1 == w2
+}
+
+// Diff returns the airfields and waypoints added, removed and modified
+// from the previous to the current release. Added and modified records are
+// as in current, removed ones as in previous.
+func Diff(previous *Release, current *Release) Changes {
+	c := Changes{}
+	airfields := make(map[string]airfield.Airfield, len(previous.Airfields))
+	for _, a := range previous.Airfields {
+		airfields[airfieldKey(a)] = a
+	}
+	for _, a := range current.Airfields {
+		old, ok := airfields[airfieldKey(a)]
+		switch {
+		case !ok:
+			c.AddedAirfields = append(c.AddedAirfields, a)
+		case !sameAirfield(old, a):
+			c.ModifiedAirfields = append(c.ModifiedAirfields, a)
+		}
+		delete(airfields, airfieldKey(a))
+	}
+	for _, a := range previous.Airfields {
+		if _, ok := airfields[airfieldKey(a)]; ok {
+			c.RemovedAirfields = append(c.RemovedAirfields, a)
+		}
+	}
+
+	waypoints := make(map[string]waypoint.Waypoint, len(previous.Waypoints))
+	for _, w := range previous.Waypoints {
+		waypoints[waypointKey(w)] = w
+	}
+	for _, w := range current.Waypoints {
+		old, ok := waypoints[waypointKey(w)]
+		switch {
+		case !ok:
+			c.AddedWaypoints = append(c.AddedWaypoints, w)
+		case !sameWaypoint(old, w):
+			c.ModifiedWaypoints = append(c.ModifiedWaypoints, w)
+		}
+		delete(waypoints, waypointKey(w))
+	}
+	for _, w := range previous.Waypoints {
+		if _, ok := waypoints[waypointKey(w)]; ok {
+			c.RemovedWaypoints = append(c.RemovedWaypoints, w)
+		}
+	}
+	return c
+}
+
+// keepUpdates sets the update time of the records unchanged since the
+// previous release to the one they had there.
+func (r *Release) keepUpdates(previous *Release) {
+	airfields := make(map[string]airfield.Airfield, len(previous.Airfields))
+	for _, a := range previous.Airfields {
+		airfields[airfieldKey(a)] = a
+	}
+	for i, a := range r.Airfields {
+		if old, ok := airfields[airfieldKey(a)]; ok && sameAirfield(old, a) {
+			r.Airfields[i].Update = old.Update
+		}
+	}
+	waypoints := make(map[string]waypoint.Waypoint, len(previous.Waypoints))
+	for _, w := range previous.Waypoints {
+		waypoints[waypointKey(w)] = w
+	}
+	for i, w := range r.Waypoints {
+		if old, ok := waypoints[waypointKey(w)]; ok && sameWaypoint(old, w) {
+			r.Waypoints[i].Update = old.Update
+		}
+	}
+}
+
+// lineLength is the minimum length of airfield and waypoint records, up to
+// and including the country code.
+const lineLength = 62
+
+// Parse fills in the Release object by parsing the given content.
+//
+// Lines can end in LF or CRLF, and the content can be ISO-8859-1 (as in the
+// official release) or UTF-8.
+//
+// Invalid records are skipped, logged and kept in Errors. An error is only
+// returned if there are invalid records and none of the others is valid.
 func (r *Release) Parse(content []byte) error {
 	if content == nil || len(content) == 0 {
 		return errors.New("No data available to parse")
 	}
+	records := len(r.Airfields) + len(r.Waypoints)
+	var errs []util.ParseError
 
-	lines := strings.Split(string(content), "\n")
+	lines := strings.Split(util.DecodeText(content), "\n")
 	for i := range lines {
-		switch {
-		case len(lines[i]) == 0: // empty line
-			continue
-		case lines[i][0] == '$': // comment
+		line := strings.TrimRight(lines[i], "\r")
+		if strings.TrimSpace(line) == "" || line[0] == '$' { // empty line or comment
 			continue
-		case lines[i][5] == '1' || lines[i][5] == '2': // airfield
-			r.parseAirfield(lines[i])
+		}
+		// columns are fixed width, so work on the single byte encoding
+		line = string(util.EncodeLatin1(line))
+		var err error
+		switch {
+		case len(line) < lineLength:
+			err = fmt.Errorf("expected at least %d columns got %d", lineLength, len(line))
+		case line[5] == '1' || line[5] == '2': // airfield
+			err = r.parseAirfield(line)
 		default: // waypoint
-			r.parseWaypoint(lines[i])
+			err = r.parseWaypoint(line)
 		}
+		if err != nil {
+			perr := util.ParseError{Line: i + 1, Err: err}
+			glog.Warningf("skipping invalid record :: %v", perr)
+			errs = append(errs, perr)
+		}
+	}
+	r.Errors = append(r.Errors, errs...)
+	if len(errs) > 0 && len(r.Airfields)+len(r.Waypoints) == records {
+		return errs[0]
 	}
 	return nil
 }
@@ -257,7 +499,7 @@ func (r *Release) parseAirfield(line string) error {
 	} else { // regular airstrip
 		afield.ShortName = strings.Trim(line[0:5], " ")
 	}
-	afield.Name = strings.Trim(line[7:20], " ")
+	afield.Name = text(line[7:20])
 	if line[23] == '#' && line[24] != ' ' && string(line[24:28]) != "GLD!" { // ICAO available
 		afield.ICAO = line[24:28]
 		afield.ID = afield.ICAO
@@ -273,21 +515,57 @@ func (r *Release) parseAirfield(line string) error {
 		afield.Flags |= airfield.GliderSite
 	}
 	afield.Flags |= r.runwayType2Bit(line[28])
-	afield.Length, _ = strconv.Atoi(line[29:32])
+	// the length is often incomplete, and ignored in that case
+	afield.Length, _ = strconv.Atoi(strings.Trim(line[29:32], " "))
 	afield.Length *= 10
 	afield.Runway = line[32:36]
-	decimal, _ := strconv.ParseFloat(line[39:41], 64)
-	afield.Frequency, _ = strconv.ParseFloat(line[36:39], 64)
-	afield.Frequency += decimal * 0.01
-	elevation := strings.Trim(line[41:45], " ")
-	afield.Elevation, _ = strconv.Atoi(elevation)
-	afield.Latitude = spatial.DMS2Decimal(line[45:52])
-	afield.Longitude = spatial.DMS2Decimal(line[52:60])
+	// the frequency is set to '1' when not available
+	if strings.Trim(line[36:41], "0123456789") == "" {
+		decimal, _ := strconv.ParseFloat(line[39:41], 64)
+		afield.Frequency, _ = strconv.ParseFloat(line[36:39], 64)
+		afield.Frequency += decimal * 0.01
+	}
+	var err error
+	afield.Elevation, afield.Latitude, afield.Longitude, err = r.parsePosition(line)
+	if err != nil {
+		return err
+	}
 	afield.Region = line[60:62]
 	r.Airfields = append(r.Airfields, afield)
 	return nil
 }
 
+// parsePosition parses the elevation and coordinates common to airfields
+// and waypoints.
+func (r *Release) parsePosition(line string) (int, float64, float64, error) {
+	var elevation int
+	var err error
+	if e := strings.Trim(line[41:45], " "); e != "" {
+		if elevation, err = strconv.Atoi(e); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid elevation :: %v", e)
+		}
+	}
+	lat, err := spatial.ParseLatitude(line[45:52])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	lon, err := spatial.ParseLongitude(line[52:60])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return elevation, lat, lon, nil
+}
+
+// text returns the given single byte (ISO-8859-1) column as a trimmed
+// string.
+func text(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return strings.Trim(string(runes), " ")
+}
+
 func (r *Release) runwayType2Bit(t uint8) int {
 	switch t {
 	case 'A':
@@ -311,14 +589,204 @@ func (r *Release) runwayType2Bit(t uint8) int {
 }
 
 func (r *Release) parseWaypoint(line string) error {
-	waypoint := waypoint.Waypoint{
-		Name: strings.Trim(line[0:6], " "), ID: strings.Trim(line[0:6], " "),
-		Description: strings.Trim(line[7:41], " "),
-		Latitude:    spatial.DMS2Decimal(line[45:52]), Longitude: spatial.DMS2Decimal(line[52:60]),
-		Region: line[60:62], Update: r.Date,
-	}
-	elevation := strings.Trim(line[41:45], " ")
-	waypoint.Elevation, _ = strconv.Atoi(elevation)
-	r.Waypoints = append(r.Waypoints, waypoint)
+	wpoint := waypoint.Waypoint{
+		Name: text(line[0:6]), ID: text(line[0:6]),
+		Description: text(line[7:41]),
+		Region:      line[60:62], Update: r.Date,
+	}
+	wpoint.Flags = r.description2Bit(wpoint.Description)
+	var err error
+	wpoint.Elevation, wpoint.Latitude, wpoint.Longitude, err = r.parsePosition(line)
+	if err != nil {
+		return err
+	}
+	r.Waypoints = append(r.Waypoints, wpoint)
 	return nil
 }
+
+// descriptionWords has the words and abbreviations used in waypoint
+// descriptions (as listed in the spec, plus common words in several
+// languages) for each waypoint type.
+var descriptionWords = []struct {
+	flag  int
+	words []string
+}{
+	{waypoint.MountainPass, []string{"PASS", "PASSHOEHE", "COL", "SATTEL", "JOCH", "PASSO"}},
+	{waypoint.MountainTop, []string{"PEAK", "GIPFEL", "SUMMIT", "MT", "MOUNT", "PIC", "PIZ", "SPITZE", "CIMA"}},
+	{waypoint.Mast, []string{"TV", "TOWER", "TWR", "MAST", "SENDER", "ANTENNA"}},
+	{waypoint.VOR, []string{"VOR"}},
+	{waypoint.NDB, []string{"NDB"}},
+	{waypoint.CoolingTower, []string{"KUEHLTURM", "COOLING"}},
+	{waypoint.Dam, []string{"DAM", "STAUMAUER", "STAUDAMM", "TALSPERRE", "BARRAGE", "DIGA"}},
+	{waypoint.Tunnel, []string{"TUNNEL"}},
+	{waypoint.Bridge, []string{"BR", "BRIDGE", "PONT", "PONTE", "BRUECKE"}},
+	{waypoint.PowerPlant, []string{"KKW", "AKW", "KRAFTWERK", "CENTRALE"}},
+	{waypoint.Castle, []string{"SCHLOSS", "BURG", "CHATEAU", "CASTLE", "CASTELLO", "CASTILLO", "HRAD"}},
+	{waypoint.Intersection, []string{"SX", "SY", "EX", "EY", "XA", "YA", "JUNCTION", "CROSSING", "CROSSROADS",
+		"INTERSECTION", "KREUZ"}},
+	{waypoint.Hut, []string{"HUETTE", "HUT", "CABANE", "REFUGE", "RIFUGIO", "BAUDE"}},
+	{waypoint.Obstacle, []string{"KAMIN", "SCHORNSTEIN", "CHIMNEY", "WINDPARK", "OBSTACLE"}},
+	{waypoint.RailwayStation, []string{"BF", "RS", "BAHNHOF", "GARE", "ESTACION", "STAZIONE", "NADRAZI",
+		"VASUTALLOMAS"}},
+	{waypoint.HighwayExit, []string{"BAB", "AUSFAHRT", "EXIT", "TR"}},
+}
+
+// descriptionSuffixes maps the endings of compound (mostly german) words to
+// the waypoint type, as in FURKAPASS or SCHWARZWALDHUETTE.
+var descriptionSuffixes = []struct {
+	suffix string
+	flag   int
+}{
+	{"KUEHLTURM", waypoint.CoolingTower}, {"PASS", waypoint.MountainPass}, {"JOCH", waypoint.MountainPass},
+	{"SPITZE", waypoint.MountainTop}, {"HUETTE", waypoint.Hut}, {"BRUECKE", waypoint.Bridge},
+	{"KREUZ", waypoint.Intersection}, {"KRAFTWERK", waypoint.PowerPlant}, {"BAHNHOF", waypoint.RailwayStation},
+}
+
+// description2Bit returns the waypoint flags matching the words in the
+// given description.
+func (r *Release) description2Bit(description string) int {
+	flags := 0
+	words := strings.FieldsFunc(strings.ToUpper(description), func(c rune) bool {
+		return strings.ContainsRune(" .,/-!?()", c)
+	})
+	for _, w := range words {
+		flags |= descriptionWord2Bit(w)
+	}
+	return flags
+}
+
+func descriptionWord2Bit(w string) int {
+	for _, d := range descriptionWords {
+		for _, dw := range d.words {
+			if w == dw {
+				return d.flag
+			}
+		}
+	}
+	for _, s := range descriptionSuffixes {
+		if len(w) > len(s.suffix) && strings.HasSuffix(w, s.suffix) {
+			return s.flag
+		}
+	}
+	return 0
+}
+
+// WriteFile writes the release to the given file, as in Write.
+func (r *Release) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = r.Write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes the release airfields and waypoints in the welt2000 format,
+// the reverse of Parse. Lines end in CRLF and are encoded in ISO-8859-1.
+func (r *Release) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, a := range r.Airfields {
+		line, err := r.writeAirfield(a)
+		if err != nil {
+			return fmt.Errorf("airfield %v :: %v", a.Name, err)
+		}
+		bw.Write(util.EncodeLatin1(line + "\r\n"))
+	}
+	for _, wp := range r.Waypoints {
+		line, err := r.writeWaypoint(wp)
+		if err != nil {
+			return fmt.Errorf("waypoint %v :: %v", wp.Name, err)
+		}
+		bw.Write(util.EncodeLatin1(line + "\r\n"))
+	}
+	return bw.Flush()
+}
+
+func (r *Release) writeAirfield(a airfield.Airfield) (string, error) {
+	var line string
+	if a.Flags&airfield.UnclearAirstrip != 0 {
+		line = column(a.ShortName, 4) + "2"
+	} else {
+		line = column(a.ShortName, 5)
+	}
+	if a.Flags&(airfield.Outlanding|airfield.ULMSite) != 0 {
+		line += "2 "
+	} else {
+		line += "1 "
+	}
+	line += column(a.Name, 13)
+	switch {
+	case a.Flags&airfield.ULMSite != 0:
+		line += "   *ULM "
+	case a.Flags&airfield.Outlanding != 0:
+		if a.Catalog < 0 || a.Catalog > 99 {
+			return "", fmt.Errorf("invalid catalog :: %v", a.Catalog)
+		}
+		line += fmt.Sprintf("   *FL%02d", a.Catalog)
+	case a.Flags&airfield.GliderSite != 0 && a.ICAO != "":
+		line += "GLD#" + column(a.ICAO, 4)
+	case a.Flags&airfield.GliderSite != 0:
+		line += "GLD#GLD!"
+	default:
+		line += "   #" + column(a.ICAO, 4)
+	}
+	line += string(r.bit2RunwayType(a.Flags))
+	if a.Length < 0 || a.Length > 9999 {
+		return "", fmt.Errorf("invalid length :: %v", a.Length)
+	}
+	line += fmt.Sprintf("%03d", a.Length/10) + column(a.Runway, 4)
+	if a.Frequency != 0 {
+		f := int(math.Floor(a.Frequency*100 + 0.5))
+		line += fmt.Sprintf("%03d%02d", f/100, f%100)
+	} else {
+		line += "     "
+	}
+	return r.writePosition(line, a.Elevation, a.Latitude, a.Longitude, a.Region)
+}
+
+func (r *Release) bit2RunwayType(flags int) byte {
+	types := []struct {
+		flag int
+		t    byte
+	}{
+		{airfield.Asphalt, 'A'}, {airfield.Concrete, 'C'}, {airfield.Loam, 'L'}, {airfield.Sand, 'S'},
+		{airfield.Clay, 'Y'}, {airfield.Grass, 'G'}, {airfield.Gravel, 'V'}, {airfield.Dirt, 'D'},
+	}
+	for _, t := range types {
+		if flags&t.flag != 0 {
+			return t.t
+		}
+	}
+	return ' '
+}
+
+func (r *Release) writeWaypoint(wp waypoint.Waypoint) (string, error) {
+	id := column(wp.ID, 6)
+	if id[5] == '1' || id[5] == '2' {
+		return "", fmt.Errorf("id ending in 1 or 2 is reserved for airfields :: %v", wp.ID)
+	}
+	return r.writePosition(id+" "+column(wp.Description, 34), wp.Elevation, wp.Latitude, wp.Longitude, wp.Region)
+}
+
+// writePosition appends the elevation, coordinates and country code common
+// to airfields and waypoints to the given line.
+func (r *Release) writePosition(line string, elevation int, lat float64, lon float64, region string) (string, error) {
+	if elevation < -999 || elevation > 9999 {
+		return "", fmt.Errorf("invalid elevation :: %v", elevation)
+	}
+	return line + fmt.Sprintf("%4d", elevation) + spatial.FormatLatitude(lat, spatial.Welt2000) +
+		spatial.FormatLongitude(lon, spatial.Welt2000) + column(region, 2), nil
+}
+
+// column returns the given value padded with blanks or truncated to the
+// given width.
+func column(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
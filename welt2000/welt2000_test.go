@@ -20,15 +20,21 @@
 package welt2000
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/util"
 	"github.com/rochaporto/ezgliding/waypoint"
 )
 
@@ -54,7 +60,7 @@ var getAirfieldTests = []GetAirfieldTest{
 			airfield.Airfield{
 				ID: "HABER", Name: "HABERE POC69", ShortName: "HABER", Region: "FR",
 				ICAO: "", Flags: airfield.GliderSite | airfield.Grass, Catalog: 0,
-				Length: 0, Elevation: 1113, Runway: "0119", Frequency: 122.5,
+				Length: 980, Elevation: 1113, Runway: "0119", Frequency: 122.5,
 				Latitude: 46.26972222222222, Longitude: 6.463333333333334,
 				Update: time.Date(2014, time.February, 24, 12, 0, 0, 0, GMT),
 			},
@@ -164,7 +170,7 @@ var getWaypointTests = []GetWaypointTest{
 		[]waypoint.Waypoint{
 			waypoint.Waypoint{
 				ID: "FURKAP", Name: "FURKAP", Description: "FURKAPASS PASSHOEHE", Elevation: 2432,
-				Latitude: 46.57277777777778, Longitude: 8.415277777777778, Region: "CH",
+				Flags: waypoint.MountainPass, Latitude: 46.57277777777778, Longitude: 8.415277777777778, Region: "CH",
 				Update: time.Date(2014, time.February, 24, 12, 0, 0, 0, GMT),
 			},
 		},
@@ -507,7 +513,7 @@ func TestParseWaypoint(t *testing.T) {
 	r.Parse([]byte("FURKAP FURKAPASS PASSHOEHE               2432N463422E0082455CHQ6"))
 	wpoint := r.Waypoints[0]
 	expected := waypoint.Waypoint{
-		Name: "FURKAP", ID: "FURKAP", Description: "FURKAPASS PASSHOEHE",
+		Name: "FURKAP", ID: "FURKAP", Description: "FURKAPASS PASSHOEHE", Flags: waypoint.MountainPass,
 		Latitude: 46.57277777777778, Longitude: 8.415277777777778, Elevation: 2432, Region: "CH",
 	}
 	if wpoint != expected {
@@ -515,6 +521,264 @@ func TestParseWaypoint(t *testing.T) {
 	}
 }
 
+var writeLines = []string{
+	"ANNEM1 ANNEMASSE       #LFLIA129123012587 494N461131E0061606FR",
+	"CHALA1 CHALAIS      GLD#LFIHG083072512350  88N451605E0000058FR",
+	"HABER1 HABERE POC69 GLD#GLD!G0980119122501113N461611E0062748FR",
+	"BONVI2 BONNEVILLE      *FL53S040052312300 450N460441E0062310FR",
+	"MEGEV2 MEGEVE ULM      *ULM G0301028122501450N454930E0063702FR",
+	"AMBL21 AMBLETEUSE      #    G000           32N504901E0013658FR",
+	"FURKAP FURKAPASS PASSHOEHE               2432N463422E0082455CH",
+}
+
+func TestWrite(t *testing.T) {
+	r := Release{}
+	content := strings.Join(writeLines, "\r\n") + "\r\n"
+	if err := r.Parse([]byte(content)); err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	if buf.String() != content {
+		t.Errorf("expected\n%v\ngot\n%v", content, buf.String())
+	}
+	result := Release{}
+	if err := result.Parse(buf.Bytes()); err != nil {
+		t.Fatalf("failed to parse written release :: %v", err)
+	}
+	if !reflect.DeepEqual(result, r) {
+		t.Errorf("expected %+v got %+v", r, result)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	r := Release{
+		Airfields: []airfield.Airfield{
+			airfield.Airfield{ID: "LFLE", ShortName: "CHALL", Name: "CHALLES", Region: "FR", ICAO: "LFLE",
+				Flags: airfield.Asphalt, Length: 1200, Elevation: 296, Runway: "1836", Frequency: 122.999,
+				Latitude: 45.5, Longitude: -6.25},
+			airfield.Airfield{ID: "STREE", ShortName: "STREE", Name: "ST REMY NORTH FIELD", Region: "FR",
+				Flags: airfield.Outlanding | airfield.Grass, Catalog: 7, Length: 300, Elevation: 450, Runway: "0927",
+				Latitude: -45.5, Longitude: 6.25},
+		},
+		Waypoints: []waypoint.Waypoint{
+			waypoint.Waypoint{ID: "TOWERA", Name: "TOWERA", Description: "TV TOWER ON THE HILL", Region: "FR",
+				Flags: waypoint.Mast, Elevation: -10, Latitude: 45.25, Longitude: 6.75},
+		},
+	}
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	result := Release{}
+	if err := result.Parse(buf.Bytes()); err != nil {
+		t.Fatalf("failed to parse written release :: %v", err)
+	}
+	// name is truncated to 13 characters, frequency to 2 decimals
+	r.Airfields[0].Frequency = 123
+	r.Airfields[1].Name = "ST REMY NORTH"
+	if !reflect.DeepEqual(result, r) {
+		t.Errorf("expected %+v got %+v", r, result)
+	}
+}
+
+var writeErrorTests = []struct {
+	t string
+	r Release
+}{
+	{"reserved waypoint id", Release{Waypoints: []waypoint.Waypoint{waypoint.Waypoint{ID: "TOWER1"}}}},
+	{"invalid elevation", Release{Waypoints: []waypoint.Waypoint{waypoint.Waypoint{ID: "TOWER", Elevation: 10000}}}},
+	{"invalid length", Release{Airfields: []airfield.Airfield{airfield.Airfield{ShortName: "A", Length: 10000}}}},
+	{"invalid catalog", Release{Airfields: []airfield.Airfield{
+		airfield.Airfield{ShortName: "A", Flags: airfield.Outlanding, Catalog: 100}}}},
+}
+
+func TestWriteError(t *testing.T) {
+	for _, test := range writeErrorTests {
+		if err := test.r.Write(ioutil.Discard); err == nil {
+			t.Errorf("%v :: expected error but got success", test.t)
+		}
+	}
+}
+
+func TestPutFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "welt2000")
+	if err != nil {
+		t.Fatalf("failed to create temporary dir :: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	plugin, _ := New(Config{File: filepath.Join(dir, "WELT2000.TXT")})
+	r := Release{}
+	r.Parse([]byte(strings.Join(writeLines, "\n")))
+
+	if err := plugin.PutWaypoint(r.Waypoints); err != nil {
+		t.Fatalf("failed to put waypoints :: %v", err)
+	}
+	if err := plugin.PutAirfield(r.Airfields); err != nil {
+		t.Fatalf("failed to put airfields :: %v", err)
+	}
+	result, err := Fetch(plugin.File)
+	if err != nil {
+		t.Fatalf("failed to fetch written release :: %v", err)
+	}
+	if !reflect.DeepEqual(result.Airfields, r.Airfields) || !reflect.DeepEqual(result.Waypoints, r.Waypoints) {
+		t.Errorf("expected %+v got %+v", r, result)
+	}
+}
+
+var parseErrorTests = []struct {
+	t       string
+	content string
+	line    int
+}{
+	{"short airfield", "$ comment\nANNEM1 ANNEMASSE       #LFLIA129123012587 494N461131E00616", 2},
+	{"short waypoint", "FURKAP FURKAPASS", 1},
+	{"invalid elevation", "\n\nFURKAP FURKAPASS PASSHOEHE               24X2N463422E0082455CH", 3},
+	{"invalid latitude", "FURKAP FURKAPASS PASSHOEHE               2432N463X22E0082455CH", 1},
+	{"invalid longitude", "ANNEM1 ANNEMASSE       #LFLIA129123012587 494N461131X0061606FR", 1},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		r := Release{}
+		err := r.Parse([]byte(test.content))
+		perr, ok := err.(util.ParseError)
+		if !ok {
+			t.Errorf("%v :: expected parse error got %v", test.t, err)
+			continue
+		}
+		if perr.Line != test.line {
+			t.Errorf("%v :: expected error in line %v got %v", test.t, test.line, perr)
+		}
+	}
+}
+
+func TestParseSkipInvalid(t *testing.T) {
+	content := strings.Join([]string{
+		writeLines[0],
+		"FURKAP FURKAPASS",
+		writeLines[2],
+		"ANNEM1 ANNEMASSE       #LFLIA129123012587 494N461131X0061606FR",
+		writeLines[6],
+	}, "\n")
+	r := Release{}
+	if err := r.Parse([]byte(content)); err != nil {
+		t.Fatalf("expected invalid records to be skipped got %v", err)
+	}
+	if len(r.Airfields) != 2 || len(r.Waypoints) != 1 {
+		t.Errorf("expected 2 airfields and 1 waypoint got %v and %v", len(r.Airfields), len(r.Waypoints))
+	}
+	if len(r.Errors) != 2 || r.Errors[0].Line != 2 || r.Errors[1].Line != 4 {
+		t.Errorf("expected errors in lines 2 and 4 got %v", r.Errors)
+	}
+}
+
+func TestParseCRLF(t *testing.T) {
+	r := Release{}
+	err := r.Parse([]byte("$ comment\r\nFURKAP FURKAPASS PASSHOEHE               2432N463422E0082455CH\r\n\r\n"))
+	if err != nil || len(r.Waypoints) != 1 || r.Waypoints[0].Region != "CH" {
+		t.Errorf("parse failed for crlf content :: %v :: %+v", err, r.Waypoints)
+	}
+}
+
+func TestParseLatin1(t *testing.T) {
+	for _, content := range []string{
+		"ZURIC1 Z\xdcRICH KLOTEN   #LSZHA370140411810 432N472729E0083259CH",
+		"ZURIC1 ZÜRICH KLOTEN   #LSZHA370140411810 432N472729E0083259CH",
+	} {
+		r := Release{}
+		if err := r.Parse([]byte(content)); err != nil {
+			t.Errorf("failed to parse %q :: %v", content, err)
+			continue
+		}
+		if a := r.Airfields[0]; a.Name != "ZÜRICH KLOTEN" || a.ICAO != "LSZH" || a.Elevation != 432 {
+			t.Errorf("parse failed for %q :: %+v", content, a)
+		}
+	}
+	// written back in ISO-8859-1
+	r := Release{Airfields: []airfield.Airfield{airfield.Airfield{ShortName: "ZURIC", Name: "ZÜRICH"}}}
+	var buf bytes.Buffer
+	r.Write(&buf)
+	if !strings.HasPrefix(buf.String(), "ZURIC1 Z\xdcRICH") {
+		t.Errorf("expected iso-8859-1 content got %q", buf.String())
+	}
+}
+
+var parseLengthTests = []struct {
+	line   string
+	length int
+	freq   float64
+}{
+	{"CHALA1 CHALAIS      GLD#LFIHG 83072512350  88N451605E0000058FRQ0", 830, 123.5},
+	{"AMBL21 AMBLETEUSE AERO #   ?G       1      32N504901E0013658FRQ0", 0, 0},
+	{"ANNEM1 ANNEMASSE       #LFLIA129123012587 494N461131E0061606FRQ0", 1290, 125.87},
+}
+
+func TestParseLengthFrequency(t *testing.T) {
+	for _, test := range parseLengthTests {
+		r := Release{}
+		if err := r.Parse([]byte(test.line)); err != nil {
+			t.Errorf("failed to parse %v :: %v", test.line, err)
+			continue
+		}
+		if a := r.Airfields[0]; a.Length != test.length || a.Frequency != test.freq {
+			t.Errorf("expected length %v and frequency %v got %v and %v", test.length, test.freq, a.Length, a.Frequency)
+		}
+	}
+}
+
+var descriptionTests = []struct {
+	description string
+	flags       int
+}{
+	{"FURKAPASS PASSHOEHE", waypoint.MountainPass},
+	{"COL DE LA CROIX", waypoint.MountainPass},
+	{"ZUGSPITZE GIPFEL", waypoint.MountainTop},
+	{"TV SENDER", waypoint.Mast},
+	{"KKW GOESGEN KUEHLTURM", waypoint.PowerPlant | waypoint.CoolingTower},
+	{"STAUMAUER", waypoint.Dam},
+	{"BR X BAB", waypoint.Bridge | waypoint.HighwayExit},
+	{"A8 SX B304", waypoint.Intersection},
+	{"SCHWARZWALDHUETTE", waypoint.Hut},
+	{"CABANE DU MONT FORT", waypoint.Hut},
+	{"KAMIN KRAFTWERK", waypoint.Obstacle | waypoint.PowerPlant},
+	{"BF.NORD", waypoint.RailwayStation},
+	{"SCHLOSS NEUSCHWANSTEIN", waypoint.Castle},
+	{"KIRCHE", 0},
+	{"", 0},
+}
+
+func TestDescription2Bit(t *testing.T) {
+	r := Release{}
+	for _, test := range descriptionTests {
+		if f := r.description2Bit(test.description); f != test.flags {
+			t.Errorf("%v :: expected flags %v got %v", test.description, test.flags, f)
+		}
+	}
+}
+
+func TestListManyReleases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>welt2000</title>`)
+		for i := 0; i < 15; i++ {
+			fmt.Fprintf(w, "<item><title>%d</title><link>http://localhost/%d</link>"+
+				"<pubDate>Mon, 24 Feb 2014 12:00:00 GMT</pubDate></item>", i, i)
+		}
+		io.WriteString(w, "</channel></rss>")
+	}))
+	defer ts.Close()
+
+	releases, err := List(ts.URL)
+	if err != nil {
+		t.Errorf("failed to list releases :: %v", err)
+	}
+	if len(releases) != 15 {
+		t.Errorf("expected 15 releases got %v", len(releases))
+	}
+}
+
 func BenchmarkFetch(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_, err := Fetch("./t/test-release-bench.txt")
@@ -523,3 +787,141 @@ func BenchmarkFetch(b *testing.B) {
 		}
 	}
 }
+
+func TestDiff(t *testing.T) {
+	previous := Release{}
+	if err := previous.Parse([]byte(strings.Join(writeLines, "\n"))); err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	current := Release{Date: time.Date(2014, 3, 1, 12, 0, 0, 0, GMT)}
+	if err := current.Parse([]byte(strings.Join([]string{
+		writeLines[0], writeLines[2][:17] + "70" + writeLines[2][19:],
+		writeLines[3], writeLines[4], writeLines[5],
+		"TOWERA TOWER ANNECY                       450N455330E0060742FR",
+	}, "\n"))); err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+
+	c := Diff(&previous, &current)
+	for _, test := range []struct {
+		t        string
+		got      int
+		expected int
+	}{
+		{"added airfields", len(c.AddedAirfields), 0},
+		{"removed airfields", len(c.RemovedAirfields), 1},
+		{"modified airfields", len(c.ModifiedAirfields), 1},
+		{"added waypoints", len(c.AddedWaypoints), 1},
+		{"removed waypoints", len(c.RemovedWaypoints), 1},
+		{"modified waypoints", len(c.ModifiedWaypoints), 0},
+	} {
+		if test.got != test.expected {
+			t.Errorf("expected %v %v got %v", test.expected, test.t, test.got)
+		}
+	}
+	if len(c.RemovedAirfields) == 1 && c.RemovedAirfields[0].ShortName != "CHALA" {
+		t.Errorf("expected CHALA removed got %v", c.RemovedAirfields[0])
+	}
+	if len(c.ModifiedAirfields) == 1 && c.ModifiedAirfields[0].Name != "HABERE POC70" {
+		t.Errorf("expected HABERE POC70 modified got %v", c.ModifiedAirfields[0])
+	}
+	if len(c.AddedWaypoints) == 1 && c.AddedWaypoints[0].ID != "TOWERA" {
+		t.Errorf("expected TOWERA added got %v", c.AddedWaypoints[0])
+	}
+	if len(c.RemovedWaypoints) == 1 && c.RemovedWaypoints[0].ID != "FURKAP" {
+		t.Errorf("expected FURKAP removed got %v", c.RemovedWaypoints[0])
+	}
+
+	current.keepUpdates(&previous)
+	for _, a := range current.Airfields {
+		expected := previous.Date
+		if a.ShortName == "HABER" {
+			expected = current.Date
+		}
+		if !a.Update.Equal(expected) {
+			t.Errorf("expected update %v for %v got %v", expected, a.ShortName, a.Update)
+		}
+	}
+
+	if c = Diff(&current, &current); !reflect.DeepEqual(c, Changes{}) {
+		t.Errorf("expected no changes got %v", c)
+	}
+}
+
+func TestGetIncremental(t *testing.T) {
+	date := "24 Feb 2014 12:00:00 GMT"
+	lines := writeLines
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rss" {
+			fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>welt2000</title>`+
+				`<item><title>update</title><link>http://localhost/</link><pubDate>%v</pubDate></item>`+
+				`</channel></rss>`, date)
+			return
+		}
+		fetches++
+		io.WriteString(w, strings.Join(lines, "\r\n"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "welt2000")
+	if err != nil {
+		t.Fatalf("failed to create temp dir :: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := Config{RSSURL: ts.URL + "/rss", ReleaseURL: ts.URL + "/release",
+		Cache: filepath.Join(dir, "welt2000.json")}
+	first := time.Date(2014, 2, 24, 12, 0, 0, 0, GMT)
+
+	plugin, _ := New(cfg)
+	airfields, err := plugin.GetAirfield(nil, time.Time{})
+	if err != nil || len(airfields) != 6 {
+		t.Fatalf("expected 6 airfields got %v :: %v", len(airfields), err)
+	}
+	airfields, err = plugin.GetAirfield(nil, first)
+	if err != nil || len(airfields) != 0 || fetches != 1 {
+		t.Errorf("expected 0 airfields and 1 fetch got %v and %v :: %v", len(airfields), fetches, err)
+	}
+
+	// a new plugin instance reuses the cache while there's no new release
+	plugin, _ = New(cfg)
+	waypoints, err := plugin.GetWaypoint([]string{"CH"}, time.Time{})
+	if err != nil || len(waypoints) != 1 || fetches != 1 {
+		t.Errorf("expected 1 waypoint and 1 fetch got %v and %v :: %v", len(waypoints), fetches, err)
+	}
+
+	date = "01 Mar 2014 12:00:00 GMT"
+	lines = []string{writeLines[0], writeLines[2][:17] + "70" + writeLines[2][19:],
+		writeLines[6], "TOWERA TOWER ANNECY                       450N455330E0060742FR"}
+	airfields, err = plugin.GetAirfield([]string{""}, first)
+	if err != nil || len(airfields) != 1 || fetches != 2 {
+		t.Fatalf("expected 1 airfield and 2 fetches got %v and %v :: %v", len(airfields), fetches, err)
+	}
+	if airfields[0].Name != "HABERE POC70" {
+		t.Errorf("expected HABERE POC70 got %v", airfields[0].Name)
+	}
+	waypoints, err = plugin.GetWaypoint(nil, first)
+	if err != nil || len(waypoints) != 1 || waypoints[0].ID != "TOWERA" {
+		t.Errorf("expected TOWERA got %v :: %v", waypoints, err)
+	}
+	waypoints, err = plugin.GetWaypoint(nil, time.Time{})
+	if err != nil || len(waypoints) != 2 {
+		t.Errorf("expected 2 waypoints got %v :: %v", len(waypoints), err)
+	}
+}
+
+func TestGetBrokenCache(t *testing.T) {
+	f, err := ioutil.TempFile("", "welt2000")
+	if err != nil {
+		t.Fatalf("failed to create temp file :: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not json")
+	f.Close()
+
+	plugin, _ := New(Config{RSSURL: "./t/test-releases-list.xml",
+		ReleaseURL: "./t/test-release-basic.txt", Cache: f.Name()})
+	if _, err := plugin.GetAirfield(nil, time.Time{}); err == nil {
+		t.Errorf("expected error with a broken cache")
+	}
+}
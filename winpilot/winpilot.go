@@ -0,0 +1,170 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+// Package winpilot provides functionality to read and write waypoints in
+// the Winpilot format, also used by Cambridge and LX instruments (.dat).
+//
+// Each record holds a number, latitude, longitude, elevation (with an F or
+// M suffix), attributes, name and an optional comment:
+//
+//	1,45:33.650N,005:58.617E,296M,ATL,Challes,LFLE
+//
+// Lines starting with '*' are comments.
+package winpilot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/spatial"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+// Parse parses the given Winpilot content.
+//
+// Landable points (attributes A or L) are returned as airfields, landable
+// points which are not airports (L only) being outlandings. The comment
+// is the airfield code, or the waypoint description.
+func Parse(content []byte) ([]airfield.Airfield, []waypoint.Waypoint, error) {
+	airfields := []airfield.Airfield{}
+	waypoints := []waypoint.Waypoint{}
+	for i, line := range strings.Split(util.DecodeText(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '*' {
+			continue
+		}
+		fields := strings.SplitN(line, ",", 7)
+		if len(fields) < 6 {
+			return nil, nil, util.ParseError{Line: i + 1, Err: fmt.Errorf("expected at least 6 fields :: %v", line)}
+		}
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			return nil, nil, util.ParseError{Line: i + 1, Err: fmt.Errorf("invalid number :: %v", fields[0])}
+		}
+		lat, err := spatial.ParseLatitude(fields[1])
+		if err != nil {
+			return nil, nil, util.ParseError{Line: i + 1, Err: err}
+		}
+		lon, err := spatial.ParseLongitude(fields[2])
+		if err != nil {
+			return nil, nil, util.ParseError{Line: i + 1, Err: err}
+		}
+		elevation, err := parseElevation(fields[3])
+		if err != nil {
+			return nil, nil, util.ParseError{Line: i + 1, Err: err}
+		}
+		attrs, name, comment := strings.ToUpper(fields[4]), fields[5], ""
+		if len(fields) == 7 {
+			comment = fields[6]
+		}
+
+		if strings.ContainsAny(attrs, "AL") {
+			code := comment
+			if code == "" {
+				code = name
+			}
+			a := airfield.Airfield{ID: code, ShortName: code, Name: name, Elevation: elevation,
+				Latitude: lat, Longitude: lon}
+			if !strings.Contains(attrs, "A") {
+				a.Flags = airfield.Outlanding
+			}
+			airfields = append(airfields, a)
+		} else {
+			waypoints = append(waypoints, waypoint.Waypoint{ID: name, Name: name, Description: comment,
+				Elevation: elevation, Latitude: lat, Longitude: lon})
+		}
+	}
+	return airfields, waypoints, nil
+}
+
+// parseElevation parses the given elevation, returning it in meters. An
+// empty elevation (as in some Cambridge and LX exports) is taken as 0.
+func parseElevation(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	factor := 1.0
+	switch {
+	case strings.HasSuffix(strings.ToUpper(s), "F"):
+		factor, s = 0.3048, s[:len(s)-1]
+	case strings.HasSuffix(strings.ToUpper(s), "M"):
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid elevation :: %v", s)
+	}
+	return int(math.Floor(v*factor + 0.5)), nil
+}
+
+// Detect returns true if the given content looks like a Winpilot file,
+// checking the coordinate notation in its first record.
+func Detect(content []byte) bool {
+	for _, line := range strings.Split(util.DecodeText(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '*' {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 6 || !strings.Contains(fields[1], ":") {
+			return false
+		}
+		_, err := spatial.ParseLatitude(fields[1])
+		return err == nil
+	}
+	return false
+}
+
+// Write writes the given airfields and waypoints in the Winpilot format,
+// numbered from 1 in the given order. Records end in CRLF.
+func Write(w io.Writer, airfields []airfield.Airfield, waypoints []waypoint.Waypoint) error {
+	bw := bufio.NewWriter(w)
+	n := 1
+	for _, a := range airfields {
+		attrs := "AT"
+		if a.Flags&airfield.Outlanding != 0 {
+			attrs = "LT"
+		}
+		writeRecord(bw, n, a.Latitude, a.Longitude, a.Elevation, attrs, a.Name, a.ShortName)
+		n++
+	}
+	for _, wp := range waypoints {
+		writeRecord(bw, n, wp.Latitude, wp.Longitude, wp.Elevation, "T", wp.Name, wp.Description)
+		n++
+	}
+	return bw.Flush()
+}
+
+// writeRecord writes a single Winpilot record. Commas are not allowed in
+// names, and are replaced by spaces.
+func writeRecord(w io.Writer, n int, lat float64, lon float64, elevation int,
+	attrs string, name string, comment string) {
+	fmt.Fprintf(w, "%d,%v,%v,%dM,%v,%v,%v\r\n", n,
+		spatial.FormatLatitude(lat, spatial.Winpilot), spatial.FormatLongitude(lon, spatial.Winpilot),
+		elevation, attrs, strings.Replace(name, ",", " ", -1), comment)
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 The ezgliding Authors.
+//
+// This file is part of ezgliding.
+//
+// ezgliding is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ezgliding is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ezgliding.  If not, see <http://www.gnu.org/licenses/>.
+//
+// Author: Ricardo Rocha <rocha.porto@gmail.com>
+
+package winpilot
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rochaporto/ezgliding/airfield"
+	"github.com/rochaporto/ezgliding/util"
+	"github.com/rochaporto/ezgliding/waypoint"
+)
+
+const testDat = `* Savoy waypoints
+1,45:33.650N,005:58.617E,296M,ATLH,Challes,LFLE
+2,45:30:00N,006:00:00E,1000F,LT,Chambery Sud,
+3,45:03.833N,006:24.483E,2642M,T,Col du Galibier,Mountain pass, north side
+4,45:00.000S,007:00.000W,300,TS,Start,
+`
+
+func TestParse(t *testing.T) {
+	airfields, waypoints, err := Parse([]byte(strings.Replace(testDat, "\n", "\r\n", -1)))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	ea := []airfield.Airfield{
+		airfield.Airfield{ID: "LFLE", ShortName: "LFLE", Name: "Challes", Elevation: 296},
+		airfield.Airfield{ID: "Chambery Sud", ShortName: "Chambery Sud", Name: "Chambery Sud",
+			Flags: airfield.Outlanding, Elevation: 305, Latitude: 45.5, Longitude: 6},
+	}
+	ew := []waypoint.Waypoint{
+		waypoint.Waypoint{ID: "Col du Galibier", Name: "Col du Galibier",
+			Description: "Mountain pass, north side", Elevation: 2642},
+		waypoint.Waypoint{ID: "Start", Name: "Start", Elevation: 300, Latitude: -45, Longitude: -7},
+	}
+	if math.Abs(airfields[0].Latitude-(45+33.650/60)) > 1e-9 || math.Abs(airfields[0].Longitude-(5+58.617/60)) > 1e-9 {
+		t.Errorf("wrong position :: %v %v", airfields[0].Latitude, airfields[0].Longitude)
+	}
+	airfields[0].Latitude, airfields[0].Longitude = 0, 0
+	waypoints[0].Latitude, waypoints[0].Longitude = 0, 0
+	if !reflect.DeepEqual(airfields, ea) {
+		t.Errorf("expected %+v got %+v", ea, airfields)
+	}
+	if !reflect.DeepEqual(waypoints, ew) {
+		t.Errorf("expected %+v got %+v", ew, waypoints)
+	}
+}
+
+func TestParseEmptyElevation(t *testing.T) {
+	_, waypoints, err := Parse([]byte("1,45:33.650N,005:58.617E,,T,Galibier,\n2,45:33.650N,005:58.617E, ,T,Iseran,\n"))
+	if err != nil {
+		t.Fatalf("failed to parse waypoints with no elevation :: %v", err)
+	}
+	if len(waypoints) != 2 || waypoints[0].Elevation != 0 || waypoints[1].Elevation != 0 {
+		t.Errorf("expected 2 waypoints with no elevation got %+v", waypoints)
+	}
+}
+
+var parseErrorTests = []struct {
+	t       string
+	content string
+	line    int
+}{
+	{"missing fields", "1,45:33.650N,005:58.617E,296M,AT", 1},
+	{"bad number", "* comment\nX,45:33.650N,005:58.617E,296M,AT,Challes", 2},
+	{"bad latitude", "1,95:33.650N,005:58.617E,296M,AT,Challes", 1},
+	{"bad longitude", "1,45:33.650N,005:58.617X,296M,AT,Challes", 1},
+	{"bad elevation", "1,45:33.650N,005:58.617E,29XM,AT,Challes", 1},
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range parseErrorTests {
+		_, _, err := Parse([]byte(test.content))
+		perr, ok := err.(util.ParseError)
+		if !ok {
+			t.Errorf("%v :: expected parse error got %v", test.t, err)
+			continue
+		}
+		if perr.Line != test.line {
+			t.Errorf("%v :: expected error in line %v got %v", test.t, test.line, perr)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	airfields, waypoints, err := Parse([]byte(testDat))
+	if err != nil {
+		t.Fatalf("failed to parse :: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, airfields, waypoints); err != nil {
+		t.Fatalf("failed to write :: %v", err)
+	}
+	expected := strings.Join([]string{
+		"1,45:33.650N,005:58.617E,296M,AT,Challes,LFLE",
+		"2,45:30.000N,006:00.000E,305M,LT,Chambery Sud,Chambery Sud",
+		"3,45:03.833N,006:24.483E,2642M,T,Col du Galibier,Mountain pass, north side",
+		"4,45:00.000S,007:00.000W,300M,T,Start,",
+		"",
+	}, "\r\n")
+	if buf.String() != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, buf.String())
+	}
+	ra, rw, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse written content :: %v", err)
+	}
+	if !reflect.DeepEqual(ra, airfields) || !reflect.DeepEqual(rw, waypoints) {
+		t.Errorf("round trip failed :: expected %+v %+v got %+v %+v", airfields, waypoints, ra, rw)
+	}
+}
+
+var detectTests = []struct {
+	t       string
+	content string
+	r       bool
+}{
+	{"winpilot", testDat, true},
+	{"cup", "\"Challes\",\"LFLE\",FR,4533.650N,00558.617E,296m,4,180,620m,\"122.500\",\"\"", false},
+	{"ozi", "OziExplorer Waypoint File Version 1.1\nWGS 84\n", false},
+	{"empty", "* only a comment", false},
+}
+
+func TestDetect(t *testing.T) {
+	for _, test := range detectTests {
+		if r := Detect([]byte(test.content)); r != test.r {
+			t.Errorf("test %v failed, expected %v got %v", test.t, test.r, r)
+		}
+	}
+}